@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/pkg/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	contactName        string
+	contactAddrs       []string
+	contactPort        int
+	contactInbox       bool
+	contactFingerprint string
+	contactNotes       string
+)
+
+var bookCmd = &cobra.Command{
+	Use:   "book",
+	Short: "Show or change the address book of saved peers",
+	Long: `Show or change the address book of saved peers, shared with the desktop app.
+
+Saved peers are listed by peers and push next to the ones found on the
+network, and can be picked by name, as in receive --from buildbox. Use them
+for machines discovery can't reach but whose addresses don't change, such as
+servers on another subnet. A pinned fingerprint is checked when connecting.
+
+Without a subcommand, all saved peers are listed; with --json each one is
+printed as one JSON object per line.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		contacts, err := config.LoadAddressBook()
+		if err != nil {
+			return err
+		}
+		switch {
+		case jsonOutput:
+			enc := json.NewEncoder(os.Stdout)
+			for _, c := range contacts {
+				if err := enc.Encode(c); err != nil {
+					return fmt.Errorf("failed to write address book: %w", err)
+				}
+			}
+		case len(contacts) == 0:
+			ui.Info("The address book is empty.")
+		default:
+			printContacts(contacts)
+		}
+		return nil
+	},
+}
+
+var bookAddCmd = &cobra.Command{
+	Use:   "add <name> --addr <address> --port <port>",
+	Short: "Save a peer",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := config.Contact{
+			Name:        args[0],
+			Addresses:   contactAddrs,
+			Port:        contactPort,
+			Inbox:       contactInbox,
+			Fingerprint: contactFingerprint,
+			Notes:       contactNotes,
+		}
+		if err := saveContact("", c); err != nil {
+			return err
+		}
+		ui.Success("Saved %s", strings.TrimSpace(args[0]))
+		return nil
+	},
+}
+
+var bookEditCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Change a saved peer",
+	Long: `Change a saved peer. Only the fields given as flags change; --addr
+replaces all the addresses, and --name renames the peer.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		contacts, err := config.LoadAddressBook()
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(contacts, func(c config.Contact) bool {
+			return strings.EqualFold(c.Name, args[0])
+		})
+		if i < 0 {
+			return usageError(fmt.Errorf("%w: %s", config.ErrNoContact, args[0]))
+		}
+
+		c := contacts[i]
+		flags := cmd.Flags()
+		if flags.Changed("name") {
+			c.Name = contactName
+		}
+		if flags.Changed("addr") {
+			c.Addresses = contactAddrs
+		}
+		if flags.Changed("port") {
+			c.Port = contactPort
+		}
+		if flags.Changed("inbox") {
+			c.Inbox = contactInbox
+		}
+		if flags.Changed("fingerprint") {
+			c.Fingerprint = contactFingerprint
+		}
+		if flags.Changed("notes") {
+			c.Notes = contactNotes
+		}
+		if err := saveContact(contacts[i].Name, c); err != nil {
+			return err
+		}
+		ui.Success("Saved %s", strings.TrimSpace(c.Name))
+		return nil
+	},
+}
+
+var bookRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Delete a saved peer",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.RemoveContact(args[0]); err != nil {
+			if errors.Is(err, config.ErrNoContact) {
+				return usageError(err)
+			}
+			return err
+		}
+		ui.Success("Removed %s", args[0])
+		return nil
+	},
+}
+
+// saveContact saves c in place of previous, reporting invalid flags as
+// usage errors.
+func saveContact(previous string, c config.Contact) error {
+	err := config.SaveContact(previous, c)
+	if errors.Is(err, config.ErrInvalidContact) || errors.Is(err, config.ErrNoContact) {
+		return usageError(err)
+	}
+	return err
+}
+
+// useAddressBook makes discovery list the saved peers of the address book
+// next to the ones found on the network.
+func useAddressBook() {
+	if path, err := config.AddressBookPath(); err == nil {
+		discovery.SetDiscoverer(append(discovery.Network(), discovery.StaticFile{Path: path}))
+	}
+}
+
+func printContacts(contacts []config.Contact) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tADDRESSES\tPORT\tFINGERPRINT\tNOTES")
+	for _, c := range contacts {
+		kind := "share"
+		if c.Inbox {
+			kind = "inbox"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", c.Name, kind, strings.Join(c.Addresses, ","), c.Port, shortFingerprint(c.Fingerprint), dash(c.Notes))
+	}
+	w.Flush()
+}
+
+// addContactFlags adds the flags describing a saved peer to cmd.
+func addContactFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&contactAddrs, "addr", nil, "IP address or host name of the peer; repeat or separate with commas for several")
+	cmd.Flags().IntVar(&contactPort, "port", 0, "TCP port the peer listens on, which needs to be fixed on the peer's side")
+	cmd.Flags().BoolVar(&contactInbox, "inbox", false, "The peer runs an inbox to push to, rather than shares to receive from")
+	cmd.Flags().StringVar(&contactFingerprint, "fingerprint", "", "Certificate fingerprint (or prefix) to pin when connecting")
+	cmd.Flags().StringVar(&contactNotes, "notes", "", "Free-form notes about the peer")
+}
+
+func init() {
+	addContactFlags(bookAddCmd)
+	addContactFlags(bookEditCmd)
+	bookEditCmd.Flags().StringVar(&contactName, "name", "", "New name for the peer")
+	bookCmd.AddCommand(bookAddCmd)
+	bookCmd.AddCommand(bookEditCmd)
+	bookCmd.AddCommand(bookRemoveCmd)
+	rootCmd.AddCommand(bookCmd)
+}
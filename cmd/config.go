@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/netutil"
+	"github.com/example/synapse/pkg/ui"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show or change the settings shared with the desktop app",
+	Long: fmt.Sprintf(`Show or change the settings shared with the desktop app.
+
+Without a subcommand, all settings are listed. Settings: %s.`, strings.Join(config.Keys, ", ")),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := config.LoadSettings()
+		if jsonOutput {
+			if err := json.NewEncoder(os.Stdout).Encode(s); err != nil {
+				return fmt.Errorf("failed to write settings: %w", err)
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, key := range config.Keys {
+			value, _ := s.Get(key)
+			fmt.Fprintf(w, "%s\t%s\n", key, value)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <setting>",
+	Short: "Print the value of a setting",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := config.LoadSettings().Get(args[0])
+		if err != nil {
+			return usageError(err)
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <setting> <value>",
+	Short: "Change a setting",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := config.LoadSettings()
+		if err := s.Set(args[0], args[1]); err != nil {
+			return usageError(err)
+		}
+		if err := config.SaveSettings(s); err != nil {
+			return fmt.Errorf("error saving settings: %w", err)
+		}
+		ui.Success("%s set to %s", args[0], args[1])
+		return nil
+	},
+}
+
+// portFlag is the --port flag of the commands that listen for peers.
+var portFlag string
+
+// addPortFlag adds --port to a command that listens for peers.
+func addPortFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&portFlag, "port", "", "TCP port, or range of ports tried in order such as 4242-4250, to listen on (default: the port setting, or any free port)")
+}
+
+// listenPorts returns the ports to listen on, from --port or the port
+// setting; 0, 0 means any free port.
+func listenPorts() (first, last int, err error) {
+	if portFlag == "" {
+		s := config.LoadSettings()
+		return s.Port, s.PortLast, nil
+	}
+	first, last, err = netutil.ParsePortRange(portFlag)
+	if err != nil {
+		return 0, 0, usageError(fmt.Errorf("invalid --port: %w", err))
+	}
+	return first, last, nil
+}
+
+// deviceID returns the ID this device is announced with, or "" if it can't
+// be stored; peers then tell the device apart by its name.
+func deviceID() string {
+	id, err := config.DeviceID()
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// deviceCertificate returns the certificate shares and inboxes present, or
+// nil if it can't be stored; each then generates its own, and pins of it
+// only hold until it stops.
+func deviceCertificate() *tls.Certificate {
+	cert, err := config.DeviceCertificate()
+	if err != nil {
+		ui.Error("Failed to load the device certificate: %v", err)
+		return nil
+	}
+	return &cert
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	rootCmd.AddCommand(configCmd)
+}
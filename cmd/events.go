@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
+)
+
+// jsonOutput switches the CLI to newline-delimited JSON events on stdout.
+var jsonOutput bool
+
+// progressInterval throttles progress events per transfer.
+const progressInterval = 250 * time.Millisecond
+
+// Event names emitted in --json mode.
+const (
+	eventListening = "listening"
+	eventConnected = "peer_connected"
+	eventProgress  = "progress"
+	eventVerified  = "verified"
+	eventCompleted = "completed"
+	eventError     = "error"
+
+	eventPeer        = "peer"
+	eventPeerAdded   = "peer_added"
+	eventPeerUpdated = "peer_updated"
+	eventPeerRemoved = "peer_removed"
+)
+
+// event is one line of --json output. Fields that don't apply to an event
+// are omitted.
+type event struct {
+	Event       string                  `json:"event"`
+	Time        string                  `json:"time"`
+	Port        int                     `json:"port,omitempty"`
+	Fingerprint string                  `json:"fingerprint,omitempty"`
+	Code        string                  `json:"code,omitempty"` // Connection code, for receivers that can't discover the share
+	ShareCode   string                  `json:"share_code,omitempty"`
+	Peer        string                  `json:"peer,omitempty"`
+	DeviceID    string                  `json:"device_id,omitempty"`
+	PeerAddr    string                  `json:"peer_addr,omitempty"`
+	Hostname    string                  `json:"hostname,omitempty"`
+	Addresses   []string                `json:"addresses,omitempty"`
+	OS          string                  `json:"os,omitempty"`
+	Share       *discovery.ShareSummary `json:"share,omitempty"`
+	Saved       bool                    `json:"saved,omitempty"` // The peer is in the address book
+	TXT         map[string]string       `json:"txt,omitempty"`
+	File        string                  `json:"file,omitempty"`
+	Path        string                  `json:"path,omitempty"`
+	Text        *string                 `json:"text,omitempty"`
+	Bytes       int64                   `json:"bytes,omitempty"`
+	Total       int64                   `json:"total,omitempty"`
+	Speed       float64                 `json:"speed,omitempty"` // Average bytes per second
+	Error       string                  `json:"error,omitempty"`
+	ExitCode    int                     `json:"exit_code,omitempty"`
+}
+
+// progressState tracks one transfer for throttling and speed.
+type progressState struct {
+	start time.Time
+	last  time.Time
+}
+
+var events = struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	progress map[string]*progressState
+}{
+	enc:      json.NewEncoder(os.Stdout),
+	progress: make(map[string]*progressState),
+}
+
+// emit writes e as a single JSON line. It does nothing outside --json mode.
+func emit(e event) {
+	if !jsonOutput {
+		return
+	}
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	_ = events.enc.Encode(e)
+}
+
+// emitProgress turns a ProgressInfo callback into a progress event, at most
+// once per progressInterval for each transfer, plus the final update.
+func emitProgress(info transfer.ProgressInfo) {
+	if !jsonOutput {
+		return
+	}
+	key := info.PeerAddr + "|" + info.FileName
+	now := time.Now()
+
+	events.mu.Lock()
+	st, ok := events.progress[key]
+	if !ok {
+		st = &progressState{start: now}
+		events.progress[key] = st
+	}
+	done := info.TotalBytes > 0 && info.BytesSent >= info.TotalBytes
+	if ok && !done && now.Sub(st.last) < progressInterval {
+		events.mu.Unlock()
+		return
+	}
+	st.last = now
+	if done {
+		delete(events.progress, key)
+	}
+	var speed float64
+	if elapsed := now.Sub(st.start).Seconds(); elapsed > 0 {
+		speed = float64(info.BytesSent) / elapsed
+	}
+	events.mu.Unlock()
+
+	emit(event{
+		Event:    eventProgress,
+		Peer:     info.PeerName,
+		PeerAddr: info.PeerAddr,
+		File:     info.FileName,
+		Bytes:    info.BytesSent,
+		Total:    info.TotalBytes,
+		Speed:    speed,
+	})
+}
+
+// senderEvents reports a sender's callbacks as events in --json mode.
+func senderEvents(opts transfer.SenderOptions) transfer.SenderOptions {
+	if !jsonOutput {
+		return opts
+	}
+
+	allowConn := opts.AllowConn
+	if allowConn != nil {
+		opts.AllowConn = func(addr string) bool {
+			emit(event{Event: eventConnected, PeerAddr: addr})
+			return allowConn(addr)
+		}
+	}
+	opts.OnListening = func(port int, fingerprint string) {
+		code := transfer.NewConnectCode(opts.Interfaces, port, fingerprint).String()
+		emit(event{Event: eventListening, Port: port, Fingerprint: fingerprint, Code: code, ShareCode: opts.Code})
+	}
+	opts.OnCodeAccepted = func(addr string) {
+		emit(event{Event: eventConnected, PeerAddr: addr})
+	}
+	opts.OnProgress = emitProgress
+	opts.OnComplete = func(peer string, fileName string) {
+		emit(event{Event: eventCompleted, Peer: peer, File: fileName})
+	}
+	opts.OnError = func(peer string, err error) {
+		emit(event{Event: eventError, Peer: peer, Error: err.Error()})
+	}
+	return opts
+}
+
+// receiverEvents reports a receiver's callbacks as events in --json mode.
+// Text snippets are reported in the completed event instead of being printed.
+func receiverEvents(opts transfer.ReceiverOptions, address string) transfer.ReceiverOptions {
+	if !jsonOutput {
+		return opts
+	}
+
+	var text *string
+	opts.OnTransferStart = func(net.Conn) {
+		emit(event{Event: eventConnected, Peer: opts.SenderName, PeerAddr: address})
+	}
+	opts.OnProgress = emitProgress
+	opts.OnVerified = func(fileName string) {
+		emit(event{Event: eventVerified, Peer: opts.SenderName, File: fileName})
+	}
+	opts.OnText = func(s string) {
+		text = &s
+	}
+	opts.OnComplete = func(fileName string) {
+		e := event{Event: eventCompleted, Peer: opts.SenderName, File: fileName, Text: text}
+		if text == nil && opts.Sink == nil {
+			e.Path = filepath.Join(opts.DownloadDir, fileName)
+		}
+		emit(e)
+	}
+	return opts
+}
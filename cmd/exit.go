@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/example/synapse/internal/transfer"
+)
+
+// Exit codes returned by the CLI, so scripts can tell failures apart.
+const (
+	ExitOK          = 0   // Transfer completed
+	ExitFailure     = 1   // Transfer or I/O failure
+	ExitUsage       = 2   // Invalid arguments or flags
+	ExitNoPeer      = 3   // No matching peer or inbox was found, or nobody connected in time
+	ExitRejected    = 4   // The other side declined or rejected the transfer
+	ExitInterrupted = 130 // Cancelled by the user or interrupted by a signal
+)
+
+var (
+	errNoPeer    = errors.New("no peers found")
+	errCancelled = errors.New("cancelled")
+)
+
+// exitError attaches an exit code to an error returned by a command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withCode returns err annotated with the exit code the CLI should use for it.
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// usageError reports invalid arguments with ExitUsage.
+func usageError(err error) error {
+	return withCode(ExitUsage, err)
+}
+
+// exitCode maps an error returned by a command to a process exit code.
+func exitCode(err error) int {
+	var ee *exitError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &ee):
+		return ee.code
+	case errors.Is(err, errNoPeer), errors.Is(err, transfer.ErrIdleTimeout):
+		return ExitNoPeer
+	case errors.Is(err, errCancelled):
+		return ExitInterrupted
+	case errors.Is(err, transfer.ErrOfferDeclined), errors.Is(err, transfer.ErrRejected):
+		return ExitRejected
+	default:
+		return ExitFailure
+	}
+}
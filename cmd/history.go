@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/transfer"
+	"github.com/example/synapse/pkg/ui"
+	"github.com/example/synapse/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyPeer      string
+	historyDirection string
+	historyStatus    string
+	historyLimit     int
+	historyCSV       bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show past transfers from the desktop app and the CLI",
+	Long: `Show past transfers from the desktop app and the CLI, newest first.
+
+With --json each entry is printed as one JSON object per line; --csv prints
+a CSV table with a header row.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch historyDirection {
+		case "", config.DirectionSend, config.DirectionReceive:
+		default:
+			return usageError(fmt.Errorf("invalid --direction %q: expected send or receive", historyDirection))
+		}
+		switch historyStatus {
+		case "", config.StatusCompleted, config.StatusFailed, config.StatusDeclined:
+		default:
+			return usageError(fmt.Errorf("invalid --status %q: expected completed, failed or declined", historyStatus))
+		}
+		if historyCSV && jsonOutput {
+			return usageError(fmt.Errorf("--csv can't be combined with --json"))
+		}
+
+		filter := config.HistoryFilter{
+			Peer:      historyPeer,
+			Direction: historyDirection,
+			Status:    historyStatus,
+			Limit:     historyLimit,
+		}
+		entries := filter.Filter(config.LoadHistory())
+		switch {
+		case jsonOutput:
+			enc := json.NewEncoder(os.Stdout)
+			for _, e := range entries {
+				if err := enc.Encode(e); err != nil {
+					return fmt.Errorf("failed to write history: %w", err)
+				}
+			}
+		case historyCSV:
+			return writeHistoryCSV(entries)
+		case len(entries) == 0:
+			ui.Info("No transfers recorded.")
+		default:
+			printHistory(entries)
+		}
+		return nil
+	},
+}
+
+func printHistory(entries []config.HistoryEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tDIRECTION\tSTATUS\tPEER\tFILE\tSIZE")
+	for _, e := range entries {
+		size := "-"
+		if e.FileSize > 0 {
+			size = utils.FormatBytes(e.FileSize)
+		}
+		name := e.FileName
+		if name == "" {
+			name = "-"
+		}
+		if e.Error != "" {
+			name += " (" + e.Error + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", formatTimestamp(e.Timestamp), e.Direction, e.Status, e.PeerName, name, size)
+	}
+	w.Flush()
+}
+
+func writeHistoryCSV(entries []config.HistoryEntry) error {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"id", "timestamp", "direction", "status", "peer_name", "file_name", "file_size", "files", "text", "error"})
+	for _, e := range entries {
+		_ = w.Write([]string{
+			e.ID,
+			e.Timestamp,
+			e.Direction,
+			e.Status,
+			e.PeerName,
+			e.FileName,
+			strconv.FormatInt(e.FileSize, 10),
+			strings.Join(e.Files, ";"),
+			e.Text,
+			e.Error,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// formatTimestamp shortens an RFC 3339 timestamp to local date and time.
+func formatTimestamp(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ts
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// recordHistory adds a CLI transfer to the history shared with the desktop
+// app. Failing to record it doesn't fail the transfer.
+func recordHistory(entry config.HistoryEntry) {
+	if err := config.AddHistoryEntry(entry); err != nil {
+		ui.Error("Failed to record transfer history: %v", err)
+	}
+}
+
+// senderHistory records each transfer a sender makes. label names the share
+// when a transfer fails before its name is known.
+func senderHistory(opts transfer.SenderOptions, label string, text string) transfer.SenderOptions {
+	onComplete, onError := opts.OnComplete, opts.OnError
+	opts.OnComplete = func(peer string, fileName string) {
+		if onComplete != nil {
+			onComplete(peer, fileName)
+		}
+		if text != "" {
+			fileName = label
+		}
+		recordHistory(config.HistoryEntry{
+			FileName:  fileName,
+			Text:      text,
+			Direction: config.DirectionSend,
+			PeerName:  peer,
+			Status:    config.StatusCompleted,
+		})
+	}
+	opts.OnError = func(peer string, err error) {
+		if onError != nil {
+			onError(peer, err)
+		}
+		recordHistory(config.HistoryEntry{
+			FileName:  label,
+			Direction: config.DirectionSend,
+			PeerName:  peer,
+			Status:    config.StatusFailed,
+			Error:     err.Error(),
+		})
+	}
+	return opts
+}
+
+// receiverHistory records each receive, with the files taken from a
+// multi-file share. ReceiveConnectWithOptions returns failures rather than
+// reporting them, so the caller passes them to the returned OnError. label
+// names what is shared when a receive fails before its name is known.
+func receiverHistory(opts transfer.ReceiverOptions, label string) transfer.ReceiverOptions {
+	var received string
+	var taken []string
+	var size int64
+	fileName := label
+	onReceiving, onText, onComplete, onError := opts.OnReceiving, opts.OnText, opts.OnComplete, opts.OnError
+	opts.OnReceiving = func(name string, n int64, files []string) {
+		fileName, size, taken = name, n, files
+		if onReceiving != nil {
+			onReceiving(name, n, files)
+		}
+	}
+	opts.OnText = func(text string) {
+		received = text
+		if onText != nil {
+			onText(text)
+		}
+	}
+	opts.OnComplete = func(fileName string) {
+		if onComplete != nil {
+			onComplete(fileName)
+		}
+		if received != "" {
+			fileName = "Text snippet"
+		}
+		recordHistory(config.HistoryEntry{
+			FileName:  fileName,
+			FileSize:  max(size, 0),
+			Files:     taken,
+			Text:      received,
+			Direction: config.DirectionReceive,
+			PeerName:  opts.SenderName,
+			Status:    config.StatusCompleted,
+		})
+	}
+	opts.OnError = func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+		recordHistory(config.HistoryEntry{
+			FileName:  fileName,
+			FileSize:  max(size, 0),
+			Files:     taken,
+			Direction: config.DirectionReceive,
+			PeerName:  opts.SenderName,
+			Status:    config.StatusFailed,
+			Error:     err.Error(),
+		})
+	}
+	return opts
+}
+
+func init() {
+	historyCmd.Flags().StringVar(&historyPeer, "peer", "", "Only show transfers with peers whose name contains this text")
+	historyCmd.Flags().StringVar(&historyDirection, "direction", "", "Only show transfers in this direction: send or receive")
+	historyCmd.Flags().StringVar(&historyStatus, "status", "", "Only show transfers with this status: completed, failed or declined")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 0, "Show at most this many transfers (0: all)")
+	historyCmd.Flags().BoolVar(&historyCSV, "csv", false, "Print the history as CSV")
+	rootCmd.AddCommand(historyCmd)
+}
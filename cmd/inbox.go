@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/transfer"
+	"github.com/example/synapse/pkg/ui"
+	"github.com/example/synapse/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var inboxYes bool
+
+var inboxCmd = &cobra.Command{
+	Use:   "inbox",
+	Short: "Run an always-on inbox that peers can push files to",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		port, portLast, err := listenPorts()
+		if err != nil {
+			return err
+		}
+		if err := useInterfaces(); err != nil {
+			return err
+		}
+		printBanner()
+
+		var promptMu sync.Mutex
+		stdin := bufio.NewReader(os.Stdin)
+		acceptOffer := func(addr string, offer transfer.Offer) bool {
+			promptMu.Lock()
+			defer promptMu.Unlock()
+
+			sender := offer.SenderName
+			if sender == "" {
+				sender = addr
+			}
+			ui.Info("%s wants to send you %d item(s), %s in total:", sender, len(offer.Files), utils.FormatBytes(offer.TotalSize))
+			for _, f := range offer.Files {
+				if f.IsDir {
+					ui.Printf("  %s/ (%s)\n", f.Name, utils.FormatBytes(f.Size))
+				} else {
+					ui.Printf("  %s (%s)\n", f.Name, utils.FormatBytes(f.Size))
+				}
+			}
+			if inboxYes {
+				ui.Info("Accepting offer from %s.", sender)
+				return true
+			}
+			ui.Info("Accept? (y/n): ")
+			response, err := stdin.ReadString('\n')
+			if err != nil && response == "" {
+				err = fmt.Errorf("declined offer from %s: failed to read an answer: %w; use --yes to accept offers without prompting", sender, err)
+				if jsonOutput {
+					emit(event{Event: eventError, Peer: sender, Error: err.Error()})
+				} else {
+					ui.Error("%v", err)
+				}
+				return false
+			}
+			return strings.ToLower(strings.TrimSpace(response)) == "y"
+		}
+
+		settings := config.LoadSettings()
+		opts := transfer.InboxOptions{
+			DownloadDir: settings.DownloadDir,
+			PeerName:    settings.DeviceName,
+			DeviceID:    deviceID(),
+			Certificate: deviceCertificate(),
+			AcceptOffer: acceptOffer,
+			Ctx:         cmd.Context(),
+			Interfaces:  listenInterfaces,
+			Port:        port,
+			PortLast:    portLast,
+		}
+		if jsonOutput {
+			opts.OnListening = func(port int, fingerprint string) {
+				emit(event{Event: eventListening, Port: port, Fingerprint: fingerprint})
+			}
+			opts.OnProgress = emitProgress
+			opts.OnComplete = func(sender string, fileName string) {
+				emit(event{Event: eventCompleted, Peer: sender, File: fileName, Path: filepath.Join(opts.DownloadDir, fileName)})
+			}
+			opts.OnError = func(sender string, err error) {
+				emit(event{Event: eventError, Peer: sender, Error: err.Error()})
+			}
+		}
+		onComplete, onError := opts.OnComplete, opts.OnError
+		opts.OnComplete = func(sender string, fileName string) {
+			if onComplete != nil {
+				onComplete(sender, fileName)
+			}
+			recordHistory(config.HistoryEntry{
+				FileName:  fileName,
+				Direction: config.DirectionReceive,
+				PeerName:  sender,
+				Status:    config.StatusCompleted,
+			})
+		}
+		opts.OnError = func(sender string, err error) {
+			if onError != nil {
+				onError(sender, err)
+			}
+			recordHistory(config.HistoryEntry{
+				Direction: config.DirectionReceive,
+				PeerName:  sender,
+				Status:    config.StatusFailed,
+				Error:     err.Error(),
+			})
+		}
+		if err := transfer.StartInbox(opts); err != nil {
+			return fmt.Errorf("error running inbox: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	inboxCmd.Flags().BoolVarP(&inboxYes, "yes", "y", false, "Accept every offer without prompting")
+	addInterfaceFlag(inboxCmd)
+	addPortFlag(inboxCmd)
+	rootCmd.AddCommand(inboxCmd)
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/netutil"
+	"github.com/spf13/cobra"
+)
+
+var (
+	interfaceNames []string
+
+	// listenInterfaces are the interfaces chosen by useInterfaces, for
+	// sharing and the inbox to listen on.
+	listenInterfaces []net.Interface
+)
+
+var interfacesCmd = &cobra.Command{
+	Use:   "interfaces",
+	Short: "List the network interfaces Synapse can use",
+	Long: `List the network interfaces Synapse can use.
+
+By default Synapse listens and announces on the interfaces marked as
+default, leaving out virtual and VPN adapters. Choose others with the
+interfaces setting ("synapse config set interfaces eth0,wlan0") or, for one
+command, with --interface.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		infos, err := netutil.List()
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			if err := json.NewEncoder(os.Stdout).Encode(infos); err != nil {
+				return fmt.Errorf("failed to write interfaces: %w", err)
+			}
+			return nil
+		}
+
+		selected := config.LoadSettings().Interfaces
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tUSED\tADDRESSES")
+		for _, info := range infos {
+			used := "no"
+			switch {
+			case len(selected) > 0 && slices.Contains(selected, info.Name):
+				used = "yes (setting)"
+			case len(selected) == 0 && info.Default:
+				used = "yes"
+			case info.Virtual:
+				used = "no (virtual)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", info.Name, used, dash(strings.Join(info.Addresses, ",")))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(interfacesCmd)
+}
+
+// addInterfaceFlag adds --interface to a command that uses the network.
+func addInterfaceFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&interfaceNames, "interface", nil, "Network interface to use, repeatable (default: the interfaces setting, or every physical interface)")
+}
+
+// useInterfaces limits discovery to the interfaces chosen with --interface
+// or the interfaces setting, and keeps them for listening.
+func useInterfaces() error {
+	names := interfaceNames
+	if len(names) == 0 {
+		names = config.LoadSettings().Interfaces
+	}
+	ifaces, err := netutil.Interfaces(names)
+	if err != nil {
+		if len(interfaceNames) > 0 {
+			return usageError(err)
+		}
+		return fmt.Errorf("%w; check the interfaces setting", err)
+	}
+	discovery.SetInterfaces(ifaces)
+	listenInterfaces = ifaces
+	return nil
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
+	"github.com/example/synapse/pkg/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	peersWait  time.Duration
+	peersWatch bool
+)
+
+var peersCmd = &cobra.Command{
+	Use:   "peers",
+	Short: "List Synapse senders on the local network",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := useInterfaces(); err != nil {
+			return err
+		}
+		useAddressBook()
+		if peersWatch {
+			return watchPeers(cmd.Context())
+		}
+
+		peers, err := listPeers(cmd.Context(), peersWait)
+		if err != nil {
+			return err
+		}
+		if len(peers) == 0 {
+			return errNoPeer
+		}
+
+		if jsonOutput {
+			for _, p := range peers {
+				emit(peerEvent(eventPeer, p))
+			}
+			return nil
+		}
+		printPeers(peers)
+		return nil
+	},
+}
+
+// listPeers browses for wait and returns the peers found, sorted by name.
+func listPeers(ctx context.Context, wait time.Duration) ([]discovery.Peer, error) {
+	browseCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	found := make(chan discovery.Peer)
+	errc := make(chan error, 1)
+	go func() { errc <- discovery.Browse(browseCtx, found) }()
+
+	var peers []discovery.Peer
+	for peer := range found {
+		peers = append(peers, peer)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := <-errc; err != nil {
+		return nil, fmt.Errorf("failed to browse for peers: %w", err)
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Label() < peers[j].Label() })
+	return peers, nil
+}
+
+var peerEventNames = map[discovery.PeerEventType]string{
+	discovery.PeerAdded:   eventPeerAdded,
+	discovery.PeerUpdated: eventPeerUpdated,
+	discovery.PeerRemoved: eventPeerRemoved,
+}
+
+// watchPeers streams peers appearing, changing and disappearing until the
+// command is interrupted.
+func watchPeers(ctx context.Context) error {
+	if !jsonOutput {
+		ui.Info("Watching for peers, press Ctrl+C to stop...")
+	}
+
+	changes := make(chan discovery.PeerEvent)
+	errc := make(chan error, 1)
+	go func() { errc <- discovery.Watch(ctx, changes) }()
+
+	for change := range changes {
+		p := change.Peer
+		if jsonOutput {
+			emit(peerEvent(peerEventNames[change.Type], p))
+			continue
+		}
+		switch change.Type {
+		case discovery.PeerAdded:
+			ui.Success("+ %s  %s  %s  port %d  %s", p.Label(), formatShare(p), formatAddresses(p), p.Port, shortFingerprint(p.Fingerprint))
+		case discovery.PeerUpdated:
+			ui.Info("~ %s  %s  %s  port %d  %s", p.Label(), formatShare(p), formatAddresses(p), p.Port, shortFingerprint(p.Fingerprint))
+		case discovery.PeerRemoved:
+			ui.Error("- %s", p.Label())
+		}
+	}
+	if err := <-errc; err != nil {
+		return fmt.Errorf("failed to browse for peers: %w", err)
+	}
+	return ctx.Err()
+}
+
+// printPeers writes peers as a table.
+func printPeers(peers []discovery.Peer) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tOS\tSHARE\tADDRESSES\tPORT\tFINGERPRINT\tTXT")
+	for _, p := range peers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", p.Label(), dash(p.OS), formatShare(p), formatAddresses(p), p.Port, shortFingerprint(p.Fingerprint), formatTXT(p.Text))
+	}
+	w.Flush()
+}
+
+func peerEvent(name string, p discovery.Peer) event {
+	return event{
+		Event:       name,
+		Peer:        p.Label(),
+		DeviceID:    p.ID,
+		Hostname:    p.HostName,
+		Addresses:   addressStrings(p),
+		Port:        p.Port,
+		Fingerprint: p.Fingerprint,
+		OS:          p.OS,
+		Share:       p.Share,
+		Saved:       p.Saved,
+		TXT:         p.Text,
+	}
+}
+
+func addressStrings(p discovery.Peer) []string {
+	var addrs []string
+	for _, ip := range p.Addresses() {
+		addrs = append(addrs, ip.String())
+	}
+	return addrs
+}
+
+func formatAddresses(p discovery.Peer) string {
+	addrs := addressStrings(p)
+	if len(addrs) == 0 {
+		return "-"
+	}
+	return strings.Join(addrs, ",")
+}
+
+// shortFingerprint shortens a fingerprint to the prefix that --from accepts.
+func shortFingerprint(fp string) string {
+	if fp == "" {
+		return "-"
+	}
+	if len(fp) > transfer.MinFingerprintPrefix {
+		return fp[:transfer.MinFingerprintPrefix]
+	}
+	return fp
+}
+
+// formatShare describes what the peer shares, if it says, or that it comes
+// from the address book.
+func formatShare(p discovery.Peer) string {
+	if p.Share == nil {
+		if p.Saved {
+			return "(address book)"
+		}
+		return "-"
+	}
+	return p.Share.String()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// shownTXT lists the TXT keys that have their own columns.
+var shownTXT = []string{"fp", "id", "name", "os", "kind", "files", "size", "file"}
+
+// formatTXT renders the remaining TXT metadata as sorted key=value pairs.
+func formatTXT(text map[string]string) string {
+	var fields []string
+	for k, v := range text {
+		if slices.Contains(shownTXT, k) {
+			continue
+		}
+		fields = append(fields, k+"="+v)
+	}
+	if len(fields) == 0 {
+		return "-"
+	}
+	slices.Sort(fields)
+	return strings.Join(fields, " ")
+}
+
+func init() {
+	peersCmd.Flags().DurationVar(&peersWait, "wait", 3*time.Second, "How long to browse before listing peers")
+	peersCmd.Flags().BoolVar(&peersWatch, "watch", false, "Keep browsing and report peers as they appear and disappear")
+	addInterfaceFlag(peersCmd)
+	rootCmd.AddCommand(peersCmd)
+}
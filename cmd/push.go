@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
+	"github.com/example/synapse/pkg/ui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var pushTo string
+
+var pushCmd = &cobra.Command{
+	Use:   "push [file/directory]...",
+	Short: "Push files to a peer's inbox on the local network",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := useInterfaces(); err != nil {
+			return err
+		}
+		useAddressBook()
+		printBanner()
+		for _, path := range args {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				return usageError(fmt.Errorf("file or directory '%s' does not exist", path))
+			}
+		}
+
+		ui.Info("Looking for inboxes...")
+		inboxes, err := scanInboxes(cmd.Context(), 2*time.Second)
+		if err != nil {
+			return err
+		}
+		if len(inboxes) == 0 {
+			return fmt.Errorf("no inboxes found: %w", errNoPeer)
+		}
+
+		peer, err := pickInbox(inboxes, pushTo)
+		if err != nil {
+			return err
+		}
+		addrs := peer.HostPorts()
+		if len(addrs) == 0 {
+			return fmt.Errorf("inbox has no address")
+		}
+		targetName := peer.Label()
+
+		opts := senderEvents(transfer.SenderOptions{
+			Name:        config.LoadSettings().DeviceName,
+			Ctx:         cmd.Context(),
+			Addresses:   addrs[1:],
+			Fingerprint: peer.Fingerprint,
+		})
+		onComplete := opts.OnComplete
+		opts.OnComplete = func(peer string, fileName string) {
+			if onComplete != nil {
+				onComplete(peer, fileName)
+			}
+			recordHistory(config.HistoryEntry{
+				FileName:  fileName,
+				Direction: config.DirectionSend,
+				PeerName:  targetName,
+				Status:    config.StatusCompleted,
+			})
+		}
+		if err := transfer.PushToInbox(addrs[0], args, opts); err != nil {
+			status := config.StatusFailed
+			if errors.Is(err, transfer.ErrOfferDeclined) {
+				status = config.StatusDeclined
+			}
+			recordHistory(config.HistoryEntry{
+				FileName:  transfer.ShareName(args),
+				Direction: config.DirectionSend,
+				PeerName:  targetName,
+				Status:    status,
+				Error:     err.Error(),
+			})
+			return fmt.Errorf("error pushing data: %w", err)
+		}
+		return nil
+	},
+}
+
+// scanInboxes returns the inboxes found on the network within wait, or
+// ctx's error if it is cancelled first.
+func scanInboxes(ctx context.Context, wait time.Duration) ([]discovery.Peer, error) {
+	browseCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	found := make(chan discovery.Peer)
+	errc := make(chan error, 1)
+	go func() { errc <- discovery.BrowseInboxes(browseCtx, found) }()
+
+	var inboxes []discovery.Peer
+	for peer := range found {
+		inboxes = append(inboxes, peer)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := <-errc; err != nil {
+		return nil, fmt.Errorf("failed to browse for inboxes: %w", err)
+	}
+	return inboxes, nil
+}
+
+// pickInbox returns the inbox whose instance name matches name, or asks the
+// user to choose one when no name was given. Without a terminal to ask on,
+// or with --json, several inboxes need --to.
+func pickInbox(inboxes []discovery.Peer, name string) (discovery.Peer, error) {
+	if name != "" {
+		for _, peer := range inboxes {
+			if peer.Matches(name) {
+				return peer, nil
+			}
+		}
+		return discovery.Peer{}, fmt.Errorf("no inbox named '%s' found: %w", name, errNoPeer)
+	}
+
+	if len(inboxes) == 1 {
+		return inboxes[0], nil
+	}
+
+	if jsonOutput || !term.IsTerminal(int(os.Stdin.Fd())) {
+		names := make([]string, len(inboxes))
+		for i, peer := range inboxes {
+			names[i] = peer.Label()
+		}
+		return discovery.Peer{}, usageError(fmt.Errorf("several inboxes found (%s); choose one with --to", strings.Join(names, ", ")))
+	}
+	for i, peer := range inboxes {
+		ui.Printf("  [%d] %s\n", i+1, peer.Label())
+	}
+	ui.Info("Choose an inbox (1-%d): ", len(inboxes))
+	var response string
+	fmt.Scanln(&response)
+	choice, err := strconv.Atoi(strings.TrimSpace(response))
+	if err != nil || choice < 1 || choice > len(inboxes) {
+		return discovery.Peer{}, usageError(fmt.Errorf("invalid choice"))
+	}
+	return inboxes[choice-1], nil
+}
+
+func init() {
+	pushCmd.Flags().StringVar(&pushTo, "to", "", "Name of the inbox to push to")
+	addInterfaceFlag(pushCmd)
+	rootCmd.AddCommand(pushCmd)
+}
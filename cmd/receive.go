@@ -1,59 +1,457 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/atotto/clipboard"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/discovery"
 	"github.com/example/synapse/internal/transfer"
 	localUI "github.com/example/synapse/internal/ui"
 	"github.com/example/synapse/pkg/ui"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var receiveCmd = &cobra.Command{
-	Use:   "receive",
+	Use:   "receive [share code | host:port | connection code]",
 	Short: "Receive a file from a peer on the local network",
-	Run: func(cmd *cobra.Command, args []string) {
-		ui.PrintBanner()
+	Long: `Receive a file from a peer on the local network.
 
-		model := localUI.NewReceiverModel()
-		p := tea.NewProgram(model)
+Without flags, an interactive picker lists the peers that are sharing and
+the download runs inside it, with a way back to the list for another one.
+Use --from or --addr to pick the peer from a script. When stdout is not a
+terminal, receive never prompts: it connects to the peer given by --from or
+--addr, or to the only peer on the network.
 
-		// Run the TUI
-		finalModel, err := p.Run()
-		if err != nil {
-			ui.Error("Error running TUI: %v", err)
-			os.Exit(1)
+Every share shows a share code such as 7-tiger-lamp-ocean. Pass it as the
+argument or with --code to find that share and download without waiting
+for approval; the sender has to prove it knows the code too.
+
+On networks that block discovery, pass the connection code the sender
+shows (synapse://...), or its host:port, as the argument or with --addr.
+The code carries the sender's certificate fingerprint, which is checked.
+Senders that always listen at the same address can be saved in the address
+book instead (see synapse book) and picked by name with --from.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			// Addresses and connection codes have a colon; share codes don't.
+			target := &receiveCode
+			if strings.Contains(args[0], ":") {
+				target = &receiveAddr
+			}
+			if *target != "" {
+				return usageError(fmt.Errorf("give the address or code either as an argument or with a flag"))
+			}
+			*target = args[0]
+		}
+		if receiveCode != "" {
+			code, err := transfer.ParseShareCode(receiveCode)
+			if err != nil {
+				return usageError(err)
+			}
+			receiveCode = code
+		}
+		if receiveStdout {
+			if cmd.Flags().Changed("to") {
+				return usageError(fmt.Errorf("--to can't be combined with --stdout"))
+			}
+			if jsonOutput {
+				return usageError(fmt.Errorf("--json can't be combined with --stdout"))
+			}
+			// stdout carries the received data, so keep everything else off it
+			ui.SetOutput(os.Stderr)
+		}
+		if receiveTo == "" {
+			receiveTo = config.LoadSettings().DownloadDir
 		}
 
-		// Check if a peer was selected
-		m, ok := finalModel.(localUI.Model)
-		if !ok {
-			ui.Error("Internal error: invalid model")
-			os.Exit(1)
+		interactive := isInteractive()
+		if receiveSelect && !interactive {
+			return usageError(fmt.Errorf("--select needs a terminal; use --include instead"))
 		}
 
-		peer := m.GetSelectedPeer()
-		if peer == nil {
-			// User quit or error occurred
-			os.Exit(0)
+		if err := useInterfaces(); err != nil {
+			return err
 		}
+		useAddressBook()
+		printBanner()
 
-		// Start transfer
-		if len(peer.AddrIPv4) == 0 {
-			ui.Error("Peer has no IPv4 address")
-			os.Exit(1)
+		if interactive && receiveFrom == "" && receiveAddr == "" && receiveCode == "" {
+			return receiveInTUI()
 		}
 
-		address := fmt.Sprintf("%s:%d", peer.AddrIPv4[0], peer.Port)
-		if err := transfer.ReceiveConnect(address); err != nil {
-			ui.Error("Error receiving data: %v", err)
-			os.Exit(1)
+		target, err := resolveSender(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		opts := transfer.ReceiverOptions{
+			SelectEntries: selectEntries,
+			OnText:        showText,
+			Code:          receiveCode,
+		}
+		if err := receive(target, opts); err != nil {
+			return fmt.Errorf("error receiving data: %w", err)
 		}
+		return nil
 	},
 }
 
+// receive downloads from target into the destination chosen by the flags,
+// with the callbacks in opts, and records the outcome in the history.
+func receive(target sender, opts transfer.ReceiverOptions) error {
+	opts.DownloadDir = receiveTo
+	opts.PeerName = config.LoadSettings().DeviceName
+	opts.SenderName = target.name
+	opts.Fingerprint = target.fingerprint
+	opts.Addresses = target.others
+	if receiveStdout {
+		opts.Sink = os.Stdout
+	}
+	opts = receiverHistory(receiverEvents(opts, target.address), target.share)
+	if err := transfer.ReceiveConnectWithOptions(target.address, opts); err != nil {
+		opts.OnError(err)
+		return err
+	}
+	return nil
+}
+
+// receiveInTUI runs the peer picker and the downloads from the picked peers
+// inside the TUI, until the user quits.
+func receiveInTUI() error {
+	cfg := localUI.TransferConfig{
+		Select:      receiveSelect,
+		Destination: receiveTo,
+		Receive: func(peer discovery.Peer, opts transfer.ReceiverOptions) error {
+			target, err := senderFromPeer(peer)
+			if err != nil {
+				return err
+			}
+			return receive(target, copyingText(opts))
+		},
+		Connect: func(code transfer.ConnectCode, opts transfer.ReceiverOptions) error {
+			target, err := senderFromCode(code, "")
+			if err != nil {
+				return err
+			}
+			return receive(target, copyingText(opts))
+		},
+	}
+	if len(receiveInclude) > 0 {
+		cfg.Filter = selectEntries
+	}
+	if receiveStdout {
+		cfg.Destination = ""
+	}
+
+	// The TUI owns the terminal, so keep the transfer's log lines off it.
+	ui.SetOutput(io.Discard)
+	finalModel, err := tea.NewProgram(localUI.NewReceiverModel().WithTransfers(cfg), teaOptions()...).Run()
+	if receiveStdout {
+		ui.SetOutput(os.Stderr)
+	} else {
+		ui.SetOutput(os.Stdout)
+	}
+	if err != nil {
+		return fmt.Errorf("error running TUI: %w", err)
+	}
+	m, ok := finalModel.(localUI.Model)
+	if !ok {
+		return fmt.Errorf("internal error: invalid model")
+	}
+
+	if err := m.Err(); err != nil {
+		if errors.Is(err, localUI.ErrTransferCancelled) {
+			return fmt.Errorf("download %w", errCancelled)
+		}
+		return fmt.Errorf("error receiving data: %w", err)
+	}
+	switch {
+	case m.Completed() > 0:
+		return nil
+	case m.NoPeers():
+		return errNoPeer
+	}
+	return errCancelled
+}
+
+// copyingText makes opts also copy received text to the clipboard when
+// --copy is set.
+func copyingText(opts transfer.ReceiverOptions) transfer.ReceiverOptions {
+	if receiveCopy {
+		onText := opts.OnText
+		opts.OnText = func(text string) {
+			onText(text)
+			copyText(text)
+		}
+	}
+	return opts
+}
+
+var (
+	receiveFrom    string
+	receiveAddr    string
+	receiveCode    string
+	receiveTo      string
+	receiveWait    int
+	receiveInclude []string
+	receiveSelect  bool
+	receiveCopy    bool
+	receiveStdout  bool
+)
+
+// sender is the peer a receive connects to.
+type sender struct {
+	address     string
+	others      []string // Further addresses of the sender, tried along with address
+	name        string
+	fingerprint string // Certificate fingerprint (or prefix) to pin, if known
+	share       string // Name of what the peer shares, if discovery says
+}
+
+// isInteractive reports whether receive may show the TUI. The TUI is drawn
+// on stderr in --stdout mode, so that is the stream that has to be a terminal,
+// and it never runs in --json mode.
+func isInteractive() bool {
+	if jsonOutput {
+		return false
+	}
+	out := os.Stdout
+	if receiveStdout {
+		out = os.Stderr
+	}
+	return term.IsTerminal(int(out.Fd()))
+}
+
+// resolveSender works out which peer to receive from: the address or
+// connection code given by --addr, the share with the --code, the peer
+// matching --from, or the only peer on the network.
+func resolveSender(ctx context.Context) (sender, error) {
+	if receiveAddr != "" {
+		code, err := transfer.ParseConnectCode(receiveAddr)
+		if err != nil {
+			return sender{}, usageError(fmt.Errorf("invalid --addr: %w", err))
+		}
+		if receiveFrom != "" && !transfer.IsFingerprint(receiveFrom) {
+			return sender{}, usageError(fmt.Errorf("with --addr, --from must be a certificate fingerprint (at least %d hex digits)", transfer.MinFingerprintPrefix))
+		}
+		return senderFromCode(code, receiveFrom)
+	}
+
+	if receiveCode != "" {
+		if receiveFrom != "" {
+			return sender{}, usageError(fmt.Errorf("--from can't be combined with a share code, which picks the share itself"))
+		}
+		peer, err := findSenderByCode(ctx, receiveCode, time.Duration(receiveWait)*time.Second)
+		if err != nil {
+			return sender{}, err
+		}
+		return senderFromPeer(peer)
+	}
+
+	peer, err := findSender(ctx, receiveFrom, time.Duration(receiveWait)*time.Second)
+	if err != nil {
+		return sender{}, err
+	}
+	return senderFromPeer(peer)
+}
+
+// senderFromCode returns the sender a connection code points to, pinned to
+// the fingerprint in the code, or to from if given.
+func senderFromCode(code transfer.ConnectCode, from string) (sender, error) {
+	fingerprint := code.Fingerprint
+	if from != "" {
+		if fingerprint != "" && !transfer.MatchFingerprint(fingerprint, from) {
+			return sender{}, usageError(fmt.Errorf("--from doesn't match the fingerprint in the connection code"))
+		}
+		if fingerprint == "" {
+			fingerprint = from
+		}
+	}
+	return sender{
+		address:     code.Addresses[0],
+		others:      code.Addresses[1:],
+		name:        code.Addresses[0],
+		fingerprint: fingerprint,
+	}, nil
+}
+
+func senderFromPeer(peer discovery.Peer) (sender, error) {
+	addrs := peer.HostPorts()
+	if len(addrs) == 0 {
+		return sender{}, fmt.Errorf("peer %s has no address", peer.Label())
+	}
+	s := sender{
+		address:     addrs[0],
+		others:      addrs[1:],
+		name:        peer.Label(),
+		fingerprint: peer.Fingerprint,
+	}
+	if peer.Share != nil {
+		s.share = peer.Share.Name
+	}
+	return s, nil
+}
+
+// findSender browses for up to wait and returns the peer whose certificate
+// fingerprint or device name matches from. Without from, or when several
+// peers share the name, it returns the only candidate and fails if there
+// are several.
+func findSender(ctx context.Context, from string, wait time.Duration) (discovery.Peer, error) {
+	if from != "" {
+		ui.Info("Looking for %s...", from)
+	} else {
+		ui.Info("Looking for peers...")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	peers := make(chan discovery.Peer)
+	go func() {
+		_ = discovery.Browse(ctx, peers)
+	}()
+
+	var found []discovery.Peer
+	var settle <-chan time.Time
+	for {
+		select {
+		case peer, ok := <-peers:
+			if !ok {
+				return pickSender(found, from, wait)
+			}
+			if from != "" && transfer.MatchFingerprint(peer.Fingerprint, from) {
+				return peer, nil
+			}
+			if from == "" || peer.Matches(from) {
+				found = append(found, peer)
+				// Give other peers a moment to answer, to catch ambiguity.
+				// Names aren't unique: one device can run several shares.
+				if settle == nil {
+					settle = time.After(time.Second)
+				}
+			}
+		case <-settle:
+			return pickSender(found, from, wait)
+		}
+	}
+}
+
+// findSenderByCode browses for up to wait and returns the share that
+// announces code.
+func findSenderByCode(ctx context.Context, code string, wait time.Duration) (discovery.Peer, error) {
+	ui.Info("Looking for the share with code %s...", code)
+	codes := transfer.NewCodeMatcher(code)
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	peers := make(chan discovery.Peer)
+	go func() {
+		_ = discovery.Browse(ctx, peers)
+	}()
+	for peer := range peers {
+		if codes.Matches(peer.CodeTag, peer.Fingerprint) {
+			return peer, nil
+		}
+	}
+	return discovery.Peer{}, fmt.Errorf("no share with code %s found within %s: %w", code, wait, errNoPeer)
+}
+
+func pickSender(found []discovery.Peer, from string, wait time.Duration) (discovery.Peer, error) {
+	switch {
+	case len(found) == 0 && from != "":
+		return discovery.Peer{}, fmt.Errorf("no peer matching '%s' found within %s: %w", from, wait, errNoPeer)
+	case len(found) == 0:
+		return discovery.Peer{}, fmt.Errorf("%w within %s", errNoPeer, wait)
+	case len(found) > 1:
+		names := make([]string, len(found))
+		for i, peer := range found {
+			names[i] = fmt.Sprintf("%s %s port %d", peer.Label(), shortFingerprint(peer.Fingerprint), peer.Port)
+		}
+		if from != "" {
+			return discovery.Peer{}, usageError(fmt.Errorf("several peers named '%s' found (%s); choose one by fingerprint with --from, or by address with --addr", from, strings.Join(names, ", ")))
+		}
+		return discovery.Peer{}, usageError(fmt.Errorf("several peers found (%s); choose one with --from", strings.Join(names, ", ")))
+	}
+	return found[0], nil
+}
+
+// teaOptions keeps the TUI off stdout when it carries received data.
+func teaOptions() []tea.ProgramOption {
+	if receiveStdout {
+		return []tea.ProgramOption{tea.WithOutput(os.Stderr)}
+	}
+	return nil
+}
+
+// showText prints a received snippet and optionally copies it to the clipboard.
+func showText(text string) {
+	ui.Success("Received text:")
+	fmt.Println(text)
+
+	if receiveCopy {
+		copyText(text)
+	}
+}
+
+// copyText puts a received snippet on the clipboard.
+func copyText(text string) {
+	if err := clipboard.WriteAll(text); err != nil {
+		ui.Error("Failed to copy to clipboard: %v", err)
+		return
+	}
+	ui.Info("Copied to clipboard.")
+}
+
+// selectEntries picks the files to download from a multi-file share, either
+// from the --include globs or interactively with --select.
+func selectEntries(entries []transfer.ShareEntry) ([]string, error) {
+	if len(receiveInclude) > 0 {
+		selected, err := transfer.MatchEntries(entries, receiveInclude)
+		if err != nil {
+			return nil, err
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("no files in the share match %s", strings.Join(receiveInclude, ", "))
+		}
+		return selected, nil
+	}
+
+	if !receiveSelect {
+		return nil, nil
+	}
+
+	finalModel, err := tea.NewProgram(localUI.NewSelectionModel(entries), teaOptions()...).Run()
+	if err != nil {
+		return nil, fmt.Errorf("error running file picker: %w", err)
+	}
+	selected, ok := finalModel.(localUI.SelectionModel).Selected()
+	if !ok {
+		return nil, fmt.Errorf("download %w", errCancelled)
+	}
+	return selected, nil
+}
+
 func init() {
+	receiveCmd.Flags().StringVar(&receiveFrom, "from", "", "Receive from the peer with this name or certificate fingerprint")
+	receiveCmd.Flags().StringVar(&receiveCode, "code", "", "Receive from the share with this share code, without waiting for approval")
+	receiveCmd.Flags().StringVar(&receiveAddr, "addr", "", "Connect directly to host:port, or to a sender's connection code, instead of discovering peers")
+	receiveCmd.Flags().StringVar(&receiveTo, "to", "", "Directory to save received files in (default: the download_dir setting)")
+	receiveCmd.Flags().IntVar(&receiveWait, "wait", 5, "Seconds to wait for the peer to appear when not using the picker")
+	receiveCmd.Flags().StringArrayVar(&receiveInclude, "include", nil, "Only download files of a shared folder matching this glob (repeatable)")
+	receiveCmd.Flags().BoolVar(&receiveSelect, "select", false, "Choose which files of a shared folder to download")
+	receiveCmd.Flags().BoolVar(&receiveCopy, "copy", false, "Copy received text snippets to the clipboard")
+	receiveCmd.Flags().BoolVar(&receiveStdout, "stdout", false, "Write the received data to stdout instead of a file")
+	addInterfaceFlag(receiveCmd)
 	rootCmd.AddCommand(receiveCmd)
 }
@@ -1,9 +1,12 @@
 package cmd
 
 import (
-	"fmt"
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/example/synapse/pkg/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -11,11 +14,53 @@ var rootCmd = &cobra.Command{
 	Use:   "synapse",
 	Short: "Synapse is a peer-to-peer file transfer tool for LAN",
 	Long:  `Synapse is a tool that allows you to transfer files between devices on the same local network without manual IP entry.`,
+
+	// Errors are reported once by Execute, with a matching exit code.
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		started = true
+		if jsonOutput {
+			// stdout is reserved for events
+			ui.SetOutput(os.Stderr)
+		}
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Emit newline-delimited JSON events on stdout")
 }
 
+// printBanner shows the banner, except in --json mode.
+func printBanner() {
+	if !jsonOutput {
+		ui.PrintBanner()
+	}
+}
+
+// started is set once argument and flag validation has passed, so errors
+// returned before that are reported as usage errors.
+var started bool
+
+// Execute runs the CLI and exits with one of the Exit* codes.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if ctx.Err() != nil {
+		ui.Info("Interrupted.")
+		emit(event{Event: eventError, Error: "interrupted", ExitCode: ExitInterrupted})
+		os.Exit(ExitInterrupted)
+	}
+	if err != nil && !started {
+		err = usageError(err)
+	}
+	code := exitCode(err)
+	if err != nil {
+		ui.Error("%v", err)
+		emit(event{Event: eventError, Error: err.Error(), ExitCode: code})
 	}
+	os.Exit(code)
 }
@@ -1,44 +1,279 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/example/synapse/internal/config"
 	"github.com/example/synapse/internal/transfer"
+	localUI "github.com/example/synapse/internal/ui"
 	"github.com/example/synapse/pkg/ui"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	sendText         string
+	sendYes          bool
+	sendName         string
+	sendOnce         bool
+	sendMaxReceivers int
+	sendTimeout      time.Duration
+	sendQR           bool
+	sendCode         string
 )
 
 var sendCmd = &cobra.Command{
-	Use:   "send [file/directory]",
-	Short: "Send a file or directory to a peer on the local network",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		ui.PrintBanner()
-		filePath := args[0]
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			ui.Error("File or directory '%s' does not exist", filePath)
-			os.Exit(1)
-		}
-
-		ui.Info("Preparing to send '%s'...", filePath)
-		
-		allowConn := func(addr string) bool {
-			ui.Info("Incoming connection from %s. Accept? (y/n): ", addr)
-			var response string
-			fmt.Scanln(&response)
-			return strings.ToLower(strings.TrimSpace(response)) == "y"
-		}
-
-		// Pass nil for portChan
-		if err := transfer.StartSender([]string{filePath}, allowConn, nil); err != nil {
-			ui.Error("Error sending data: %v", err)
-			os.Exit(1)
+	Use:   "send [file/directory]... | -",
+	Short: "Send files, directories or a text snippet to peers on the local network",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("text") {
+			return cobra.NoArgs(cmd, args)
+		}
+		if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		for _, arg := range args {
+			if arg == "-" && len(args) > 1 {
+				return fmt.Errorf("'-' (stdin) can't be combined with other paths")
+			}
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if sendMaxReceivers < 0 {
+			return usageError(fmt.Errorf("--max-receivers must not be negative"))
+		}
+		if _, _, err := listenPorts(); err != nil {
+			return err
+		}
+		if sendCode == "" {
+			sendCode = transfer.NewShareCode()
+		} else {
+			code, err := transfer.ParseShareCode(sendCode)
+			if err != nil {
+				return usageError(fmt.Errorf("invalid --code: %w", err))
+			}
+			sendCode = code
+		}
+		if err := useInterfaces(); err != nil {
+			return err
+		}
+		if !cmd.Flags().Changed("text") && args[0] == "-" {
+			printBanner()
+			return sendStdin(cmd.Context())
+		}
+
+		if !cmd.Flags().Changed("text") {
+			for _, path := range args {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					return usageError(fmt.Errorf("file or directory '%s' does not exist", path))
+				}
+			}
+		}
+
+		share := describeShare(cmd, args)
+		if showDashboard() {
+			return sendWithDashboard(cmd.Context(), share)
 		}
+
+		printBanner()
+		if cmd.Flags().Changed("text") {
+			ui.Info("Preparing to send a text snippet (%d bytes)...", len(sendText))
+		} else if len(args) == 1 {
+			ui.Info("Preparing to send '%s'...", args[0])
+		} else {
+			ui.Info("Preparing to send %d items...", len(args))
+		}
+
+		opts := senderOptions(cmd.Context(), promptFrom(os.Stdin))
+		if err := share.Share(opts); err != nil {
+			return fmt.Errorf("error sending data: %w", err)
+		}
+		return nil
 	},
 }
 
+// describeShare sets up the text or files to send, recording transfers in
+// the history.
+func describeShare(cmd *cobra.Command, args []string) localUI.ShareConfig {
+	if cmd.Flags().Changed("text") {
+		return localUI.ShareConfig{
+			Title: "a text snippet",
+			Size:  int64(len(sendText)),
+			Share: func(opts transfer.SenderOptions) error {
+				return transfer.StartTextSender(sendText, senderHistory(opts, "Text snippet", sendText))
+			},
+		}
+	}
+
+	share := localUI.ShareConfig{
+		Title: fmt.Sprintf("%d items", len(args)),
+		Items: args,
+		Size:  shareSize(args),
+		Share: func(opts transfer.SenderOptions) error {
+			return transfer.StartSenderWithOptions(args, senderHistory(opts, transfer.ShareName(args), ""))
+		},
+	}
+	if len(args) == 1 {
+		share.Title = filepath.Base(args[0])
+		share.Items = nil
+	}
+	return share
+}
+
+// showDashboard reports whether send runs the interactive dashboard, which
+// needs a terminal for both its output and the approve/deny keys.
+func showDashboard() bool {
+	return !jsonOutput && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// sendWithDashboard runs the share inside the sender dashboard until the
+// user stops it or a limit set by the flags is reached.
+func sendWithDashboard(ctx context.Context, share localUI.ShareConfig) error {
+	share.AutoAccept = sendYes
+	share.Interfaces = listenInterfaces
+	share.Code = sendCode
+	start := share.Share
+	share.Share = func(opts transfer.SenderOptions) error {
+		return start(withShareFlags(opts))
+	}
+
+	// The dashboard owns the terminal, so keep the sender's log lines off it.
+	ui.SetOutput(io.Discard)
+	finalModel, err := tea.NewProgram(localUI.NewSenderModel(share), tea.WithContext(ctx)).Run()
+	ui.SetOutput(os.Stdout)
+	if err != nil {
+		return fmt.Errorf("error running TUI: %w", err)
+	}
+	if err := finalModel.(localUI.SenderModel).Err(); err != nil {
+		return fmt.Errorf("error sending data: %w", err)
+	}
+	return nil
+}
+
+// senderOptions builds the sender configuration from the command's flags.
+// Connections are approved by allowConn unless --yes was given.
+func senderOptions(ctx context.Context, allowConn func(string) bool) transfer.SenderOptions {
+	opts := transfer.SenderOptions{
+		AllowConn: allowConn,
+		Ctx:       ctx,
+	}
+	if sendYes {
+		opts.AllowConn = func(addr string) bool {
+			ui.Info("Accepting connection from %s.", addr)
+			return true
+		}
+	}
+	opts = withShareFlags(opts)
+	if sendQR {
+		opts.OnListening = func(port int, fingerprint string) {
+			showQR(transfer.NewConnectCode(opts.Interfaces, port, fingerprint).String())
+		}
+	}
+	return senderEvents(opts)
+}
+
+// showQR prints code as a QR code on the status output.
+func showQR(code string) {
+	qr, err := ui.QR(code)
+	if err != nil {
+		ui.Error("%v", err)
+		return
+	}
+	ui.Printf("\n%s\n", qr)
+}
+
+// withShareFlags applies the flags that shape the share itself, and the
+// device ID and interfaces it is announced with.
+func withShareFlags(opts transfer.SenderOptions) transfer.SenderOptions {
+	opts.Name = sendName
+	if opts.Name == "" {
+		opts.Name = config.LoadSettings().DeviceName
+	}
+	opts.DeviceID = deviceID()
+	opts.Certificate = deviceCertificate()
+	opts.Port, opts.PortLast, _ = listenPorts() // Checked by the command
+	opts.Interfaces = listenInterfaces
+	opts.MaxReceivers = sendMaxReceivers
+	if sendOnce {
+		opts.MaxReceivers = 1
+	}
+	opts.IdleTimeout = sendTimeout
+	opts.Code = sendCode
+	return opts
+}
+
+// shareSize adds up the size of the files under paths.
+func shareSize(paths []string) int64 {
+	var total int64
+	for _, path := range paths {
+		_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return total
+}
+
+// sendStdin shares whatever is piped into the command. stdin carries the
+// data, so the accept prompt reads from the terminal instead.
+func sendStdin(ctx context.Context) error {
+	tty, err := os.Open("/dev/tty")
+	if err == nil {
+		defer tty.Close()
+	}
+
+	allowConn := promptFrom(tty)
+	if err != nil && !sendYes {
+		ui.Info("No terminal available for prompts; the first receiver to connect gets the stream.")
+		allowConn = func(addr string) bool {
+			ui.Info("Receiver %s connected, sending stream.", addr)
+			return true
+		}
+	}
+	opts := senderHistory(senderOptions(ctx, allowConn), "stdin", "")
+
+	ui.Info("Preparing to send stdin...")
+	if err := transfer.StartStreamSender("stdin", os.Stdin, opts); err != nil {
+		return fmt.Errorf("error sending data: %w", err)
+	}
+	return nil
+}
+
+// promptFrom asks whether to accept each connecting receiver, reading the
+// answers from in.
+func promptFrom(in io.Reader) func(string) bool {
+	return func(addr string) bool {
+		ui.Info("Incoming connection from %s. Accept? (y/n): ", addr)
+		var response string
+		fmt.Fscanln(in, &response)
+		return strings.ToLower(strings.TrimSpace(response)) == "y"
+	}
+}
+
 func init() {
+	sendCmd.Flags().StringVar(&sendText, "text", "", "Send a text snippet instead of a file")
+	sendCmd.Flags().BoolVarP(&sendYes, "yes", "y", false, "Accept every receiver without prompting")
+	addPortFlag(sendCmd)
+	sendCmd.Flags().StringVar(&sendName, "name", "", "Name advertised to receivers (default: the device_name setting)")
+	sendCmd.Flags().BoolVar(&sendOnce, "once", false, "Exit after the first successful transfer")
+	sendCmd.Flags().IntVar(&sendMaxReceivers, "max-receivers", 0, "Exit after this many successful transfers (0: no limit)")
+	sendCmd.Flags().DurationVar(&sendTimeout, "timeout", 0, "Exit when no receiver has connected for this long, e.g. 5m (0: wait forever)")
+	sendCmd.Flags().StringVar(&sendCode, "code", "", "Share code receivers can type to find the share and skip approval, like 7-tiger-lamp-ocean (default: a random one)")
+	sendCmd.Flags().BoolVar(&sendQR, "qr", false, "Show the connection code as a QR code, for receivers on networks that block discovery")
+	addInterfaceFlag(sendCmd)
 	rootCmd.AddCommand(sendCmd)
 }
@@ -0,0 +1,11 @@
+// Command synapse-cli is the headless Synapse client. It has no GUI
+// dependencies, so it builds as a static binary for servers and CI:
+//
+//	CGO_ENABLED=0 go build -o synapse ./cmd/synapse-cli
+package main
+
+import "github.com/example/synapse/cmd"
+
+func main() {
+	cmd.Execute()
+}
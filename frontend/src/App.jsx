@@ -5,6 +5,9 @@ import { ToastProvider } from './hooks/useToast'
 import Toast from './components/Toast'
 import Sidebar from './components/Sidebar'
 import TransferOverlay from './components/TransferOverlay'
+import OfferPrompt from './components/OfferPrompt'
+import SelectionPrompt from './components/SelectionPrompt'
+import TextPrompt from './components/TextPrompt'
 import SendTab from './tabs/SendTab'
 import ReceiveTab from './tabs/ReceiveTab'
 import HistoryTab from './tabs/HistoryTab'
@@ -27,7 +30,11 @@ function AppInner() {
   const [deviceInfo,   setDeviceInfo]   = useState(null)
   const [isSending,    setIsSending]    = useState(false)
   const [senderPort,   setSenderPort]   = useState(null)
+  const [shareCode,    setShareCode]    = useState(null)
   const [transfer,     setTransfer]     = useState({ visible: false })
+  const [offers,       setOffers]       = useState([])
+  const [listing,      setListing]      = useState(null)
+  const [snippet,      setSnippet]      = useState(null)
   const speedRef = useRef({ time: 0, bytes: 0, text: '— B/s' })
 
   useEffect(() => {
@@ -47,9 +54,13 @@ function AppInner() {
         setSenderPort(port)
         setIsSending(true)
       }),
+      window.runtime.EventsOn('sender:code', code => {
+        setShareCode(code?.code ? code : null)
+      }),
       window.runtime.EventsOn('sender:stopped', () => {
         setIsSending(false)
         setSenderPort(null)
+        setShareCode(null)
       }),
       window.runtime.EventsOn('sender:error', () => {
         setIsSending(false)
@@ -83,6 +94,15 @@ function AppInner() {
       window.runtime.EventsOn('transfer:error', () => {
         setTimeout(() => setTransfer({ visible: false }), 2000)
       }),
+      window.runtime.EventsOn('transfer:text', data => setSnippet(data)),
+      window.runtime.EventsOn('transfer:listing', data => setListing(data)),
+      window.runtime.EventsOn('transfer:listing-expired', () => setListing(null)),
+      window.runtime.EventsOn('inbox:offer', offer => {
+        setOffers(prev => [...prev, offer])
+      }),
+      window.runtime.EventsOn('inbox:offer-expired', id => {
+        setOffers(prev => prev.filter(o => o.id !== id))
+      }),
     ]
 
     return () => offs.forEach(off => typeof off === 'function' && off())
@@ -98,14 +118,30 @@ function AppInner() {
     setTransfer({ visible: false })
   }
 
+  const respondToOffer = (id, accept) => {
+    window.go?.gui?.App?.RespondToOffer?.(id, accept)
+    setOffers(prev => prev.filter(o => o.id !== id))
+  }
+
+  const selectEntries = (paths) => {
+    window.go?.gui?.App?.SelectEntries?.(paths)
+    setListing(null)
+  }
+
+  const cancelSelection = () => {
+    window.go?.gui?.App?.CancelSelection?.()
+    setListing(null)
+  }
+
   const direction = TAB_ORDER.indexOf(activeTab) > TAB_ORDER.indexOf(prevTab) ? 1 : -1
 
   const tabs = {
     send:     <SendTab
                 onSendingStart={() => setIsSending(true)}
-                onSendingStop={() => { setIsSending(false); setSenderPort(null) }}
+                onSendingStop={() => { setIsSending(false); setSenderPort(null); setShareCode(null) }}
                 isSending={isSending}
                 senderPort={senderPort}
+                shareCode={shareCode}
               />,
     receive:  <ReceiveTab />,
     history:  <HistoryTab />,
@@ -138,6 +174,9 @@ function AppInner() {
       </main>
 
       <TransferOverlay transfer={transfer} onCancel={cancelTransfer} />
+      <OfferPrompt offer={offers[0]} onRespond={respondToOffer} />
+      <SelectionPrompt listing={listing} onSelect={selectEntries} onCancel={cancelSelection} />
+      <TextPrompt snippet={snippet} onClose={() => setSnippet(null)} />
       <Toast />
     </div>
   )
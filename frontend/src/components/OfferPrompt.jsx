@@ -0,0 +1,60 @@
+/* eslint-disable no-unused-vars */
+import { AnimatePresence, motion } from 'framer-motion'
+import { Inbox, File, Folder } from 'lucide-react'
+import styles from './Dialog.module.css'
+
+function formatBytes(bytes) {
+  if (!bytes || isNaN(bytes) || bytes === 0) return '0 B'
+  const units = ['B', 'KB', 'MB', 'GB', 'TB']
+  let i = 0, size = Number(bytes)
+  while (size >= 1000 && i < units.length - 1) { size /= 1000; i++ }
+  return `${size.toFixed(1)} ${units[i]}`
+}
+
+export default function OfferPrompt({ offer, onRespond }) {
+  return (
+    <AnimatePresence>
+      {offer && (
+        <motion.div
+          className={styles.backdrop}
+          initial={{ opacity: 0 }}
+          animate={{ opacity: 1 }}
+          exit={{ opacity: 0 }}
+        >
+          <motion.div
+            className={styles.dialog}
+            initial={{ y: 20, scale: 0.95 }}
+            animate={{ y: 0, scale: 1 }}
+            exit={{ y: 20, scale: 0.95 }}
+            transition={{ type: 'spring', stiffness: 380, damping: 30 }}
+          >
+            <div className={styles.header}>
+              <div className={styles.icon}><Inbox size={18} /></div>
+              <div>
+                <div className={styles.title}>{offer.sender_name || offer.peer_addr} wants to send you files</div>
+                <div className="text-secondary text-xs">
+                  {offer.files?.length || 0} item(s), {formatBytes(offer.total_size)} in total
+                </div>
+              </div>
+            </div>
+
+            <div className={styles.files}>
+              {(offer.files || []).map(f => (
+                <div key={f.name} className={styles.fileRow}>
+                  {f.is_dir ? <Folder size={14} /> : <File size={14} />}
+                  <span className="truncate">{f.name}</span>
+                  <span className="font-mono text-xs text-muted">{formatBytes(f.size)}</span>
+                </div>
+              ))}
+            </div>
+
+            <div className={styles.actions}>
+              <button className="btn btn-secondary btn-sm" onClick={() => onRespond(offer.id, false)}>Decline</button>
+              <button className="btn btn-primary btn-sm" onClick={() => onRespond(offer.id, true)}>Accept</button>
+            </div>
+          </motion.div>
+        </motion.div>
+      )}
+    </AnimatePresence>
+  )
+}
@@ -0,0 +1,83 @@
+/* eslint-disable no-unused-vars */
+import { useEffect, useState } from 'react'
+import { AnimatePresence, motion } from 'framer-motion'
+import { FolderDown } from 'lucide-react'
+import styles from './Dialog.module.css'
+
+function formatBytes(bytes) {
+  if (!bytes || isNaN(bytes) || bytes === 0) return '0 B'
+  const units = ['B', 'KB', 'MB', 'GB', 'TB']
+  let i = 0, size = Number(bytes)
+  while (size >= 1000 && i < units.length - 1) { size /= 1000; i++ }
+  return `${size.toFixed(1)} ${units[i]}`
+}
+
+export default function SelectionPrompt({ listing, onSelect, onCancel }) {
+  const entries = listing?.entries || []
+  const [checked, setChecked] = useState({})
+
+  useEffect(() => {
+    setChecked(Object.fromEntries(entries.map(e => [e.path, true])))
+  }, [listing])
+
+  const chosen = entries.filter(e => checked[e.path])
+  const allChecked = chosen.length === entries.length
+  const toggleAll = () => setChecked(Object.fromEntries(entries.map(e => [e.path, !allChecked])))
+
+  const download = () => onSelect(allChecked ? [] : chosen.map(e => e.path))
+
+  return (
+    <AnimatePresence>
+      {listing && (
+        <motion.div
+          className={styles.backdrop}
+          initial={{ opacity: 0 }}
+          animate={{ opacity: 1 }}
+          exit={{ opacity: 0 }}
+        >
+          <motion.div
+            className={styles.dialog}
+            initial={{ y: 20, scale: 0.95 }}
+            animate={{ y: 0, scale: 1 }}
+            exit={{ y: 20, scale: 0.95 }}
+            transition={{ type: 'spring', stiffness: 380, damping: 30 }}
+          >
+            <div className={styles.header}>
+              <div className={styles.icon}><FolderDown size={18} /></div>
+              <div>
+                <div className={styles.title}>Choose files from {listing.peer_name}</div>
+                <div className="text-secondary text-xs">
+                  {chosen.length} of {entries.length} selected, {formatBytes(chosen.reduce((n, e) => n + e.size, 0))}
+                </div>
+              </div>
+            </div>
+
+            <div className={styles.files}>
+              <label className={styles.fileRow}>
+                <input type="checkbox" checked={allChecked} onChange={toggleAll} />
+                <span>Select all</span>
+                <span />
+              </label>
+              {entries.map(e => (
+                <label key={e.path} className={styles.fileRow}>
+                  <input
+                    type="checkbox"
+                    checked={!!checked[e.path]}
+                    onChange={ev => setChecked(c => ({ ...c, [e.path]: ev.target.checked }))}
+                  />
+                  <span className="truncate" title={e.path}>{e.path}</span>
+                  <span className="font-mono text-xs text-muted">{formatBytes(e.size)}</span>
+                </label>
+              ))}
+            </div>
+
+            <div className={styles.actions}>
+              <button className="btn btn-secondary btn-sm" onClick={onCancel}>Cancel</button>
+              <button className="btn btn-primary btn-sm" onClick={download} disabled={chosen.length === 0}>Download</button>
+            </div>
+          </motion.div>
+        </motion.div>
+      )}
+    </AnimatePresence>
+  )
+}
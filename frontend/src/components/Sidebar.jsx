@@ -77,7 +77,7 @@ export default function Sidebar({ activeTab, onTabChange, deviceInfo }) {
         </div>
         <div className={styles.deviceInfo}>
           <span className={styles.deviceName}>{deviceInfo?.name || 'My Device'}</span>
-          <span className={`${styles.deviceIp} font-mono`}>{deviceInfo?.ip || '—'}</span>
+          <span className={`${styles.deviceIp} font-mono`} title={(deviceInfo?.ips || []).join('\n')}>{deviceInfo?.ip || '—'}</span>
         </div>
       </div>
     </motion.aside>
@@ -0,0 +1,50 @@
+/* eslint-disable no-unused-vars */
+import { AnimatePresence, motion } from 'framer-motion'
+import { Type } from 'lucide-react'
+import { useToast } from '../hooks/useToast'
+import styles from './Dialog.module.css'
+
+export default function TextPrompt({ snippet, onClose }) {
+  const { showToast } = useToast()
+
+  const copy = async () => {
+    try {
+      await window.go.gui.App.CopyToClipboard(snippet.text)
+      showToast('success', 'Copied to clipboard')
+      onClose()
+    } catch (e) { showToast('error', `Copy failed: ${e}`) }
+  }
+
+  return (
+    <AnimatePresence>
+      {snippet && (
+        <motion.div
+          className={styles.backdrop}
+          initial={{ opacity: 0 }}
+          animate={{ opacity: 1 }}
+          exit={{ opacity: 0 }}
+        >
+          <motion.div
+            className={styles.dialog}
+            initial={{ y: 20, scale: 0.95 }}
+            animate={{ y: 0, scale: 1 }}
+            exit={{ y: 20, scale: 0.95 }}
+            transition={{ type: 'spring', stiffness: 380, damping: 30 }}
+          >
+            <div className={styles.header}>
+              <div className={styles.icon}><Type size={18} /></div>
+              <div className={styles.title}>Text from {snippet.peer_name}</div>
+            </div>
+
+            <pre className={styles.snippet}>{snippet.text}</pre>
+
+            <div className={styles.actions}>
+              <button className="btn btn-secondary btn-sm" onClick={onClose}>Close</button>
+              <button className="btn btn-primary btn-sm" onClick={copy}>Copy</button>
+            </div>
+          </motion.div>
+        </motion.div>
+      )}
+    </AnimatePresence>
+  )
+}
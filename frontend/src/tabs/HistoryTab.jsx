@@ -149,6 +149,18 @@ export default function HistoryTab() {
                     {selectedEntry.status}
                   </span>
                 </div>
+                {selectedEntry.files?.length > 0 && (
+                  <div className={styles.detailRow} style={{ marginTop: '1rem', flexWrap: 'wrap' }}>
+                    <span className={styles.detailLabel}>Files ({selectedEntry.files.length})</span>
+                    <div className={`${styles.errorLog} font-mono`}>{selectedEntry.files.join('\n')}</div>
+                  </div>
+                )}
+                {selectedEntry.text && (
+                  <div className={styles.detailRow} style={{ marginTop: '1rem', flexWrap: 'wrap' }}>
+                    <span className={styles.detailLabel}>Text</span>
+                    <div className={`${styles.errorLog} font-mono`}>{selectedEntry.text}</div>
+                  </div>
+                )}
                 {selectedEntry.error && (
                   <div className={styles.detailRow} style={{ marginTop: '1rem', flexWrap: 'wrap' }}>
                     <span className={styles.detailLabel}>Error Reason</span>
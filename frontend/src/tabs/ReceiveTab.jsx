@@ -1,7 +1,7 @@
 /* eslint-disable no-unused-vars */
 import { useState, useEffect, useRef } from 'react'
 import { motion, AnimatePresence } from 'framer-motion'
-import { Search, Monitor, WifiOff, RefreshCw, Download } from 'lucide-react'
+import { Monitor, WifiOff, RefreshCw, Download, Inbox, Link } from 'lucide-react'
 import { useToast } from '../hooks/useToast'
 import styles from './ReceiveTab.module.css'
 
@@ -115,32 +115,102 @@ function RadarAnimation({ scanning }) {
 export default function ReceiveTab() {
   const [scanning, setScanning]   = useState(false)
   const [peers, setPeers]         = useState([])
-  const [scanned, setScanned]     = useState(false)
   const [connecting, setConnecting] = useState(null)
+  const [inboxOn, setInboxOn]     = useState(false)
+  const [code, setCode]           = useState('')
   const { showToast } = useToast()
 
-  const scan = async () => {
-    setScanning(true)
-    setScanned(false)
-    setPeers([])
+  useEffect(() => {
+    window.go?.gui?.App?.IsInboxRunning?.().then(setInboxOn).catch(() => {})
+    if (!window.runtime) return
+    const offs = [
+      window.runtime.EventsOn('inbox:stopped', () => setInboxOn(false)),
+      window.runtime.EventsOn('inbox:error', e => showToast('error', `Inbox error: ${e}`)),
+    ]
+    return () => offs.forEach(off => typeof off === 'function' && off())
+  }, [showToast])
+
+  const toggleInbox = async () => {
+    try {
+      if (inboxOn) {
+        await window.go.gui.App.StopInbox()
+        setInboxOn(false)
+        showToast('info', 'Inbox closed')
+      } else {
+        await window.go.gui.App.StartInbox()
+        setInboxOn(true)
+        showToast('success', 'Inbox open — peers can now send files to you')
+      }
+    } catch (e) {
+      showToast('error', `Inbox failed: ${e}`)
+    }
+  }
+
+  // Discovery runs while the tab is open; peers come and go through events.
+  const startDiscovery = async () => {
     try {
-      const result = await window.go.gui.App.ScanPeers()
+      const result = await window.go.gui.App.StartDiscovery()
       setPeers(result || [])
-      setScanned(true)
-      if (!result?.length) showToast('info', 'No peers found on this network')
-      else showToast('success', `Found ${result.length} peer(s)`)
+      setScanning(true)
     } catch (e) {
-      showToast('error', `Scan failed: ${e}`)
-    } finally {
-      setScanning(false)
+      showToast('error', `Discovery failed: ${e}`)
+    }
+  }
+
+  useEffect(() => {
+    if (!window.runtime) return
+    const upsert = peer => setPeers(ps => {
+      const i = ps.findIndex(p => p.id === peer.id)
+      if (i < 0) return [...ps, peer]
+      const next = [...ps]
+      next[i] = peer
+      return next
+    })
+    const offs = [
+      window.runtime.EventsOn('peer:added', upsert),
+      window.runtime.EventsOn('peer:updated', upsert),
+      window.runtime.EventsOn('peer:removed', peer => setPeers(ps => ps.filter(p => p.id !== peer.id))),
+      window.runtime.EventsOn('discovery:error', e => {
+        setScanning(false)
+        showToast('error', `Discovery failed: ${e}`)
+      }),
+    ]
+    startDiscovery()
+    return () => {
+      offs.forEach(off => typeof off === 'function' && off())
+      window.go?.gui?.App?.StopDiscovery?.()
     }
+  }, [showToast])
+
+  const rescan = async () => {
+    setPeers([])
+    await window.go.gui.App.StopDiscovery()
+    await startDiscovery()
   }
 
   const connect = async (peer) => {
     setConnecting(peer.address)
     showToast('info', `Connecting to ${peer.name}...`)
     try {
-      await window.go.gui.App.ConnectToReceive(peer.address, peer.name)
+      await window.go.gui.App.ConnectToReceive(peer.address, peer.name, peer.addresses || [])
+    } catch (e) {
+      showToast('error', `Connection failed: ${e}`)
+    } finally {
+      setConnecting(null)
+    }
+  }
+
+  // A share code, or for networks that block mDNS, the sender's address or
+  // connection code
+  const connectWithCode = async (e) => {
+    e.preventDefault()
+    const value = code.trim()
+    if (!value) return
+    setConnecting(value)
+    showToast('info', `Connecting to ${value}...`)
+    try {
+      await window.go.gui.App.ConnectWithCode(value)
+      setCode('')
     } catch (e) {
       showToast('error', `Connection failed: ${e}`)
     } finally {
@@ -155,6 +225,35 @@ export default function ReceiveTab() {
         <p className="text-secondary">Discover devices sending files on your network via mDNS.</p>
       </div>
 
+      {/* Inbox */}
+      <div className={styles.inboxBar}>
+        <div className={styles.peerAvatar}><Inbox size={20} /></div>
+        <div className={styles.peerInfo}>
+          <div className={styles.peerName}>Inbox</div>
+          <div className={styles.peerAddr}>
+            {inboxOn ? 'Open — nearby senders can push files to this device' : 'Let nearby senders push files to you without scanning'}
+          </div>
+        </div>
+        <button className={`btn btn-sm ${inboxOn ? 'btn-secondary' : 'btn-primary'}`} onClick={toggleInbox}>
+          {inboxOn ? 'Close Inbox' : 'Open Inbox'}
+        </button>
+      </div>
+
+      {/* Connect by address */}
+      <form className={styles.inboxBar} onSubmit={connectWithCode}>
+        <div className={styles.peerAvatar}><Link size={20} /></div>
+        <input
+          className="input font-mono"
+          value={code}
+          onChange={e => setCode(e.target.value)}
+          placeholder="Share code (7-tiger-lamp-ocean), address or synapse:// code"
+          spellCheck={false}
+        />
+        <button type="submit" className="btn btn-primary btn-sm" disabled={!code.trim() || connecting === code.trim()}>
+          <Download size={14} /> Connect
+        </button>
+      </form>
+
       {/* Radar */}
       <div className={styles.radarSection}>
         <div className={styles.radarWrap}>
@@ -162,24 +261,21 @@ export default function ReceiveTab() {
         </div>
         <div className={styles.radarInfo}>
           <p className={scanning ? styles.scanningText : styles.idleText}>
-            {scanning ? 'Scanning via mDNS...' : scanned ? `Found ${peers.length} peer(s)` : 'Click scan to discover peers'}
+            {!scanning ? 'Discovery stopped' : peers.length ? `${peers.length} peer(s) nearby` : 'Searching via mDNS...'}
           </p>
           <motion.button
-            className={`btn ${scanning ? 'btn-secondary' : 'btn-primary'}`}
-            onClick={scan}
-            disabled={scanning}
+            className="btn btn-secondary"
+            onClick={rescan}
             whileTap={{ scale: 0.97 }}
           >
-            {scanning
-              ? <><motion.span animate={{ rotate: 360 }} transition={{ duration: 1, repeat: Infinity, ease: 'linear' }} style={{ display:'inline-flex' }}><RefreshCw size={16} /></motion.span> Scanning...</>
-              : <><Search size={16} /> Scan for Peers</>}
+            <RefreshCw size={16} /> Rescan
           </motion.button>
         </div>
       </div>
 
       {/* Peer Cards */}
       <AnimatePresence>
-        {scanned && peers.length > 0 && (
+        {peers.length > 0 && (
           <motion.div
             initial={{ opacity: 0, y: 12 }}
             animate={{ opacity: 1, y: 0 }}
@@ -192,7 +288,7 @@ export default function ReceiveTab() {
             <div className={styles.peerGrid}>
               {peers.map((peer, i) => (
                 <motion.div
-                  key={peer.address}
+                  key={peer.id}
                   className={styles.peerCard}
                   initial={{ opacity: 0, y: 8 }}
                   animate={{ opacity: 1, y: 0 }}
@@ -203,8 +299,14 @@ export default function ReceiveTab() {
                     <Monitor size={22} />
                   </div>
                   <div className={styles.peerInfo}>
-                    <div className={styles.peerName}>{peer.name}</div>
-                    <div className={`${styles.peerAddr} font-mono`}>{peer.address}</div>
+                    <div className={styles.peerName}>
+                      {peer.name}
+                      {peer.saved && <span className={`badge badge-accent ${styles.savedBadge}`}>Saved</span>}
+                    </div>
+                    {peer.summary && <div className={styles.peerAddr}>{peer.summary}</div>}
+                    <div className={`${styles.peerAddr} font-mono`} title={(peer.ips || []).join('\n')}>
+                      {peer.os ? `${peer.os} · ${peer.address}` : peer.address}
+                    </div>
                   </div>
                   <button
                     className="btn btn-primary btn-sm"
@@ -220,7 +322,7 @@ export default function ReceiveTab() {
           </motion.div>
         )}
 
-        {scanned && peers.length === 0 && (
+        {scanning && peers.length === 0 && (
           <motion.div
             className={`${styles.emptyBox}`}
             initial={{ opacity: 0 }}
@@ -228,7 +330,7 @@ export default function ReceiveTab() {
           >
             <WifiOff size={36} style={{ color: 'var(--text-muted)', marginBottom: '0.75rem' }} />
             <p style={{ color: 'var(--text-secondary)', fontSize: '0.875rem' }}>
-              No peers found. Make sure someone is sending on the same network.
+              No peers yet. Make sure someone is sending on the same network.
             </p>
           </motion.div>
         )}
@@ -3,7 +3,7 @@ import { useState, useCallback } from 'react'
 import { motion, AnimatePresence } from 'framer-motion'
 import {
   UploadCloud, FolderOpen, X, File, Image, FileText,
-  Video, Archive, Code, Folder, Play, StopCircle
+  Video, Archive, Code, Folder, Play, StopCircle, Inbox, Monitor, Type, Copy
 } from 'lucide-react'
 import { useToast } from '../hooks/useToast'
 import styles from './SendTab.module.css'
@@ -47,9 +47,12 @@ function formatBytes(bytes) {
   return `${size.toFixed(1)} ${units[i]}`
 }
 
-export default function SendTab({ onSendingStart, onSendingStop, isSending, senderPort }) {
+export default function SendTab({ onSendingStart, onSendingStop, isSending, senderPort, shareCode }) {
   const [selectedFiles, setSelectedFiles] = useState([])
   const [dragOver, setDragOver] = useState(false)
+  const [inboxes, setInboxes] = useState(null)
+  const [scanningInboxes, setScanningInboxes] = useState(false)
+  const [snippet, setSnippet] = useState('')
   const { showToast } = useToast()
 
   const addFile = (fileInfo) => {
@@ -98,12 +101,49 @@ export default function SendTab({ onSendingStart, onSendingStop, isSending, send
     } catch (e) { showToast('error', `Failed to start: ${e}`) }
   }
 
+  const shareText = async () => {
+    if (!snippet.trim()) { showToast('error', 'Nothing to share'); return }
+    try {
+      await window.go.gui.App.SendText(snippet)
+      showToast('success', 'Now sharing text snippet on the network')
+      onSendingStart?.()
+    } catch (e) { showToast('error', `Failed to start: ${e}`) }
+  }
+
+  const findInboxes = async () => {
+    setScanningInboxes(true)
+    try {
+      const result = await window.go.gui.App.ScanInboxes()
+      setInboxes(result || [])
+      if (!result?.length) showToast('info', 'No open inboxes found on this network')
+    } catch (e) { showToast('error', `Scan failed: ${e}`) }
+    finally { setScanningInboxes(false) }
+  }
+
+  const pushTo = async (inbox) => {
+    try {
+      const paths = selectedFiles.map(f => f.path)
+      await window.go.gui.App.PushToInbox(inbox.address, inbox.name, paths, inbox.addresses || [])
+      showToast('info', `Waiting for ${inbox.name} to accept...`)
+      setInboxes(null)
+    } catch (e) { showToast('error', `Push failed: ${e}`) }
+  }
+
   const stopSend = () => {
     window.go.gui.App.StopSending()
     showToast('info', 'Stopped sharing')
     onSendingStop?.()
   }
 
+  const copyCode = async (code) => {
+    try {
+      await window.go.gui.App.CopyToClipboard(code)
+      showToast('success', 'Copied to clipboard')
+    } catch (e) {
+      showToast('error', `Copy failed: ${e}`)
+    }
+  }
+
   return (
     <div className={styles.tab}>
       <div className="section-header">
@@ -139,6 +179,22 @@ export default function SendTab({ onSendingStart, onSendingStop, isSending, send
         </div>
       </motion.div>
 
+      {/* Text Snippet */}
+      {!isSending && selectedFiles.length === 0 && (
+        <div className={styles.textCard}>
+          <textarea
+            className={styles.textInput}
+            placeholder="Or paste a link, password or note to share as text..."
+            value={snippet}
+            onChange={e => setSnippet(e.target.value)}
+            rows={3}
+          />
+          <button className="btn btn-secondary" onClick={shareText} disabled={!snippet.trim()}>
+            <Type size={16} /> Share Text
+          </button>
+        </div>
+      )}
+
       {/* File List */}
       <AnimatePresence>
         {selectedFiles.length > 0 && (
@@ -187,7 +243,7 @@ export default function SendTab({ onSendingStart, onSendingStop, isSending, send
 
       {/* Action Bar */}
       <AnimatePresence>
-        {selectedFiles.length > 0 && (
+        {(selectedFiles.length > 0 || isSending) && (
           <motion.div
             className={styles.actionBar}
             initial={{ opacity: 0, y: 10 }}
@@ -195,33 +251,81 @@ export default function SendTab({ onSendingStart, onSendingStop, isSending, send
             exit={{ opacity: 0, y: 10 }}
           >
             {isSending ? (
-              <div className={styles.sendingStatus}>
-                <div className={styles.pulseWrap}>
-                  <motion.div
-                    className={styles.pulseRing}
-                    animate={{ scale: [1, 1.8, 1], opacity: [0.6, 0, 0.6] }}
-                    transition={{ duration: 1.8, repeat: Infinity }}
-                  />
-                  <motion.div
-                    className={styles.pulseDot}
-                    animate={{ scale: [1, 1.15, 1] }}
-                    transition={{ duration: 1.8, repeat: Infinity }}
-                  />
-                </div>
-                <div>
-                  <div className={styles.sendingLabel}>Waiting for receiver on</div>
-                  <div className={`${styles.portLabel} font-mono`}>Port {senderPort || '—'}</div>
+              <>
+                <div className={styles.sendingStatus}>
+                  <div className={styles.pulseWrap}>
+                    <motion.div
+                      className={styles.pulseRing}
+                      animate={{ scale: [1, 1.8, 1], opacity: [0.6, 0, 0.6] }}
+                      transition={{ duration: 1.8, repeat: Infinity }}
+                    />
+                    <motion.div
+                      className={styles.pulseDot}
+                      animate={{ scale: [1, 1.15, 1] }}
+                      transition={{ duration: 1.8, repeat: Infinity }}
+                    />
+                  </div>
+                  <div>
+                    <div className={styles.sendingLabel}>Waiting for receiver on</div>
+                    <div className={`${styles.portLabel} font-mono`}>Port {senderPort || '—'}</div>
+                  </div>
+                  <button className="btn btn-danger btn-sm" onClick={stopSend}>
+                    <StopCircle size={15} /> Stop
+                  </button>
                 </div>
-                <button className="btn btn-danger btn-sm" onClick={stopSend}>
-                  <StopCircle size={15} /> Stop
-                </button>
-              </div>
+                {shareCode && (
+                  <div className={styles.shareCode}>
+                    {shareCode.qr && <img className={styles.shareQR} src={shareCode.qr} alt="Connection code QR" />}
+                    <div className={styles.shareCodeText}>
+                      {shareCode.words && (
+                        <>
+                          <div className={styles.sendingLabel}>Share code — receivers who type it needn't be approved</div>
+                          <div className={`${styles.shareWords} font-mono`}>{shareCode.words}</div>
+                        </>
+                      )}
+                      <div className={styles.sendingLabel}>Connection code, for networks that block discovery</div>
+                      <div className={`${styles.shareCodeValue} font-mono`}>{shareCode.code}</div>
+                      <div className={styles.readyActions}>
+                        {shareCode.words && (
+                          <button className="btn btn-secondary btn-sm" onClick={() => copyCode(shareCode.words)}>
+                            <Copy size={14} /> Copy share code
+                          </button>
+                        )}
+                        <button className="btn btn-secondary btn-sm" onClick={() => copyCode(shareCode.code)}>
+                          <Copy size={14} /> Copy connection code
+                        </button>
+                      </div>
+                    </div>
+                  </div>
+                )}
+              </>
             ) : (
               <div className={styles.readyBar}>
                 <span className="text-secondary text-sm">Ready to broadcast on LAN</span>
-                <button className="btn btn-primary" onClick={startSend}>
-                  <Play size={16} /> Start Sending
-                </button>
+                <div className={styles.readyActions}>
+                  <button className="btn btn-secondary" onClick={findInboxes} disabled={scanningInboxes}>
+                    <Inbox size={16} /> {scanningInboxes ? 'Searching...' : 'Send to Inbox'}
+                  </button>
+                  <button className="btn btn-primary" onClick={startSend}>
+                    <Play size={16} /> Start Sending
+                  </button>
+                </div>
+              </div>
+            )}
+            {!isSending && inboxes?.length > 0 && (
+              <div className={styles.inboxList}>
+                {inboxes.map(inbox => (
+                  <div key={inbox.address} className={styles.fileItem}>
+                    <div className={styles.fileIcon}><Monitor size={18} /></div>
+                    <div className={styles.fileDetails}>
+                      <span className={styles.fileName}>{inbox.name}</span>
+                      <span className={`${styles.fileSize} font-mono`}>
+                        {inbox.saved ? `Address book · ${inbox.address}` : inbox.address}
+                      </span>
+                    </div>
+                    <button className="btn btn-primary btn-sm" onClick={() => pushTo(inbox)}>Send</button>
+                  </div>
+                ))}
               </div>
             )}
           </motion.div>
@@ -1,7 +1,7 @@
 /* eslint-disable no-unused-vars */
 import { useEffect, useState } from 'react'
 import { motion } from 'framer-motion'
-import { Monitor, FolderOpen, Shield, Save } from 'lucide-react'
+import { Monitor, FolderOpen, Shield, Save, Network, Plug, BookUser, Pencil, Trash2, Plus } from 'lucide-react'
 import { useToast } from '../hooks/useToast'
 import styles from './SettingsTab.module.css'
 
@@ -31,9 +31,166 @@ function SettingRow({ icon: Icon, label, description, children }) {
   )
 }
 
+// parsePorts reads "4242" or "4242-4250" into [first, last], with last 0 for
+// a single port; empty or 0 means any free port. It returns null if invalid.
+function parsePorts(text) {
+  const m = text.trim().match(/^(?:(\d+)(?:\s*-\s*(\d+))?)?$/)
+  if (!m) return null
+  if (!m[1] || (Number(m[1]) === 0 && !m[2])) return [0, 0]
+  const first = Number(m[1])
+  const last = m[2] ? Number(m[2]) : 0
+  const valid = p => p >= 1 && p <= 65535
+  if (!valid(first) || (m[2] && (!valid(last) || last < first))) return null
+  return [first, last > first ? last : 0]
+}
+
+function formatPorts(port, last) {
+  if (!port) return ''
+  return last > port ? `${port}-${last}` : `${port}`
+}
+
+const emptyContact = { name: '', addresses: '', port: '', inbox: false, fingerprint: '', notes: '' }
+
+// AddressBook lists the saved peers, which discovery shows next to the ones
+// it finds, and edits them. Changes are saved right away.
+function AddressBook() {
+  const [contacts, setContacts] = useState([])
+  const [editing, setEditing] = useState(null) // { previous, form } while the form is open
+  const { showToast } = useToast()
+
+  const load = async () => {
+    try {
+      setContacts(await window.go.gui.App.GetAddressBook() || [])
+    } catch (e) { showToast('error', `Failed to load the address book: ${e}`) }
+  }
+
+  useEffect(() => { load() }, [])
+
+  const edit = c => setEditing({
+    previous: c.name,
+    form: { ...c, addresses: (c.addresses || []).join(', '), port: String(c.port), inbox: !!c.inbox, fingerprint: c.fingerprint || '', notes: c.notes || '' },
+  })
+
+  const setField = (key, value) => setEditing(e => ({ ...e, form: { ...e.form, [key]: value } }))
+
+  const save = async () => {
+    const { form, previous } = editing
+    const contact = {
+      ...form,
+      addresses: form.addresses.split(/[\s,]+/).filter(Boolean),
+      port: Number(form.port) || 0,
+    }
+    try {
+      await window.go.gui.App.SaveContact(previous, contact)
+      setEditing(null)
+      await load()
+      showToast('success', `Saved ${contact.name.trim()}`)
+    } catch (e) { showToast('error', `${e}`) }
+  }
+
+  const remove = async name => {
+    try {
+      await window.go.gui.App.RemoveContact(name)
+      await load()
+    } catch (e) { showToast('error', `${e}`) }
+  }
+
+  const describe = c => [
+    c.inbox ? 'Inbox' : 'Share',
+    `${(c.addresses || []).join(', ')} port ${c.port}`,
+    c.notes,
+  ].filter(Boolean).join(' · ')
+
+  return (
+    <>
+      {contacts.length === 0 && !editing && (
+        <div className={styles.row}>
+          <span className="text-sm text-muted">
+            No saved peers. Save the ones discovery can't find, such as servers on another network.
+          </span>
+        </div>
+      )}
+      {contacts.map(c => (
+        <div key={c.name}>
+          <SettingRow icon={BookUser} label={c.name} description={describe(c)}>
+            <div className={styles.contactActions}>
+              <button className="btn btn-secondary btn-sm" onClick={() => edit(c)} disabled={!!editing}>
+                <Pencil size={14} /> Edit
+              </button>
+              <button className="btn btn-danger btn-sm" onClick={() => remove(c.name)} disabled={!!editing}>
+                <Trash2 size={14} />
+              </button>
+            </div>
+          </SettingRow>
+          <div className={styles.dividerLine} />
+        </div>
+      ))}
+
+      {editing ? (
+        <div className={styles.contactForm}>
+          <input
+            className="input"
+            type="text"
+            value={editing.form.name}
+            onChange={e => setField('name', e.target.value)}
+            placeholder="Name, e.g. buildbox"
+          />
+          <input
+            className="input font-mono"
+            type="text"
+            value={editing.form.addresses}
+            onChange={e => setField('addresses', e.target.value)}
+            placeholder="Addresses or host names, comma-separated"
+          />
+          <input
+            className="input font-mono"
+            type="text"
+            value={editing.form.port}
+            onChange={e => setField('port', e.target.value)}
+            placeholder="Port"
+          />
+          <input
+            className="input font-mono"
+            type="text"
+            value={editing.form.fingerprint}
+            onChange={e => setField('fingerprint', e.target.value)}
+            placeholder="Certificate fingerprint to pin (optional)"
+          />
+          <input
+            className={`input ${styles.contactNotes}`}
+            type="text"
+            value={editing.form.notes}
+            onChange={e => setField('notes', e.target.value)}
+            placeholder="Notes (optional)"
+          />
+          <div className="toggle-wrap">
+            <ToggleSwitch checked={editing.form.inbox} onChange={v => setField('inbox', v)} />
+            <span className="toggle-label">{editing.form.inbox ? 'Inbox' : 'Share'}</span>
+          </div>
+          <div className={styles.contactActions}>
+            <button className="btn btn-primary btn-sm" onClick={save}>
+              <Save size={14} /> Save
+            </button>
+            <button className="btn btn-ghost btn-sm" onClick={() => setEditing(null)}>Cancel</button>
+          </div>
+        </div>
+      ) : (
+        <div className={styles.row}>
+          <button className="btn btn-secondary btn-sm" onClick={() => setEditing({ previous: '', form: emptyContact })}>
+            <Plus size={14} /> Add Peer
+          </button>
+        </div>
+      )}
+    </>
+  )
+}
+
 export default function SettingsTab() {
   const [settings, setSettings] = useState({ device_name: '', download_dir: '', auto_accept: false, port: 0 })
   const [saving, setSaving] = useState(false)
+  const [interfaces, setInterfaces] = useState([])
+  const [portText, setPortText] = useState('')
+  const [portError, setPortError] = useState('')
   const { showToast } = useToast()
 
   useEffect(() => {
@@ -41,10 +198,27 @@ export default function SettingsTab() {
       try {
         const s = await window.go.gui.App.GetSettings()
         setSettings(s || {})
+        setPortText(formatPorts(s?.port, s?.port_last))
+        const ifaces = await window.go.gui.App.ListInterfaces()
+        setInterfaces(ifaces || [])
       } catch (e) { console.error('Failed to load settings:', e) }
     })()
   }, [])
 
+  // No interfaces in the settings means the default selection.
+  const chosen = settings.interfaces?.length
+    ? settings.interfaces
+    : interfaces.filter(i => i.default).map(i => i.name)
+
+  const toggleInterface = (name, on) => {
+    const next = on ? [...chosen, name] : chosen.filter(n => n !== name)
+    // An empty list would mean the defaults again, so keep at least one.
+    if (next.length === 0) return
+    const defaults = interfaces.filter(i => i.default).map(i => i.name)
+    const isDefault = next.length === defaults.length && next.every(n => defaults.includes(n))
+    setSettings(s => ({ ...s, interfaces: isDefault ? [] : next }))
+  }
+
   const chooseDir = async () => {
     try {
       const dir = await window.go.gui.App.SelectDownloadDir()
@@ -52,7 +226,18 @@ export default function SettingsTab() {
     } catch (e) { showToast('error', `Dir select error: ${e}`) }
   }
 
+  const changePorts = text => {
+    setPortText(text)
+    const ports = parsePorts(text)
+    setPortError(ports ? '' : 'Enter a port such as 4242 or a range such as 4242-4250')
+    if (ports) setSettings(s => ({ ...s, port: ports[0], port_last: ports[1] }))
+  }
+
   const save = async () => {
+    if (portError) {
+      showToast('error', portError)
+      return
+    }
     setSaving(true)
     try {
       await window.go.gui.App.SaveSettings(settings)
@@ -123,6 +308,63 @@ export default function SettingsTab() {
         </SettingRow>
       </motion.div>
 
+      <motion.div
+        className={styles.card}
+        initial={{ opacity: 0, y: 12 }}
+        animate={{ opacity: 1, y: 0 }}
+        transition={{ duration: 0.3, delay: 0.05 }}
+      >
+        <div className={styles.cardTitle}>Network</div>
+
+        <SettingRow
+          icon={Plug}
+          label="Listening Port"
+          description={portError || 'Port or range tried in order, for firewall rules; empty picks any free port'}
+        >
+          <input
+            className={`input ${styles.nameInput} font-mono`}
+            type="text"
+            value={portText}
+            onChange={e => changePorts(e.target.value)}
+            placeholder="Any"
+          />
+        </SettingRow>
+
+        <div className={styles.dividerLine} />
+
+        {interfaces.length === 0 && (
+          <div className={styles.row}>
+            <span className="text-sm text-muted">No network interfaces found</span>
+          </div>
+        )}
+        {interfaces.map(iface => (
+          <SettingRow
+            key={iface.name}
+            icon={Network}
+            label={iface.virtual ? `${iface.name} (virtual)` : iface.name}
+            description={(iface.addresses || []).join(', ') || 'No address'}
+          >
+            <div className="toggle-wrap">
+              <ToggleSwitch
+                checked={chosen.includes(iface.name)}
+                onChange={v => toggleInterface(iface.name, v)}
+              />
+              <span className="toggle-label">{chosen.includes(iface.name) ? 'Used' : 'Not used'}</span>
+            </div>
+          </SettingRow>
+        ))}
+      </motion.div>
+
+      <motion.div
+        className={styles.card}
+        initial={{ opacity: 0, y: 12 }}
+        animate={{ opacity: 1, y: 0 }}
+        transition={{ duration: 0.3, delay: 0.1 }}
+      >
+        <div className={styles.cardTitle}>Address Book</div>
+        <AddressBook />
+      </motion.div>
+
       <div className={styles.saveRow}>
         <button
           className={`btn btn-primary ${saving ? '' : ''}`}
@@ -2,17 +2,23 @@ package gui
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/example/synapse/internal/config"
 	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/netutil"
 	"github.com/example/synapse/internal/transfer"
-	"github.com/grandcat/zeroconf"
 	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+	"rsc.io/qr"
 )
 
 // App struct is the main GUI application
@@ -22,63 +28,108 @@ type App struct {
 	senderMu     sync.Mutex
 	senderCancel context.CancelFunc
 	senderPort   int
+	shareCode    ShareCode
 	isSending    bool
 	sendFiles    []string
 
 	activeConnMu sync.Mutex
 	activeConn   net.Conn
 
-	settings Settings
+	inboxMu     sync.Mutex
+	inboxCancel context.CancelFunc
+	offers      map[string]chan bool
+	offerSeq    int // Numbers the offers, for their IDs
+
+	choiceMu sync.Mutex
+	choice   chan entryChoice
+
+	discoveryMu sync.Mutex
+	discovery   *discoverySession
+	inboxes     []PeerInfo // From the last ScanInboxes
+
+	settings   config.Settings
+	deviceID   string
+	deviceCert *tls.Certificate // Presented by shares and the inbox; nil if it couldn't be stored
+	interfaces []net.Interface  // Chosen by the interfaces setting
 }
 
 // NewApp creates a new App instance
 func NewApp() *App {
-	return &App{
-		settings: loadSettings(),
+	deviceID, _ := config.DeviceID()
+	a := &App{
+		settings: config.LoadSettings(),
+		deviceID: deviceID,
+		offers:   make(map[string]chan bool),
+	}
+	if cert, err := config.DeviceCertificate(); err == nil {
+		a.deviceCert = &cert
+	}
+	if err := a.useInterfaces(a.settings.Interfaces); err != nil {
+		// An interface from the settings may be missing for now, e.g. an
+		// unplugged adapter; the physical ones still work.
+		_ = a.useInterfaces(nil)
+	}
+	if path, err := config.AddressBookPath(); err == nil {
+		discovery.SetDiscoverer(append(discovery.Network(), discovery.StaticFile{Path: path}))
 	}
+	return a
+}
+
+// useInterfaces listens and announces on the named interfaces, or on the
+// default ones when names is empty.
+func (a *App) useInterfaces(names []string) error {
+	ifaces, err := netutil.Interfaces(names)
+	if err != nil {
+		return err
+	}
+	discovery.SetInterfaces(ifaces)
+	a.interfaces = ifaces
+	return nil
 }
 
 // Startup is called when the Wails app starts
 func (a *App) Startup(ctx context.Context) {
 	a.ctx = ctx
-	loadHistory()
 }
 
 // DeviceInfo holds the device's network information
 type DeviceInfo struct {
-	Name string `json:"name"`
-	IP   string `json:"ip"`
+	Name string   `json:"name"`
+	IP   string   `json:"ip"`  // The address peers most likely reach this device on
+	IPs  []string `json:"ips"` // Every address on the interfaces in use
 }
 
 // GetDeviceInfo returns the current device info
 func (a *App) GetDeviceInfo() DeviceInfo {
 	name := a.settings.DeviceName
 	if name == "" {
-		name = getHostname()
+		name = config.Hostname()
 	}
 
-	ip := getLocalIP()
-
-	return DeviceInfo{
-		Name: name,
-		IP:   ip,
+	info := DeviceInfo{Name: name, IP: "Unknown"}
+	for _, addr := range netutil.Addrs(a.interfaces) {
+		info.IPs = append(info.IPs, addr.String())
+	}
+	if len(info.IPs) > 0 {
+		info.IP = info.IPs[0]
 	}
+	return info
 }
 
-func getLocalIP() string {
-	addrs, err := net.InterfaceAddrs()
+// ListInterfaces returns the network interfaces that can be chosen in the
+// settings
+func (a *App) ListInterfaces() []netutil.Info {
+	infos, err := netutil.List()
 	if err != nil {
-		return "Unknown"
+		return nil
 	}
+	return infos
+}
 
-	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				return ipnet.IP.String()
-			}
-		}
-	}
-	return "Unknown"
+// otherAddresses returns addresses without address, for the Addresses
+// option of transfers that dial address first.
+func otherAddresses(addresses []string, address string) []string {
+	return slices.DeleteFunc(slices.Clone(addresses), func(a string) bool { return a == address })
 }
 
 // SelectFiles opens a file picker dialog and returns selected file paths
@@ -153,6 +204,24 @@ func walkDirSize(path string, total *int64) error {
 
 // StartSending starts the file sender for the given paths
 func (a *App) StartSending(filePaths []string) error {
+	return a.startSender(transfer.ShareName(filePaths), "", func(opts transfer.SenderOptions) error {
+		return transfer.StartSenderWithOptions(filePaths, opts)
+	})
+}
+
+// SendText starts sharing a text snippet
+func (a *App) SendText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("no text provided")
+	}
+	return a.startSender("Text snippet", text, func(opts transfer.SenderOptions) error {
+		return transfer.StartTextSender(text, opts)
+	})
+}
+
+// startSender runs a sender in the background and waits for it to listen.
+// label names the share in history; text is recorded for snippet shares.
+func (a *App) startSender(label string, text string, start func(transfer.SenderOptions) error) error {
 	a.senderMu.Lock()
 	if a.isSending {
 		a.senderMu.Unlock()
@@ -168,13 +237,20 @@ func (a *App) StartSending(filePaths []string) error {
 	a.senderMu.Unlock()
 
 	portChan := make(chan int, 1)
+	shareCode := transfer.NewShareCode()
 
 	go func() {
 		opts := transfer.SenderOptions{
 			AllowConn: func(addr string) bool {
 				return true
 			},
-			PortChan: portChan,
+			Name:        a.settings.DeviceName,
+			DeviceID:    a.deviceID,
+			Certificate: a.deviceCert,
+			PortChan:    portChan,
+			Interfaces:  a.interfaces,
+			Port:        a.settings.Port,
+			PortLast:    a.settings.PortLast,
 			OnProgress: func(info transfer.ProgressInfo) {
 				wailsRuntime.EventsEmit(a.ctx, "transfer:progress", map[string]interface{}{
 					"bytes_sent":  info.BytesSent,
@@ -187,8 +263,12 @@ func (a *App) StartSending(filePaths []string) error {
 			},
 			OnComplete: func(peerAddr string, fileName string) {
 				a.clearConn()
-				_ = addHistoryEntry(HistoryEntry{
+				if text != "" {
+					fileName = label
+				}
+				_ = config.AddHistoryEntry(config.HistoryEntry{
 					FileName:  fileName,
+					Text:      text,
 					Direction: "send",
 					PeerName:  peerAddr,
 					Status:    "completed",
@@ -201,12 +281,8 @@ func (a *App) StartSending(filePaths []string) error {
 			},
 			OnError: func(peerAddr string, err error) {
 				a.clearConn()
-				baseName := "Transfer"
-				if len(filePaths) > 0 {
-					baseName = filepath.Base(filePaths[0])
-				}
-				_ = addHistoryEntry(HistoryEntry{
-					FileName:  baseName,
+				_ = config.AddHistoryEntry(config.HistoryEntry{
+					FileName:  label,
 					Direction: "send",
 					PeerName:  peerAddr,
 					Status:    "failed",
@@ -218,17 +294,26 @@ func (a *App) StartSending(filePaths []string) error {
 					"direction": "send",
 				})
 			},
+			Code: shareCode,
+			OnListening: func(port int, fingerprint string) {
+				code := newShareCode(shareCode, transfer.NewConnectCode(a.interfaces, port, fingerprint))
+				a.senderMu.Lock()
+				a.shareCode = code
+				a.senderMu.Unlock()
+				wailsRuntime.EventsEmit(a.ctx, "sender:code", code)
+			},
 			OnTransferStart: a.setConn,
 			Ctx:             ctx,
 		}
 
-		if err := transfer.StartSenderWithOptions(filePaths, opts); err != nil {
+		if err := start(opts); err != nil {
 			wailsRuntime.EventsEmit(a.ctx, "sender:error", err.Error())
 		}
 
 		a.senderMu.Lock()
 		a.isSending = false
 		a.senderCancel = nil
+		a.shareCode = ShareCode{}
 		a.senderMu.Unlock()
 		wailsRuntime.EventsEmit(a.ctx, "sender:stopped", nil)
 	}()
@@ -295,53 +380,95 @@ func (a *App) GetSenderPort() int {
 	return a.senderPort
 }
 
-// PeerInfo holds discovered peer data
-type PeerInfo struct {
-	Name    string `json:"name"`
-	Address string `json:"address"`
-	Port    int    `json:"port"`
-	IP      string `json:"ip"`
+// ShareCode holds the codes receivers can use to reach the running share:
+// its share code, and its connection code for networks that block discovery.
+type ShareCode struct {
+	Words string `json:"words"` // Share code, such as 7-tiger-lamp-ocean
+	Code  string `json:"code"`  // Connection code
+	QR    string `json:"qr"`    // The connection code as a QR code, a PNG data URL
 }
 
-// ScanPeers discovers peers on the network
-func (a *App) ScanPeers() []PeerInfo {
-	entries := make(chan *zeroconf.ServiceEntry, 10)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func newShareCode(words string, code transfer.ConnectCode) ShareCode {
+	sc := ShareCode{Words: words, Code: code.String()}
+	if sc.Code == "" {
+		return sc
+	}
+	if img, err := qr.Encode(sc.Code, qr.L); err == nil {
+		img.Scale = 6
+		sc.QR = "data:image/png;base64," + base64.StdEncoding.EncodeToString(img.PNG())
+	}
+	return sc
+}
 
-	go func() {
-		_ = discovery.Browse(ctx, entries)
-	}()
+// GetShareCode returns the codes of the running share, empty while nothing
+// is shared.
+func (a *App) GetShareCode() ShareCode {
+	a.senderMu.Lock()
+	defer a.senderMu.Unlock()
+	return a.shareCode
+}
 
-	var peers []PeerInfo
-	for entry := range entries {
-		ip := ""
-		if len(entry.AddrIPv4) > 0 {
-			ip = entry.AddrIPv4[0].String()
+// ConnectToReceive connects to a peer to receive a file. addresses lists
+// every address of the peer, from PeerInfo.Addresses; they are all tried.
+// The peer's certificate is held to the fingerprint discovery or the address
+// book knows for it, if any; only the address book's is trusted.
+func (a *App) ConnectToReceive(address string, peerName string, addresses []string) error {
+	return a.receiveFrom(address, peerName, otherAddresses(addresses, address), a.knownFingerprint(address), "")
+}
+
+// ConnectWithCode receives from the share with the given share code, which
+// lets the download start without approval, or from a sender given by
+// host:port or by its connection code, for networks where it can't be
+// discovered. A connection code pins the sender's certificate.
+func (a *App) ConnectWithCode(code string) error {
+	// Addresses and connection codes have a colon; share codes don't.
+	if !strings.Contains(code, ":") {
+		words, err := transfer.ParseShareCode(code)
+		if err != nil {
+			return err
+		}
+		peer, ok := a.findShare(transfer.NewCodeMatcher(words))
+		if !ok {
+			return fmt.Errorf("no share with code %s found", words)
 		}
-		peers = append(peers, PeerInfo{
-			Name:    entry.Instance,
-			Address: fmt.Sprintf("%s:%d", ip, entry.Port),
-			Port:    entry.Port,
-			IP:      ip,
-		})
+		return a.receiveFrom(peer.Address, peer.Name, otherAddresses(peer.Addresses, peer.Address), peer.fingerprint, words)
 	}
 
-	return peers
+	c, err := transfer.ParseConnectCode(code)
+	if err != nil {
+		return err
+	}
+	return a.receiveFrom(c.Addresses[0], c.Addresses[0], c.Addresses[1:], c.Fingerprint, "")
 }
 
-// ConnectToReceive connects to a peer to receive a file
-func (a *App) ConnectToReceive(address string, peerName string) error {
+// receiveFrom downloads in the background from the sender at address,
+// falling back to others. It only accepts the sender with the given
+// certificate fingerprint, and authenticates with the share code, when set.
+func (a *App) receiveFrom(address, peerName string, others []string, fingerprint, code string) error {
 	downloadDir := a.settings.DownloadDir
 	if downloadDir == "" {
 		downloadDir = "received_files"
 	}
 
 	go func() {
+		// Files taken from a multi-file share, recorded in history
+		var taken []string
+		var takenSize int64
+		// Snippet received from a text share
+		var received string
+
 		opts := transfer.ReceiverOptions{
 			DownloadDir: downloadDir,
 			PeerName:    a.settings.DeviceName,
 			SenderName:  peerName,
+			SelectEntries: func(entries []transfer.ShareEntry) ([]string, error) {
+				selected, err := a.chooseEntries(peerName, entries)
+				if err != nil {
+					return nil, err
+				}
+				taken, takenSize = takenEntries(entries, selected)
+				return selected, nil
+			},
 			OnProgress: func(info transfer.ProgressInfo) {
 				wailsRuntime.EventsEmit(a.ctx, "transfer:progress", map[string]interface{}{
 					"bytes_sent":  info.BytesSent,
@@ -352,10 +479,23 @@ func (a *App) ConnectToReceive(address string, peerName string) error {
 					"direction":   "receive",
 				})
 			},
+			OnText: func(text string) {
+				received = text
+				wailsRuntime.EventsEmit(a.ctx, "transfer:text", map[string]interface{}{
+					"text":      text,
+					"peer_name": peerName,
+				})
+			},
 			OnComplete: func(fileName string) {
 				a.clearConn()
-				_ = addHistoryEntry(HistoryEntry{
+				if received != "" {
+					fileName = "Text snippet"
+				}
+				_ = config.AddHistoryEntry(config.HistoryEntry{
 					FileName:  fileName,
+					FileSize:  takenSize,
+					Files:     taken,
+					Text:      received,
 					Direction: "receive",
 					PeerName:  peerName,
 					Status:    "completed",
@@ -368,7 +508,7 @@ func (a *App) ConnectToReceive(address string, peerName string) error {
 			},
 			OnError: func(err error) {
 				a.clearConn()
-				_ = addHistoryEntry(HistoryEntry{
+				_ = config.AddHistoryEntry(config.HistoryEntry{
 					Direction: "receive",
 					PeerName:  peerName,
 					Status:    "failed",
@@ -381,6 +521,9 @@ func (a *App) ConnectToReceive(address string, peerName string) error {
 				})
 			},
 			OnTransferStart: a.setConn,
+			Addresses:       others,
+			Fingerprint:     fingerprint,
+			Code:            code,
 		}
 
 		if err := transfer.ReceiveConnectWithOptions(address, opts); err != nil {
@@ -393,23 +536,137 @@ func (a *App) ConnectToReceive(address string, peerName string) error {
 	return nil
 }
 
+// entryChoice is the user's answer to a transfer:listing event.
+type entryChoice struct {
+	paths []string
+	ok    bool
+}
+
+// selectionTimeout is how long a listing waits for the user to pick files.
+const selectionTimeout = 5 * time.Minute
+
+// chooseEntries asks the frontend which files of a multi-file share to
+// download and waits for SelectEntries or CancelSelection.
+func (a *App) chooseEntries(peerName string, entries []transfer.ShareEntry) ([]string, error) {
+	if len(entries) < 2 {
+		return nil, nil
+	}
+
+	answer := make(chan entryChoice, 1)
+	a.choiceMu.Lock()
+	a.choice = answer
+	a.choiceMu.Unlock()
+
+	defer func() {
+		a.choiceMu.Lock()
+		if a.choice == answer {
+			a.choice = nil
+		}
+		a.choiceMu.Unlock()
+	}()
+
+	wailsRuntime.EventsEmit(a.ctx, "transfer:listing", map[string]interface{}{
+		"peer_name": peerName,
+		"entries":   entries,
+	})
+
+	select {
+	case c := <-answer:
+		if !c.ok {
+			return nil, fmt.Errorf("download cancelled")
+		}
+		return c.paths, nil
+	case <-time.After(selectionTimeout):
+		wailsRuntime.EventsEmit(a.ctx, "transfer:listing-expired", nil)
+		return nil, fmt.Errorf("timed out waiting for file selection")
+	}
+}
+
+// takenEntries returns the paths and combined size of the entries a receiver
+// asked for; an empty selection takes the whole share.
+func takenEntries(entries []transfer.ShareEntry, selected []string) ([]string, int64) {
+	keep := make(map[string]bool, len(selected))
+	for _, p := range selected {
+		keep[p] = true
+	}
+
+	var paths []string
+	var size int64
+	for _, e := range entries {
+		if len(selected) == 0 || keep[e.Path] {
+			paths = append(paths, e.Path)
+			size += e.Size
+		}
+	}
+	return paths, size
+}
+
+// SelectEntries downloads only the given files of the pending share. An empty
+// list downloads everything.
+func (a *App) SelectEntries(paths []string) {
+	a.answerChoice(entryChoice{paths: paths, ok: true})
+}
+
+// CancelSelection aborts the pending download without fetching anything
+func (a *App) CancelSelection() {
+	a.answerChoice(entryChoice{})
+}
+
+func (a *App) answerChoice(c entryChoice) {
+	a.choiceMu.Lock()
+	defer a.choiceMu.Unlock()
+	if a.choice != nil {
+		a.choice <- c
+		a.choice = nil
+	}
+}
+
+// CopyToClipboard places text on the system clipboard
+func (a *App) CopyToClipboard(text string) error {
+	return wailsRuntime.ClipboardSetText(a.ctx, text)
+}
+
 // GetTransferHistory returns the transfer history
-func (a *App) GetTransferHistory() []HistoryEntry {
-	return loadHistory()
+func (a *App) GetTransferHistory() []config.HistoryEntry {
+	return config.LoadHistory()
 }
 
 // GetSettings returns current settings
-func (a *App) GetSettings() Settings {
+func (a *App) GetSettings() config.Settings {
 	return a.settings
 }
 
 // SaveSettings saves settings
-func (a *App) SaveSettings(s Settings) error {
-	if err := saveSettings(s); err != nil {
+func (a *App) SaveSettings(s config.Settings) error {
+	if _, err := netutil.Interfaces(s.Interfaces); err != nil {
+		return err
+	}
+	if err := config.SaveSettings(s); err != nil {
 		return err
 	}
 	a.settings = s
-	return nil
+	return a.useInterfaces(s.Interfaces)
+}
+
+// GetAddressBook returns the saved peers, which discovery lists next to the
+// ones found on the network.
+func (a *App) GetAddressBook() ([]config.Contact, error) {
+	contacts, err := config.LoadAddressBook()
+	if contacts == nil {
+		contacts = []config.Contact{}
+	}
+	return contacts, err
+}
+
+// SaveContact adds c to the address book, or replaces the contact named
+// previous, when set, with it.
+func (a *App) SaveContact(previous string, c config.Contact) error {
+	return config.SaveContact(previous, c)
+}
+
+// RemoveContact deletes the contact named name from the address book.
+func (a *App) RemoveContact(name string) error {
+	return config.RemoveContact(name)
 }
 
 // SelectDownloadDir opens a folder dialog for download directory
@@ -0,0 +1,188 @@
+package gui
+
+import (
+	"context"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// PeerInfo holds discovered peer data
+type PeerInfo struct {
+	ID        string                  `json:"id"` // Stable across renames; the key for peer events
+	Name      string                  `json:"name"`
+	Address   string                  `json:"address"`   // Preferred address for display, as host:port
+	Addresses []string                `json:"addresses"` // Every address, in the order to dial them
+	Port      int                     `json:"port"`
+	IP        string                  `json:"ip"`
+	IPs       []string                `json:"ips"` // IPv4 and IPv6 addresses, with zones for link-local ones
+	OS        string                  `json:"os,omitempty"`
+	Share     *discovery.ShareSummary `json:"share,omitempty"`
+	Summary   string                  `json:"summary,omitempty"` // Share described in a few words
+	Saved     bool                    `json:"saved"`             // From the address book rather than found on the network
+
+	fingerprint string // Certificate fingerprint the peer advertises, to connect to that peer only
+	codeTag     string // Keyed hash of the share code, to find it by code
+}
+
+func peerInfo(p discovery.Peer) PeerInfo {
+	info := PeerInfo{
+		ID:        p.Key(),
+		Name:      p.Label(),
+		Addresses: p.HostPorts(),
+		Port:      p.Port,
+		OS:        p.OS,
+		Share:     p.Share,
+		Saved:     p.Saved,
+
+		fingerprint: p.Fingerprint,
+		codeTag:     p.CodeTag,
+	}
+	for _, addr := range p.Addresses() {
+		info.IPs = append(info.IPs, addr.String())
+	}
+	if len(info.IPs) > 0 {
+		info.IP = info.IPs[0]
+		info.Address = net.JoinHostPort(info.IP, strconv.Itoa(p.Port))
+	}
+	if p.Share != nil {
+		info.Summary = p.Share.String()
+	}
+	return info
+}
+
+// discoverySession is the background peer discovery run by StartDiscovery.
+type discoverySession struct {
+	cancel context.CancelFunc
+	peers  map[string]PeerInfo // By ID
+}
+
+// StartDiscovery starts looking for peers in the background, unless it is
+// already running, and returns the peers found so far. Changes are reported
+// with the peer:added, peer:updated and peer:removed events, which carry a
+// PeerInfo.
+func (a *App) StartDiscovery() []PeerInfo {
+	a.discoveryMu.Lock()
+	defer a.discoveryMu.Unlock()
+
+	if a.discovery == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		a.discovery = &discoverySession{cancel: cancel, peers: make(map[string]PeerInfo)}
+		go a.watchPeers(ctx, a.discovery)
+	}
+
+	peers := slices.Collect(maps.Values(a.discovery.peers))
+	slices.SortFunc(peers, func(x, y PeerInfo) int { return strings.Compare(x.Name, y.Name) })
+	return peers
+}
+
+// StopDiscovery stops the discovery started by StartDiscovery.
+func (a *App) StopDiscovery() {
+	a.discoveryMu.Lock()
+	defer a.discoveryMu.Unlock()
+
+	if a.discovery != nil {
+		a.discovery.cancel()
+		a.discovery = nil
+	}
+}
+
+func (a *App) watchPeers(ctx context.Context, s *discoverySession) {
+	events := make(chan discovery.PeerEvent)
+	go func() {
+		if err := discovery.Watch(ctx, events); err != nil {
+			wailsRuntime.EventsEmit(a.ctx, "discovery:error", err.Error())
+		}
+	}()
+
+	for ev := range events {
+		info := peerInfo(ev.Peer)
+
+		a.discoveryMu.Lock()
+		if a.discovery != s {
+			// Stopped; drain the events so Watch can return.
+			a.discoveryMu.Unlock()
+			continue
+		}
+		if ev.Type == discovery.PeerRemoved {
+			delete(s.peers, info.ID)
+		} else {
+			s.peers[info.ID] = info
+		}
+		a.discoveryMu.Unlock()
+
+		wailsRuntime.EventsEmit(a.ctx, "peer:"+string(ev.Type), info)
+	}
+
+	// If Watch failed rather than being stopped, let the next
+	// StartDiscovery try again.
+	a.discoveryMu.Lock()
+	if a.discovery == s {
+		a.discovery = nil
+	}
+	a.discoveryMu.Unlock()
+}
+
+// findShare returns the peer announcing the share code codes matches, among
+// the peers found by StartDiscovery or, failing that, by a fresh scan.
+func (a *App) findShare(codes *transfer.CodeMatcher) (PeerInfo, bool) {
+	match := func(p PeerInfo) bool { return codes.Matches(p.codeTag, p.fingerprint) }
+
+	a.discoveryMu.Lock()
+	var known []PeerInfo
+	if a.discovery != nil {
+		known = slices.Collect(maps.Values(a.discovery.peers))
+	}
+	a.discoveryMu.Unlock()
+
+	if i := slices.IndexFunc(known, match); i >= 0 {
+		return known[i], true
+	}
+	scanned := scanPeers(discovery.Browse)
+	if i := slices.IndexFunc(scanned, match); i >= 0 {
+		return scanned[i], true
+	}
+	return PeerInfo{}, false
+}
+
+// knownFingerprint returns the certificate fingerprint of the peer found
+// at address by discovery or ScanInboxes, or "" if there is none.
+func (a *App) knownFingerprint(address string) string {
+	a.discoveryMu.Lock()
+	defer a.discoveryMu.Unlock()
+
+	known := slices.Clone(a.inboxes)
+	if a.discovery != nil {
+		known = slices.AppendSeq(known, maps.Values(a.discovery.peers))
+	}
+	for _, p := range known {
+		if slices.Contains(p.Addresses, address) {
+			return p.fingerprint
+		}
+	}
+	return ""
+}
+
+func scanPeers(browse func(context.Context, chan<- discovery.Peer) error) []PeerInfo {
+	found := make(chan discovery.Peer, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	go func() {
+		_ = browse(ctx, found)
+	}()
+
+	var peers []PeerInfo
+	for peer := range found {
+		peers = append(peers, peerInfo(peer))
+	}
+
+	return peers
+}
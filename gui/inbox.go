@@ -0,0 +1,252 @@
+package gui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/example/synapse/internal/config"
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// offerPromptTimeout is how long an incoming offer waits for the user before it is declined.
+const offerPromptTimeout = 60 * time.Second
+
+// StartInbox starts the always-on inbox so peers can push files to this device
+func (a *App) StartInbox() error {
+	a.inboxMu.Lock()
+	if a.inboxCancel != nil {
+		a.inboxMu.Unlock()
+		return fmt.Errorf("inbox already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.inboxCancel = cancel
+	a.inboxMu.Unlock()
+
+	portChan := make(chan int, 1)
+
+	go func() {
+		opts := transfer.InboxOptions{
+			DownloadDir: a.settings.DownloadDir,
+			PeerName:    a.settings.DeviceName,
+			DeviceID:    a.deviceID,
+			Certificate: a.deviceCert,
+			AcceptOffer: a.promptOffer,
+			PortChan:    portChan,
+			Interfaces:  a.interfaces,
+			Port:        a.settings.Port,
+			PortLast:    a.settings.PortLast,
+			OnProgress: func(info transfer.ProgressInfo) {
+				wailsRuntime.EventsEmit(a.ctx, "transfer:progress", map[string]interface{}{
+					"bytes_sent":  info.BytesSent,
+					"total_bytes": info.TotalBytes,
+					"file_name":   info.FileName,
+					"peer_addr":   info.PeerAddr,
+					"peer_name":   info.PeerName,
+					"direction":   "receive",
+				})
+			},
+			OnComplete: func(senderName string, fileName string) {
+				a.clearConn()
+				_ = config.AddHistoryEntry(config.HistoryEntry{
+					FileName:  fileName,
+					Direction: "receive",
+					PeerName:  senderName,
+					Status:    "completed",
+				})
+				wailsRuntime.EventsEmit(a.ctx, "transfer:complete", map[string]interface{}{
+					"file_name": fileName,
+					"peer_addr": senderName,
+					"direction": "receive",
+				})
+			},
+			OnError: func(senderName string, err error) {
+				a.clearConn()
+				_ = config.AddHistoryEntry(config.HistoryEntry{
+					Direction: "receive",
+					PeerName:  senderName,
+					Status:    "failed",
+					Error:     err.Error(),
+				})
+				wailsRuntime.EventsEmit(a.ctx, "transfer:error", map[string]interface{}{
+					"error":     err.Error(),
+					"peer_addr": senderName,
+					"direction": "receive",
+				})
+			},
+			OnTransferStart: a.setConn,
+			Ctx:             ctx,
+		}
+
+		if err := transfer.StartInbox(opts); err != nil {
+			wailsRuntime.EventsEmit(a.ctx, "inbox:error", err.Error())
+		}
+
+		a.inboxMu.Lock()
+		a.inboxCancel = nil
+		a.inboxMu.Unlock()
+		wailsRuntime.EventsEmit(a.ctx, "inbox:stopped", nil)
+	}()
+
+	select {
+	case port := <-portChan:
+		wailsRuntime.EventsEmit(a.ctx, "inbox:started", port)
+		return nil
+	case <-time.After(5 * time.Second):
+		cancel()
+		return fmt.Errorf("timeout waiting for inbox to start")
+	}
+}
+
+// StopInbox stops the inbox listener
+func (a *App) StopInbox() {
+	a.inboxMu.Lock()
+	defer a.inboxMu.Unlock()
+
+	if a.inboxCancel != nil {
+		a.inboxCancel()
+		a.inboxCancel = nil
+	}
+}
+
+// IsInboxRunning returns whether the inbox is accepting pushed files
+func (a *App) IsInboxRunning() bool {
+	a.inboxMu.Lock()
+	defer a.inboxMu.Unlock()
+	return a.inboxCancel != nil
+}
+
+// promptOffer asks the frontend to accept or decline an incoming offer and
+// waits for RespondToOffer. Offers are accepted without asking when
+// auto-accept is enabled.
+func (a *App) promptOffer(peerAddr string, offer transfer.Offer) bool {
+	if a.settings.AutoAccept {
+		return true
+	}
+
+	answer := make(chan bool, 1)
+
+	a.inboxMu.Lock()
+	a.offerSeq++
+	id := strconv.Itoa(a.offerSeq)
+	a.offers[id] = answer
+	a.inboxMu.Unlock()
+
+	defer func() {
+		a.inboxMu.Lock()
+		delete(a.offers, id)
+		a.inboxMu.Unlock()
+	}()
+
+	wailsRuntime.EventsEmit(a.ctx, "inbox:offer", map[string]interface{}{
+		"id":          id,
+		"sender_name": offer.SenderName,
+		"peer_addr":   peerAddr,
+		"files":       offer.Files,
+		"total_size":  offer.TotalSize,
+	})
+
+	select {
+	case accepted := <-answer:
+		return accepted
+	case <-time.After(offerPromptTimeout):
+		wailsRuntime.EventsEmit(a.ctx, "inbox:offer-expired", id)
+		return false
+	}
+}
+
+// RespondToOffer accepts or declines a pending inbox offer
+func (a *App) RespondToOffer(id string, accept bool) {
+	a.inboxMu.Lock()
+	answer, ok := a.offers[id]
+	a.inboxMu.Unlock()
+
+	if !ok {
+		return
+	}
+	// Only the first answer counts; the channel holds one.
+	select {
+	case answer <- accept:
+	default:
+	}
+}
+
+// ScanInboxes discovers peers running an inbox
+func (a *App) ScanInboxes() []PeerInfo {
+	inboxes := scanPeers(discovery.BrowseInboxes)
+	a.discoveryMu.Lock()
+	a.inboxes = inboxes
+	a.discoveryMu.Unlock()
+	return inboxes
+}
+
+// PushToInbox sends the given paths to a peer's inbox. addresses lists every
+// address of the inbox, from PeerInfo.Addresses; they are all tried.
+func (a *App) PushToInbox(address string, peerName string, filePaths []string, addresses []string) error {
+	if len(filePaths) == 0 {
+		return fmt.Errorf("no files selected")
+	}
+	fingerprint := a.knownFingerprint(address)
+
+	go func() {
+		opts := transfer.SenderOptions{
+			Name: a.settings.DeviceName,
+			OnProgress: func(info transfer.ProgressInfo) {
+				wailsRuntime.EventsEmit(a.ctx, "transfer:progress", map[string]interface{}{
+					"bytes_sent":  info.BytesSent,
+					"total_bytes": info.TotalBytes,
+					"file_name":   info.FileName,
+					"peer_addr":   info.PeerAddr,
+					"peer_name":   peerName,
+					"direction":   "send",
+				})
+			},
+			OnComplete: func(_ string, fileName string) {
+				a.clearConn()
+				_ = config.AddHistoryEntry(config.HistoryEntry{
+					FileName:  fileName,
+					Direction: "send",
+					PeerName:  peerName,
+					Status:    "completed",
+				})
+				wailsRuntime.EventsEmit(a.ctx, "transfer:complete", map[string]interface{}{
+					"file_name": fileName,
+					"peer_addr": peerName,
+					"direction": "send",
+				})
+			},
+			OnTransferStart: a.setConn,
+			Addresses:       otherAddresses(addresses, address),
+			Fingerprint:     fingerprint,
+		}
+
+		err := transfer.PushToInbox(address, filePaths, opts)
+		if err == nil {
+			return
+		}
+		a.clearConn()
+
+		status := "failed"
+		if errors.Is(err, transfer.ErrOfferDeclined) {
+			status = "declined"
+		}
+		_ = config.AddHistoryEntry(config.HistoryEntry{
+			FileName:  transfer.ShareName(filePaths),
+			Direction: "send",
+			PeerName:  peerName,
+			Status:    status,
+			Error:     err.Error(),
+		})
+		wailsRuntime.EventsEmit(a.ctx, "transfer:error", map[string]interface{}{
+			"error":     err.Error(),
+			"peer_addr": peerName,
+			"direction": "send",
+		})
+	}()
+
+	return nil
+}
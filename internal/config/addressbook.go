@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
+)
+
+// addressBookFileName is the static peers file discovery reads, so that
+// saved peers are listed next to the ones found on the network.
+const addressBookFileName = "peers.json"
+
+// Contact is an address book entry: a peer at a known address, such as a
+// server on a subnet discovery can't reach.
+type Contact = discovery.StaticPeer
+
+var (
+	// ErrNoContact is returned when the address book has no entry by a name.
+	ErrNoContact = errors.New("no such contact")
+	// ErrInvalidContact is returned when a contact can't be saved as given.
+	ErrInvalidContact = errors.New("invalid contact")
+)
+
+// addressBookMu serializes address book updates within this process;
+// lockFile does the same across processes.
+var addressBookMu sync.Mutex
+
+// AddressBookPath returns the path of the address book file.
+func AddressBookPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config dir: %w", err)
+	}
+	return filepath.Join(dir, addressBookFileName), nil
+}
+
+// LoadAddressBook returns the saved contacts, in the order they were added.
+func LoadAddressBook() ([]Contact, error) {
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+	return readAddressBook()
+}
+
+// SaveContact adds c to the address book, or replaces the entry named
+// previous with it when previous is not empty, so that a contact can be
+// renamed. Names are unique, regardless of case.
+func SaveContact(previous string, c Contact) error {
+	c, err := normalizeContact(c)
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidContact, c.Name, err)
+	}
+
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+	unlock, err := lockFile(addressBookFileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	contacts, err := readAddressBook()
+	if err != nil {
+		return err
+	}
+	i := -1
+	if previous != "" {
+		if i = contactIndex(contacts, previous); i < 0 {
+			return fmt.Errorf("%w: %s", ErrNoContact, previous)
+		}
+	}
+	if j := contactIndex(contacts, c.Name); j >= 0 && j != i {
+		return fmt.Errorf("%w %q: the name is taken by another contact", ErrInvalidContact, c.Name)
+	}
+	if i < 0 {
+		contacts = append(contacts, c)
+	} else {
+		contacts[i] = c
+	}
+	return saveAddressBook(contacts)
+}
+
+// RemoveContact deletes the entry named name from the address book.
+func RemoveContact(name string) error {
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+	unlock, err := lockFile(addressBookFileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	contacts, err := readAddressBook()
+	if err != nil {
+		return err
+	}
+	i := contactIndex(contacts, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNoContact, name)
+	}
+	return saveAddressBook(slices.Delete(contacts, i, i+1))
+}
+
+// normalizeContact trims c's fields and checks that it can be connected to.
+func normalizeContact(c Contact) (Contact, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return c, fmt.Errorf("no name")
+	}
+
+	var addrs []string
+	for _, addr := range c.Addresses {
+		if addr = strings.TrimSpace(addr); addr != "" && !slices.Contains(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return c, fmt.Errorf("no address")
+	}
+	c.Addresses = addrs
+
+	if c.Port < 1 || c.Port > 65535 {
+		return c, fmt.Errorf("port %d is out of range", c.Port)
+	}
+
+	fp := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(c.Fingerprint), ":", ""))
+	if fp != "" && !transfer.IsFingerprint(fp) {
+		return c, fmt.Errorf("the fingerprint must be at least %d hex digits", transfer.MinFingerprintPrefix)
+	}
+	c.Fingerprint = fp
+
+	c.Notes = strings.TrimSpace(c.Notes)
+	return c, nil
+}
+
+func contactIndex(contacts []Contact, name string) int {
+	return slices.IndexFunc(contacts, func(c Contact) bool {
+		return strings.EqualFold(c.Name, strings.TrimSpace(name))
+	})
+}
+
+func readAddressBook() ([]Contact, error) {
+	path, err := AddressBookPath()
+	if err != nil {
+		return nil, err
+	}
+	return discovery.ReadStaticPeers(path)
+}
+
+func saveAddressBook(contacts []Contact) error {
+	path, err := AddressBookPath()
+	if err != nil {
+		return err
+	}
+
+	if contacts == nil {
+		contacts = []Contact{}
+	}
+	data, err := json.MarshalIndent(contacts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal address book: %w", err)
+	}
+
+	return writeFile(path, data)
+}
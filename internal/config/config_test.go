@@ -0,0 +1,327 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/example/synapse/internal/discovery"
+)
+
+// useTempHome points the configuration directory at a fresh temporary one.
+func useTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir, err := Dir()
+	if err != nil {
+		t.Fatalf("Dir failed: %v", err)
+	}
+	return dir
+}
+
+func TestSettingsPortRange(t *testing.T) {
+	tests := []struct {
+		value          string
+		port, portLast int
+		want           string
+	}{
+		{"4242", 4242, 0, "4242"},
+		{"4242-4250", 4242, 4250, "4242-4250"},
+		{" 4242 - 4250 ", 4242, 4250, "4242-4250"},
+		{"4242-4242", 4242, 0, "4242"},
+		{"0", 0, 0, "0"},
+		{"", 0, 0, "0"},
+	}
+	for _, tt := range tests {
+		s := Settings{Port: 1, PortLast: 2}
+		if err := s.Set("port", tt.value); err != nil {
+			t.Errorf("Set(port, %q) failed: %v", tt.value, err)
+			continue
+		}
+		if s.Port != tt.port || s.PortLast != tt.portLast {
+			t.Errorf("Set(port, %q) = %d-%d, want %d-%d", tt.value, s.Port, s.PortLast, tt.port, tt.portLast)
+		}
+		if got, err := s.Get("port"); err != nil || got != tt.want {
+			t.Errorf("Get(port) after Set(port, %q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"abc", "70000", "4250-4242", "4242-", "-4242", "1-2-3"} {
+		s := Settings{Port: 4242, PortLast: 4250}
+		if err := s.Set("port", value); err == nil {
+			t.Errorf("Set(port, %q) succeeded, want an error", value)
+		}
+		if s.Port != 4242 || s.PortLast != 4250 {
+			t.Errorf("Set(port, %q) changed the setting to %d-%d", value, s.Port, s.PortLast)
+		}
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	entries := []HistoryEntry{
+		{ID: "1", PeerName: "Alice's Laptop", Direction: DirectionSend, Status: StatusCompleted},
+		{ID: "2", PeerName: "bob", Direction: DirectionReceive, Status: StatusFailed},
+		{ID: "3", PeerName: "ALICE phone", Direction: DirectionReceive, Status: StatusCompleted},
+		{ID: "4", PeerName: "carol", Direction: DirectionSend, Status: StatusDeclined},
+		{ID: "5", PeerName: "alice", Direction: DirectionReceive, Status: StatusCompleted},
+	}
+
+	tests := []struct {
+		name   string
+		filter HistoryFilter
+		want   []string
+	}{
+		{"none", HistoryFilter{}, []string{"1", "2", "3", "4", "5"}},
+		{"peer ignores case", HistoryFilter{Peer: "alice"}, []string{"1", "3", "5"}},
+		{"direction", HistoryFilter{Direction: DirectionSend}, []string{"1", "4"}},
+		{"status", HistoryFilter{Status: StatusCompleted}, []string{"1", "3", "5"}},
+		{"combined", HistoryFilter{Peer: "Alice", Direction: DirectionReceive, Status: StatusCompleted}, []string{"3", "5"}},
+		{"limit", HistoryFilter{Limit: 2}, []string{"1", "2"}},
+		{"limit after filtering", HistoryFilter{Direction: DirectionReceive, Limit: 2}, []string{"2", "3"}},
+		{"no match", HistoryFilter{Peer: "dave"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range tt.filter.Filter(entries) {
+			got = append(got, e.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLockFileStaleLock(t *testing.T) {
+	dir := useTempHome(t)
+	lockPath := filepath.Join(dir, historyFileName+".lock")
+
+	// A lock left behind by a process that died is taken over.
+	if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatalf("Failed to create lock file: %v", err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatalf("Failed to age lock file: %v", err)
+	}
+	start := time.Now()
+	if err := AddHistoryEntry(HistoryEntry{FileName: "a.txt", Direction: DirectionSend, Status: StatusCompleted}); err != nil {
+		t.Fatalf("AddHistoryEntry with a stale lock failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= lockWait {
+		t.Errorf("AddHistoryEntry waited %v for a stale lock", elapsed)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("Lock file left behind: %v", err)
+	}
+	if entries := LoadHistory(); len(entries) != 1 || entries[0].FileName != "a.txt" {
+		t.Errorf("History = %+v, want the new entry", entries)
+	}
+
+	// A lock another process is holding is waited for, then given up on.
+	unlock, err := lockFile(historyFileName)
+	if err != nil {
+		t.Fatalf("lockFile failed: %v", err)
+	}
+	if _, err := lockFile(historyFileName); err == nil {
+		t.Error("lockFile succeeded while the lock was held")
+	}
+	unlock()
+	unlock, err = lockFile(historyFileName)
+	if err != nil {
+		t.Fatalf("lockFile after unlock failed: %v", err)
+	}
+	unlock()
+}
+
+func TestDeviceCertificate(t *testing.T) {
+	dir := useTempHome(t)
+
+	first, err := DeviceCertificate()
+	if err != nil {
+		t.Fatalf("DeviceCertificate failed: %v", err)
+	}
+	// The certificate is kept, so its fingerprint survives a restart.
+	second, err := DeviceCertificate()
+	if err != nil {
+		t.Fatalf("DeviceCertificate failed the second time: %v", err)
+	}
+	if !bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Error("DeviceCertificate returned a new certificate the second time")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, deviceCertFileName))
+	if err != nil {
+		t.Fatalf("Certificate file not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Certificate file mode = %v, want 0600 for the private key", perm)
+	}
+}
+
+func TestNormalizeContact(t *testing.T) {
+	fp := "3F:1C:9A:0B:7E:2D:4C:68:11:D2:A7:E0:9C:5B:43:F8"
+	c, err := normalizeContact(Contact{
+		Name:        "  buildbox ",
+		Addresses:   []string{" 10.0.0.5", "", "10.0.0.5", "buildbox.lan "},
+		Port:        4242,
+		Fingerprint: " " + fp,
+		Notes:       " rack 3 ",
+	})
+	if err != nil {
+		t.Fatalf("normalizeContact failed: %v", err)
+	}
+	want := Contact{
+		Name:        "buildbox",
+		Addresses:   []string{"10.0.0.5", "buildbox.lan"},
+		Port:        4242,
+		Fingerprint: "3f1c9a0b7e2d4c6811d2a7e09c5b43f8",
+		Notes:       "rack 3",
+	}
+	if c.Name != want.Name || !slices.Equal(c.Addresses, want.Addresses) || c.Port != want.Port ||
+		c.Fingerprint != want.Fingerprint || c.Notes != want.Notes {
+		t.Errorf("normalizeContact = %+v, want %+v", c, want)
+	}
+
+	valid := Contact{Name: "buildbox", Addresses: []string{"10.0.0.5"}, Port: 4242}
+	tests := []struct {
+		name   string
+		modify func(*Contact)
+	}{
+		{"no name", func(c *Contact) { c.Name = "  " }},
+		{"no address", func(c *Contact) { c.Addresses = []string{" ", ""} }},
+		{"port zero", func(c *Contact) { c.Port = 0 }},
+		{"port too high", func(c *Contact) { c.Port = 65536 }},
+		{"short fingerprint", func(c *Contact) { c.Fingerprint = "3f1c9a0b" }},
+		{"fingerprint not hex", func(c *Contact) { c.Fingerprint = "zz1c9a0b7e2d4c6811d2a7e09c5b43f8" }},
+	}
+	for _, tt := range tests {
+		c := valid
+		c.Addresses = slices.Clone(valid.Addresses)
+		tt.modify(&c)
+		if _, err := normalizeContact(c); err == nil {
+			t.Errorf("%s: normalizeContact accepted %+v", tt.name, c)
+		}
+	}
+}
+
+func TestSaveContact(t *testing.T) {
+	useTempHome(t)
+	contact := func(name string) Contact {
+		return Contact{Name: name, Addresses: []string{"10.0.0.5"}, Port: 4242}
+	}
+	names := func() []string {
+		contacts, err := LoadAddressBook()
+		if err != nil {
+			t.Fatalf("LoadAddressBook failed: %v", err)
+		}
+		var names []string
+		for _, c := range contacts {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	for _, name := range []string{"Build Box", "NAS"} {
+		if err := SaveContact("", contact(name)); err != nil {
+			t.Fatalf("SaveContact(%s) failed: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		previous string
+		contact  Contact
+		want     error
+	}{
+		{"name taken, ignoring case", "", contact("build box"), ErrInvalidContact},
+		{"rename onto another contact", "nas", contact("BUILD BOX"), ErrInvalidContact},
+		{"rename a missing contact", "ghost", contact("Ghost"), ErrNoContact},
+		{"invalid contact", "", Contact{Name: "NoAddress", Port: 4242}, ErrInvalidContact},
+		// Renaming a contact to itself, in other case, doesn't conflict.
+		{"change case of own name", "build box", contact("BuildBox"), nil},
+		{"rename", "NAS", contact("Storage"), nil},
+	}
+	for _, tt := range tests {
+		err := SaveContact(tt.previous, tt.contact)
+		if tt.want == nil && err != nil {
+			t.Errorf("%s: SaveContact failed: %v", tt.name, err)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: SaveContact returned %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if got, want := names(), []string{"BuildBox", "Storage"}; !slices.Equal(got, want) {
+		t.Errorf("Address book = %v, want %v", got, want)
+	}
+
+	if err := RemoveContact("ghost"); !errors.Is(err, ErrNoContact) {
+		t.Errorf("RemoveContact of a missing contact returned %v, want ErrNoContact", err)
+	}
+	if err := RemoveContact("storage"); err != nil {
+		t.Errorf("RemoveContact failed: %v", err)
+	}
+	if got := names(); !slices.Equal(got, []string{"BuildBox"}) {
+		t.Errorf("Address book after removal = %v, want [BuildBox]", got)
+	}
+}
+
+func TestStaticFilePeers(t *testing.T) {
+	useTempHome(t)
+	fp := "3f1c9a0b7e2d4c6811d2a7e09c5b43f8"
+	contacts := []Contact{
+		{Name: "buildbox", Addresses: []string{"10.0.0.5", "fd00::5", "10.0.0.5"}, Port: 4242, Fingerprint: fp},
+		{Name: "nas", Addresses: []string{"10.0.0.6"}, Port: 4243, Inbox: true},
+	}
+	for _, c := range contacts {
+		if err := SaveContact("", c); err != nil {
+			t.Fatalf("SaveContact(%s) failed: %v", c.Name, err)
+		}
+	}
+	path, err := AddressBookPath()
+	if err != nil {
+		t.Fatalf("AddressBookPath failed: %v", err)
+	}
+
+	discover := func(f discovery.StaticFile, service string) []discovery.Peer {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var peers []discovery.Peer
+		if err := f.Discover(ctx, service, func(p discovery.Peer) {
+			peers = append(peers, p)
+		}); err != nil {
+			t.Fatalf("Discover failed: %v", err)
+		}
+		return peers
+	}
+
+	book := discovery.StaticFile{Path: path}
+	shares := discover(book, discovery.Service)
+	if len(shares) != 1 {
+		t.Fatalf("Discover found %d shares, want 1: %+v", len(shares), shares)
+	}
+	p := shares[0]
+	if p.Label() != "buildbox" || p.Port != 4242 || p.Fingerprint != fp || !p.Saved || p.TTL <= 0 {
+		t.Errorf("Discover returned %+v", p)
+	}
+	if len(p.IPv4) != 1 || !p.IPv4[0].Equal(net.ParseIP("10.0.0.5")) ||
+		len(p.IPv6) != 1 || !p.IPv6[0].Equal(net.ParseIP("fd00::5")) {
+		t.Errorf("Discover returned addresses %v %v, want 10.0.0.5 and fd00::5", p.IPv4, p.IPv6)
+	}
+
+	inboxes := discover(book, discovery.InboxService)
+	if len(inboxes) != 1 || inboxes[0].Label() != "nas" || inboxes[0].Port != 4243 {
+		t.Errorf("Discover found inboxes %+v, want nas", inboxes)
+	}
+
+	// A missing file lists no peers.
+	if peers := discover(discovery.StaticFile{Path: path + ".missing"}, discovery.Service); len(peers) != 0 {
+		t.Error("Discover found peers in a missing file")
+	}
+}
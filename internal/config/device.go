@@ -0,0 +1,100 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/example/synapse/internal/transfer"
+)
+
+const (
+	deviceIDFileName = "device_id"
+	// deviceCertFileName holds the device certificate and its private key,
+	// PEM-encoded.
+	deviceCertFileName = "device.pem"
+)
+
+// DeviceID returns the random identifier of this device, creating it on
+// first use. Unlike the device name it never changes, so peers can tell a
+// renamed device from a new one.
+func DeviceID() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config dir: %w", err)
+	}
+	path := filepath.Join(dir, deviceIDFileName)
+	if id := readDeviceID(path); id != "" {
+		return id, nil
+	}
+
+	// The desktop app and the CLI may both start for the first time at once.
+	unlock, err := lockFile(deviceIDFileName)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if id := readDeviceID(path); id != "" {
+		return id, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate device ID: %w", err)
+	}
+	id := hex.EncodeToString(b)
+	if err := writeFile(path, []byte(id+"\n")); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func readDeviceID(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// DeviceCertificate returns the TLS certificate this device presents on its
+// shares and inboxes, creating it on first use. It is kept across restarts,
+// so peers that pin its fingerprint, such as address book entries, keep
+// recognizing the device.
+func DeviceCertificate() (tls.Certificate, error) {
+	dir, err := Dir()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to get config dir: %w", err)
+	}
+	path := filepath.Join(dir, deviceCertFileName)
+	if cert, err := tls.LoadX509KeyPair(path, path); err == nil {
+		return cert, nil
+	}
+
+	unlock, err := lockFile(deviceCertFileName)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	defer unlock()
+
+	if cert, err := tls.LoadX509KeyPair(path, path); err == nil {
+		return cert, nil
+	}
+	certPEM, keyPEM, err := transfer.GenerateDeviceCertificate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	data := append(certPEM, keyPEM...)
+	if err := writeFileMode(path, data, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load device certificate: %w", err)
+	}
+	return cert, nil
+}
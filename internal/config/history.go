@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const historyFileName = "history.json"
+
+// maxHistoryEntries is how many records the history keeps.
+const maxHistoryEntries = 100
+
+// Values of HistoryEntry.Direction
+const (
+	DirectionSend    = "send"
+	DirectionReceive = "receive"
+)
+
+// Values of HistoryEntry.Status
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusDeclined  = "declined"
+)
+
+// HistoryEntry represents a single transfer record
+type HistoryEntry struct {
+	ID        string   `json:"id"`
+	FileName  string   `json:"file_name"`
+	FileSize  int64    `json:"file_size"`
+	Files     []string `json:"files,omitempty"` // Entries taken from a multi-file share
+	Text      string   `json:"text,omitempty"`  // Content of a text snippet
+	Direction string   `json:"direction"`       // "send" or "receive"
+	PeerName  string   `json:"peer_name"`
+	Status    string   `json:"status"` // "completed", "failed", "declined"
+	Error     string   `json:"error,omitempty"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// historyMu serializes history updates within this process; lockFile does
+// the same across processes.
+var historyMu sync.Mutex
+
+const (
+	// lockWait is how long AddHistoryEntry waits for another process to
+	// finish updating the history.
+	lockWait = 2 * time.Second
+	// lockStale is the age after which a leftover lock file is ignored.
+	lockStale = 10 * time.Second
+)
+
+// LoadHistory returns the recorded transfers, newest first.
+func LoadHistory() []HistoryEntry {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	return readHistory()
+}
+
+// AddHistoryEntry records a transfer, filling in its ID and timestamp if
+// they are empty. The file is re-read first, so entries written meanwhile
+// by another process (the desktop app or the CLI) are kept.
+func AddHistoryEntry(entry HistoryEntry) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if entry.ID == "" {
+		entry.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	if entry.Timestamp == "" {
+		entry.Timestamp = time.Now().Format(time.RFC3339)
+	}
+
+	unlock, err := lockFile(historyFileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries := append([]HistoryEntry{entry}, readHistory()...)
+	if len(entries) > maxHistoryEntries {
+		entries = entries[:maxHistoryEntries]
+	}
+
+	return saveHistory(entries)
+}
+
+// HistoryFilter selects history entries. Empty fields match everything.
+type HistoryFilter struct {
+	Peer      string // Text the peer name contains, regardless of case
+	Direction string
+	Status    string
+	Limit     int // Maximum number of entries; 0 keeps them all
+}
+
+// Filter returns the entries f matches, in their original order.
+func (f HistoryFilter) Filter(entries []HistoryEntry) []HistoryEntry {
+	var kept []HistoryEntry
+	for _, e := range entries {
+		if f.Peer != "" && !strings.Contains(strings.ToLower(e.PeerName), strings.ToLower(f.Peer)) {
+			continue
+		}
+		if f.Direction != "" && e.Direction != f.Direction {
+			continue
+		}
+		if f.Status != "" && e.Status != f.Status {
+			continue
+		}
+		kept = append(kept, e)
+		if f.Limit > 0 && len(kept) == f.Limit {
+			break
+		}
+	}
+	return kept
+}
+
+func readHistory() []HistoryEntry {
+	dir, err := Dir()
+	if err != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, historyFileName))
+	if err != nil {
+		return nil
+	}
+
+	var entries []HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil
+	}
+	return entries
+}
+
+func saveHistory(entries []HistoryEntry) error {
+	dir, err := Dir()
+	if err != nil {
+		return fmt.Errorf("failed to get config dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	return writeFile(filepath.Join(dir, historyFileName), data)
+}
+
+// lockFile takes an exclusive lock on name in the configuration directory by
+// creating name.lock, and returns the function that releases it.
+func lockFile(name string) (func(), error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config dir: %w", err)
+	}
+	path := filepath.Join(dir, name+".lock")
+
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock %s: %w", name, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock %s: another process is holding it", name)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,190 @@
+// Package config stores the settings and transfer history shared by the
+// desktop app and the CLI in ~/.config/synapse.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/example/synapse/internal/netutil"
+)
+
+const configFileName = "config.json"
+
+// Settings holds user configuration
+type Settings struct {
+	DownloadDir string `json:"download_dir"`
+	AutoAccept  bool   `json:"auto_accept"`
+	Port        int    `json:"port"`
+	PortLast    int    `json:"port_last,omitempty"` // Last port of a range starting at Port
+	DeviceName  string `json:"device_name"`
+
+	// Interfaces names the network interfaces to listen and announce on.
+	// Empty means the physical ones, leaving out virtual and VPN adapters.
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+// Keys lists the setting names accepted by Get and Set, in display order.
+var Keys = []string{"device_name", "download_dir", "auto_accept", "port", "interfaces"}
+
+// DefaultSettings returns the settings used when none have been saved.
+func DefaultSettings() Settings {
+	home, _ := os.UserHomeDir()
+	return Settings{
+		DownloadDir: filepath.Join(home, "Synapse-Downloads"),
+		AutoAccept:  false,
+		Port:        0, // 0 means random
+		DeviceName:  Hostname(),
+	}
+}
+
+// Hostname returns the machine's hostname, or a generic name if it is
+// unavailable.
+func Hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "My Device"
+	}
+	return name
+}
+
+// Dir returns the configuration directory, creating it if needed.
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".config", "synapse")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// LoadSettings reads the saved settings, falling back to the defaults.
+func LoadSettings() Settings {
+	dir, err := Dir()
+	if err != nil {
+		return DefaultSettings()
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, configFileName))
+	if err != nil {
+		return DefaultSettings()
+	}
+
+	var s Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return DefaultSettings()
+	}
+
+	// Set defaults for empty fields
+	if s.DownloadDir == "" {
+		s.DownloadDir = DefaultSettings().DownloadDir
+	}
+	if s.DeviceName == "" {
+		s.DeviceName = DefaultSettings().DeviceName
+	}
+
+	return s
+}
+
+// SaveSettings writes s to the configuration directory.
+func SaveSettings(s Settings) error {
+	dir, err := Dir()
+	if err != nil {
+		return fmt.Errorf("failed to get config dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+
+	return writeFile(filepath.Join(dir, configFileName), data)
+}
+
+// Get returns the value of the named setting as a string.
+func (s Settings) Get(key string) (string, error) {
+	switch key {
+	case "device_name":
+		return s.DeviceName, nil
+	case "download_dir":
+		return s.DownloadDir, nil
+	case "auto_accept":
+		return strconv.FormatBool(s.AutoAccept), nil
+	case "port":
+		return netutil.FormatPortRange(s.Port, s.PortLast), nil
+	case "interfaces":
+		return strings.Join(s.Interfaces, ","), nil
+	}
+	return "", fmt.Errorf("unknown setting %q", key)
+}
+
+// Set parses value and stores it in the named setting.
+func (s *Settings) Set(key, value string) error {
+	switch key {
+	case "device_name":
+		s.DeviceName = value
+	case "download_dir":
+		s.DownloadDir = value
+	case "auto_accept":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for auto_accept: %q is not true or false", value)
+		}
+		s.AutoAccept = b
+	case "port":
+		first, last, err := netutil.ParsePortRange(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for port: %q is not a port number or range such as 4242-4250", value)
+		}
+		s.Port, s.PortLast = first, 0
+		if last > first {
+			s.PortLast = last
+		}
+	case "interfaces":
+		// A comma-separated list; empty restores the default selection.
+		s.Interfaces = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				s.Interfaces = append(s.Interfaces, name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// writeFile replaces path with data in one step, so that the desktop app
+// and the CLI never read a half-written file.
+func writeFile(path string, data []byte) error {
+	return writeFileMode(path, data, 0644)
+}
+
+// writeFileMode is writeFile for files with other permissions, such as
+// private keys.
+func writeFileMode(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
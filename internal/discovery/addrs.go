@@ -0,0 +1,116 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+)
+
+// Addresses returns the peer's IPv4 addresses followed by its IPv6 ones.
+//
+// A link-local IPv6 address is only usable together with the interface it
+// is reachable on, and zeroconf doesn't say which interface an answer came
+// from. Such addresses are qualified with the zone of every local interface
+// that could lead to the peer: the one sharing an IPv4 subnet with it if
+// there is one, otherwise each interface with IPv6 link-local connectivity,
+// among those set with SetInterfaces.
+func (p Peer) Addresses() []net.IPAddr {
+	addrs := make([]net.IPAddr, 0, len(p.IPv4)+len(p.IPv6))
+	for _, ip := range p.IPv4 {
+		addrs = append(addrs, net.IPAddr{IP: ip})
+	}
+	var linkLocal []net.IP
+	for _, ip := range p.IPv6 {
+		if ip.IsLinkLocalUnicast() {
+			linkLocal = append(linkLocal, ip)
+		} else {
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+	}
+	if len(linkLocal) == 0 {
+		return addrs
+	}
+	// Link-local addresses come last, as their zones are only a guess.
+	zones := linkLocalZones(p.IPv4)
+	for _, ip := range linkLocal {
+		if len(zones) == 0 {
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+		for _, zone := range zones {
+			addrs = append(addrs, net.IPAddr{IP: ip, Zone: zone})
+		}
+	}
+	return addrs
+}
+
+// HostPorts returns the peer's addresses in host:port form, in the order to
+// dial them: IPv6 and IPv4 alternating, IPv6 first, as RFC 8305 suggests.
+func (p Peer) HostPorts() []string {
+	var v4, v6 []string
+	port := strconv.Itoa(p.Port)
+	for _, addr := range p.Addresses() {
+		hostPort := net.JoinHostPort(addr.String(), port)
+		if addr.IP.To4() != nil {
+			v4 = append(v4, hostPort)
+		} else {
+			v6 = append(v6, hostPort)
+		}
+	}
+	hostPorts := make([]string, 0, len(v4)+len(v6))
+	for i := 0; i < len(v4) || i < len(v6); i++ {
+		if i < len(v6) {
+			hostPorts = append(hostPorts, v6[i])
+		}
+		if i < len(v4) {
+			hostPorts = append(hostPorts, v4[i])
+		}
+	}
+	return hostPorts
+}
+
+// linkLocalZones returns the names of the interfaces a peer with the given
+// IPv4 addresses may be reached on over IPv6 link-local addresses.
+func linkLocalZones(peerIPv4 []net.IP) []string {
+	ifaces := interfaces()
+	if ifaces == nil {
+		var err error
+		if ifaces, err = net.Interfaces(); err != nil {
+			return nil
+		}
+	}
+	var all, shared []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		linkLocal, sameSubnet := false, false
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				linkLocal = true
+			}
+			for _, ip := range peerIPv4 {
+				if ipnet.Contains(ip) {
+					sameSubnet = true
+				}
+			}
+		}
+		if !linkLocal {
+			continue
+		}
+		all = append(all, iface.Name)
+		if sameSubnet {
+			shared = append(shared, iface.Name)
+		}
+	}
+	if len(shared) > 0 {
+		return shared
+	}
+	return all
+}
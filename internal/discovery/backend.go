@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Discoverer finds services on the network, or wherever its backend looks.
+type Discoverer interface {
+	// Discover calls found for every peer offering service, such as Service
+	// or InboxService, until ctx is done. A peer may be reported again and
+	// again, for as long as it is there; its TTL says how long each report
+	// holds, and a zero TTL that it is gone, in which case only its instance
+	// name may be set. found may be called from several goroutines at once,
+	// but never after Discover returns. Discover fails if its backend can't
+	// look for peers at all.
+	Discover(ctx context.Context, service string, found func(Peer)) error
+}
+
+// Announcer makes services known to Discoverers.
+type Announcer interface {
+	// Announce publishes r until the returned function is called.
+	Announce(ctx context.Context, r Record) (func(), error)
+}
+
+// Record is a service instance as announcers publish it.
+type Record struct {
+	Service     string
+	Instance    string
+	Port        int
+	Text        []string         // TXT fields, as key=value
+	Certificate *tls.Certificate // Nil if the service has none
+}
+
+// Discoverers combines discoverers, reporting what any of them finds. It
+// fails only if all of them do, so that one backend the network blocks
+// doesn't keep the others from working.
+type Discoverers []Discoverer
+
+func (ds Discoverers) Discover(ctx context.Context, service string, found func(Peer)) error {
+	errs := make([]error, len(ds))
+	var wg sync.WaitGroup
+	for i, d := range ds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = d.Discover(ctx, service, found)
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 && !slices.Contains(errs, nil) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// Announcers combines announcers, publishing with each of them. It fails if
+// any of them does.
+type Announcers []Announcer
+
+func (as Announcers) Announce(ctx context.Context, r Record) (func(), error) {
+	var stops []func()
+	stopAll := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+	for _, a := range as {
+		stop, err := a.Announce(ctx, r)
+		if err != nil {
+			stopAll()
+			return nil, err
+		}
+		stops = append(stops, stop)
+	}
+	return stopAll, nil
+}
+
+// Network returns the backends that find peers on the local network by
+// themselves: mDNS, and broadcast beacons for networks that drop multicast.
+func Network() Discoverers {
+	return Discoverers{MDNS{}, Broadcast{}}
+}
+
+// defaultAnnouncer announces services to the Network discoverers.
+func defaultAnnouncer() Announcer {
+	return Announcers{MDNS{}, Broadcast{}}
+}
+
+var (
+	discovererMu sync.Mutex
+	discoverer   Discoverer
+)
+
+// SetDiscoverer chooses how Browse and Watch find peers. By default, or when
+// d is nil, they use the Network discoverers.
+func SetDiscoverer(d Discoverer) {
+	discovererMu.Lock()
+	defer discovererMu.Unlock()
+	discoverer = d
+}
+
+// currentDiscoverer returns the discoverer set with SetDiscoverer.
+func currentDiscoverer() Discoverer {
+	discovererMu.Lock()
+	defer discovererMu.Unlock()
+	if discoverer == nil {
+		return Network()
+	}
+	return discoverer
+}
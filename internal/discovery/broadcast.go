@@ -0,0 +1,342 @@
+package discovery
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/synapse/internal/netutil"
+)
+
+// Broadcast beacons are a fallback for networks whose routers forward
+// broadcast but drop mDNS multicast. Every announced service also
+// broadcasts a beacon on BroadcastPort every few seconds, carrying what its
+// mDNS records would: instance name, port, addresses and TXT fields.
+//
+// Beacons are signed with the key of the service's TLS certificate, which
+// they include, and whose fingerprint has to match the one in their TXT
+// fields. So a beacon can't claim another share's fingerprint, and receivers
+// dial the signed addresses rather than where the packet came from. Each
+// beacon is also signed with the time it was sent, which only ever goes
+// forward, so that old beacons, goodbyes included, can't be replayed.
+
+const (
+	// BroadcastPort is the UDP port beacons are sent to and received on.
+	BroadcastPort = 42424
+
+	beaconInterval = 2 * time.Second
+	beaconTTL      = 10 // Seconds a beacon is valid; several intervals
+	maxBeaconSize  = 8192
+
+	// maxBeaconSkew is how far a beacon's time may be from the receiver's
+	// clock, either way, allowing for clocks that are a little off. Older
+	// beacons are stale.
+	maxBeaconSkew = 30 * time.Second
+)
+
+// Broadcast finds and announces services with broadcast beacons, on the
+// interfaces set with SetInterfaces. It only announces services that have
+// a certificate to sign their beacons with.
+type Broadcast struct{}
+
+func (Broadcast) Announce(ctx context.Context, r Record) (func(), error) {
+	if r.Certificate == nil {
+		return func() {}, nil
+	}
+	// Beacons last until stopped, like the announcement itself.
+	beaconCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broadcastBeacons(beaconCtx, newBeacon(r), r.Certificate)
+	}()
+	return func() {
+		cancel()
+		<-done // Let the goodbye beacon go out
+	}, nil
+}
+
+func (Broadcast) Discover(ctx context.Context, service string, found func(Peer)) error {
+	return listenBeacons(ctx, service, func(b beacon) {
+		found(peerFromBeacon(b))
+	})
+}
+
+// beacon is what a service broadcasts about itself. A TTL of zero says
+// goodbye.
+type beacon struct {
+	Service  string   `json:"service"`
+	Instance string   `json:"instance"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Addrs    []string `json:"addrs"`
+	Text     []string `json:"txt"`
+	TTL      int      `json:"ttl"`
+	Time     int64    `json:"time"` // Unix time in nanoseconds, unique to each beacon sent
+}
+
+// signedBeacon is a beacon as sent on the wire.
+type signedBeacon struct {
+	Beacon []byte `json:"beacon"` // JSON beacon, kept as signed
+	Cert   []byte `json:"cert"`   // DER certificate whose key signed Beacon
+	Sig    []byte `json:"sig"`
+}
+
+func signBeacon(b beacon, cert *tls.Certificate) ([]byte, error) {
+	body, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode beacon: %w", err)
+	}
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("certificate key can't sign beacons")
+	}
+	var sig []byte
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		sig, err = signer.Sign(rand.Reader, body, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(body)
+		sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign beacon: %w", err)
+	}
+	return json.Marshal(signedBeacon{Beacon: body, Cert: cert.Certificate[0], Sig: sig})
+}
+
+// verifyBeacon decodes a beacon, checking its signature, that its
+// certificate is the one its fingerprint names, and that it was sent around
+// now and after the beacons in latest, which holds the time of the newest
+// beacon seen from each sender and is updated.
+func verifyBeacon(packet []byte, now time.Time, latest map[string]int64) (beacon, error) {
+	var sb signedBeacon
+	if err := json.Unmarshal(packet, &sb); err != nil {
+		return beacon{}, fmt.Errorf("malformed beacon: %w", err)
+	}
+	cert, err := x509.ParseCertificate(sb.Cert)
+	if err != nil {
+		return beacon{}, fmt.Errorf("malformed beacon certificate: %w", err)
+	}
+	var algorithm x509.SignatureAlgorithm
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algorithm = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		algorithm = x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		algorithm = x509.PureEd25519
+	default:
+		return beacon{}, fmt.Errorf("unsupported beacon key")
+	}
+	if err := cert.CheckSignature(algorithm, sb.Beacon, sb.Sig); err != nil {
+		return beacon{}, fmt.Errorf("bad beacon signature: %w", err)
+	}
+
+	var b beacon
+	if err := json.Unmarshal(sb.Beacon, &b); err != nil {
+		return beacon{}, fmt.Errorf("malformed beacon: %w", err)
+	}
+	sum := sha256.Sum256(sb.Cert)
+	fp := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(textValue(b.Text, "fp"), fp) {
+		return beacon{}, fmt.Errorf("beacon fingerprint doesn't match its certificate")
+	}
+
+	sent := time.Unix(0, b.Time)
+	if sent.Before(now.Add(-maxBeaconSkew)) || sent.After(now.Add(maxBeaconSkew)) {
+		return beacon{}, fmt.Errorf("stale beacon, sent at %s", sent.Format(time.RFC3339))
+	}
+	sender := fp + " " + b.Instance
+	if b.Time <= latest[sender] {
+		return beacon{}, fmt.Errorf("beacon replayed or out of order")
+	}
+	latest[sender] = b.Time
+	// Senders whose last beacon is stale can be forgotten: anything older
+	// is rejected anyway.
+	for k, t := range latest {
+		if time.Unix(0, t).Before(now.Add(-maxBeaconSkew)) {
+			delete(latest, k)
+		}
+	}
+	return b, nil
+}
+
+// broadcastBeacons broadcasts b every beaconInterval until ctx is done, then
+// says goodbye. Like zeroconf's answers, the beacon sent on each interface
+// only has that interface's addresses, so that a peer found both ways looks
+// the same.
+func broadcastBeacons(ctx context.Context, b beacon, cert *tls.Certificate) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var last int64
+	send := func(b beacon) {
+		// Interfaces are looked up each time, to follow DHCP and roaming.
+		for _, iface := range beaconInterfaces() {
+			targets := broadcastAddrs(iface)
+			if len(targets) == 0 {
+				continue
+			}
+			b.Addrs = beaconAddrs(iface)
+			// Every beacon gets a later time than the one before, even
+			// when the clock hasn't moved on, so that none is taken for
+			// a replay.
+			last = max(time.Now().UnixNano(), last+1)
+			b.Time = last
+			packet, err := signBeacon(b, cert)
+			if err != nil {
+				return
+			}
+			for _, addr := range targets {
+				_, _ = conn.WriteToUDP(packet, addr)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(beaconInterval)
+	defer ticker.Stop()
+	for {
+		send(b)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			b.TTL = 0
+			send(b)
+			return
+		}
+	}
+}
+
+// beaconInterfaces returns the interfaces beacons are sent on: those set
+// with SetInterfaces, or the default ones.
+func beaconInterfaces() []net.Interface {
+	if ifaces := interfaces(); ifaces != nil {
+		return ifaces
+	}
+	ifaces, _ := netutil.Interfaces(nil)
+	return ifaces
+}
+
+// beaconAddrs returns the addresses a beacon sent on iface advertises,
+// chosen as zeroconf chooses those of mDNS answers: IPv4 ones and global
+// IPv6 ones, or link-local IPv6 ones if there is no global one.
+func beaconAddrs(iface net.Interface) []string {
+	var v4, v6, linkLocal []string
+	for _, addr := range netutil.Addrs([]net.Interface{iface}) {
+		switch {
+		case addr.IP.To4() != nil:
+			v4 = append(v4, addr.IP.String())
+		case addr.IP.IsLinkLocalUnicast():
+			linkLocal = append(linkLocal, addr.IP.String())
+		default:
+			v6 = append(v6, addr.IP.String())
+		}
+	}
+	if len(v6) == 0 {
+		v6 = linkLocal
+	}
+	return append(v4, v6...)
+}
+
+// broadcastAddrs returns the directed broadcast address of every IPv4
+// network on iface. Unlike 255.255.255.255, which only leaves through one
+// interface, they reach each network.
+func broadcastAddrs(iface net.Interface) []*net.UDPAddr {
+	if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+		return nil
+	}
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var addrs []*net.UDPAddr
+	for _, addr := range ifaceAddrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil || len(ipnet.Mask) != net.IPv4len {
+			continue
+		}
+		ip := make(net.IP, net.IPv4len)
+		for i := range ip {
+			ip[i] = ipnet.IP.To4()[i] | ^ipnet.Mask[i]
+		}
+		addrs = append(addrs, &net.UDPAddr{IP: ip, Port: BroadcastPort})
+	}
+	return addrs
+}
+
+// listenBeacons passes every valid beacon for service to found until ctx is
+// done. Several processes on one device can listen at once.
+func listenBeacons(ctx context.Context, service string, found func(beacon)) error {
+	lc := net.ListenConfig{Control: reuseAddr}
+	conn, err := lc.ListenPacket(ctx, "udp4", ":"+strconv.Itoa(BroadcastPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen for beacons: %w", err)
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	latest := make(map[string]int64)
+	buf := make([]byte, maxBeaconSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to read beacon: %w", err)
+		}
+		b, err := verifyBeacon(buf[:n], time.Now(), latest)
+		if err != nil || b.Service != service {
+			continue
+		}
+		found(b)
+	}
+}
+
+// newBeacon describes an announced service for broadcasting.
+func newBeacon(r Record) beacon {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown-device"
+	}
+	return beacon{
+		Service:  r.Service,
+		Instance: r.Instance,
+		Host:     host + "." + strings.TrimSuffix(Domain, ".") + ".",
+		Port:     r.Port,
+		Text:     r.Text,
+		TTL:      beaconTTL,
+	}
+}
+
+// peerFromBeacon converts a beacon into the Peer mDNS would have found.
+func peerFromBeacon(b beacon) Peer {
+	var ips []net.IP
+	for _, addr := range b.Addrs {
+		if ip := net.ParseIP(addr); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return newPeer(b.Instance, b.Host, b.Port, ips, b.Text, time.Duration(b.TTL)*time.Second)
+}
@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate and its fingerprint.
+func testCertificate(t *testing.T) (*tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, hex.EncodeToString(sum[:])
+}
+
+func TestVerifyBeacon(t *testing.T) {
+	cert, fp := testCertificate(t)
+	other, otherFP := testCertificate(t)
+	now := time.Now()
+
+	newTestBeacon := func(fp string, sent time.Time) beacon {
+		return beacon{
+			Service:  Service,
+			Instance: "synapse-test",
+			Host:     "test.local.",
+			Port:     4242,
+			Addrs:    []string{"192.0.2.1"},
+			Text:     []string{"fp=" + fp},
+			TTL:      beaconTTL,
+			Time:     sent.UnixNano(),
+		}
+	}
+	sign := func(b beacon, cert *tls.Certificate) []byte {
+		packet, err := signBeacon(b, cert)
+		if err != nil {
+			t.Fatalf("signBeacon failed: %v", err)
+		}
+		return packet
+	}
+
+	latest := make(map[string]int64)
+	first := sign(newTestBeacon(fp, now.Add(-time.Second)), cert)
+	b, err := verifyBeacon(first, now, latest)
+	if err != nil {
+		t.Fatalf("verifyBeacon rejected a valid beacon: %v", err)
+	}
+	if b.Port != 4242 || b.Instance != "synapse-test" {
+		t.Errorf("verifyBeacon returned %+v", b)
+	}
+
+	// Tampering with the signed beacon breaks the signature.
+	var sb signedBeacon
+	if err := json.Unmarshal(sign(newTestBeacon(fp, now), cert), &sb); err != nil {
+		t.Fatalf("Failed to decode packet: %v", err)
+	}
+	tampered := newTestBeacon(fp, now)
+	tampered.Port = 22
+	sb.Beacon, _ = json.Marshal(tampered)
+	packet, _ := json.Marshal(sb)
+
+	goodbye := newTestBeacon(fp, now)
+	goodbye.TTL = 0
+
+	rejected := []struct {
+		name   string
+		packet []byte
+	}{
+		{"tampered", packet},
+		{"not JSON", []byte("synapse")},
+		// Signed by another certificate than the fingerprint names.
+		{"wrong certificate", sign(newTestBeacon(fp, now), other)},
+		{"replayed", first},
+		{"older than the last", sign(newTestBeacon(fp, now.Add(-2*time.Second)), cert)},
+		{"stale", sign(newTestBeacon(fp, now.Add(-2*maxBeaconSkew)), cert)},
+		{"from the future", sign(newTestBeacon(fp, now.Add(2*maxBeaconSkew)), cert)},
+	}
+	for _, tt := range rejected {
+		if _, err := verifyBeacon(tt.packet, now, latest); err == nil {
+			t.Errorf("verifyBeacon accepted a %s beacon", tt.name)
+		}
+	}
+
+	// A goodbye is accepted once, and can't be replayed once the service
+	// is back.
+	bye := sign(goodbye, cert)
+	if _, err := verifyBeacon(bye, now, latest); err != nil {
+		t.Fatalf("verifyBeacon rejected a goodbye: %v", err)
+	}
+	if _, err := verifyBeacon(sign(newTestBeacon(fp, now.Add(time.Second)), cert), now, latest); err != nil {
+		t.Fatalf("verifyBeacon rejected a beacon after a goodbye: %v", err)
+	}
+	if _, err := verifyBeacon(bye, now, latest); err == nil {
+		t.Error("verifyBeacon accepted a replayed goodbye")
+	}
+
+	// Senders are told apart, so one doesn't shadow another.
+	if _, err := verifyBeacon(sign(newTestBeacon(otherFP, now.Add(-time.Second)), other), now, latest); err != nil {
+		t.Errorf("verifyBeacon rejected another sender's beacon: %v", err)
+	}
+}
@@ -2,60 +2,289 @@ package discovery
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
-	"github.com/grandcat/zeroconf"
+	"github.com/example/synapse/pkg/utils"
 )
 
 const (
-	Service  = "_synapse._tcp"
-	Domain   = "local."
-	TextData = "version=1.0"
+	Service      = "_synapse._tcp"
+	InboxService = "_synapse-inbox._tcp"
+	Domain       = "local."
+	TextData     = "version=1.0"
 )
 
-// Announce broadcasts the service presence on the network.
-// It returns a shutdown function that should be called when the service is stopped.
-func Announce(ctx context.Context, port int) (func(), error) {
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = "unknown-device"
+// Announcement describes how a service is advertised on the network.
+type Announcement struct {
+	Name        string // Display name; defaults to the hostname
+	Port        int
+	Fingerprint string // SHA-256 fingerprint of the TLS certificate, if any
+	DeviceID    string // Stable identifier of the device, if known
+	CodeTag     string // Keyed hash of the share code, for receivers who know it
+	Share       *ShareSummary
+	Certificate *tls.Certificate // The service's certificate, for backends that sign what they publish
+}
+
+// Share kinds in a ShareSummary
+const (
+	ShareFiles  = "files"
+	ShareText   = "text"
+	ShareStream = "stream"
+)
+
+// ShareSummary describes what a sender shares, so that receivers can show it
+// before they connect.
+type ShareSummary struct {
+	Kind  string `json:"kind"`
+	Files int    `json:"files,omitempty"` // Number of files
+	Size  int64  `json:"size,omitempty"`  // Total size in bytes; unknown for streams
+	Name  string `json:"name,omitempty"`  // The file or folder shared, or the first of several; empty for text
+}
+
+// String describes the share in a few words, such as "photos (42 files, 120 MB)".
+func (s ShareSummary) String() string {
+	switch {
+	case s.Kind == ShareText:
+		return fmt.Sprintf("Text snippet (%s)", utils.FormatBytes(s.Size))
+	case s.Kind == ShareStream:
+		return s.Name + " (stream)"
+	case s.Files > 1:
+		return fmt.Sprintf("%s (%d files, %s)", s.Name, s.Files, utils.FormatBytes(s.Size))
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, utils.FormatBytes(s.Size))
+}
+
+var (
+	ifacesMu sync.Mutex
+	ifaces   []net.Interface
+)
+
+// SetInterfaces limits announcing and browsing to the given interfaces. By
+// default, or when ifaces is nil, every multicast interface is used.
+func SetInterfaces(selected []net.Interface) {
+	ifacesMu.Lock()
+	defer ifacesMu.Unlock()
+	ifaces = selected
+}
+
+// interfaces returns the interfaces set with SetInterfaces.
+func interfaces() []net.Interface {
+	ifacesMu.Lock()
+	defer ifacesMu.Unlock()
+	return ifaces
+}
+
+// maxTextField is the longest TXT record string DNS allows.
+const maxTextField = 255
+
+// Announce makes the service known on the network with announcer, or with
+// mDNS and broadcast beacons when announcer is nil. It returns a shutdown
+// function that should be called when the service is stopped.
+func Announce(ctx context.Context, announcer Announcer, a Announcement) (func(), error) {
+	return announce(ctx, Service, announcer, a)
+}
+
+// AnnounceInbox makes an always-on inbox that senders can push files to
+// known on the network, as Announce does. It returns a shutdown function
+// that should be called when the inbox is stopped.
+func AnnounceInbox(ctx context.Context, announcer Announcer, a Announcement) (func(), error) {
+	return announce(ctx, InboxService, announcer, a)
+}
+
+func announce(ctx context.Context, service string, announcer Announcer, a Announcement) (func(), error) {
+	if announcer == nil {
+		announcer = defaultAnnouncer()
 	}
 
-	// Instance name usually needs to be unique. Zeroconf might handle conflicts or we append random string.
-	// For simplicity, we use hostname. In a real app, might want a UUID or similar.
-	instanceName := fmt.Sprintf("%s-synapse", hostname)
+	name := a.Name
+	if name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown-device"
+		}
+		name = hostname
+	}
 
-	server, err := zeroconf.Register(
-		instanceName,
-		Service,
-		Domain,
-		port,
-		[]string{TextData},
-		nil,
-	)
+	// An announcer that also finds services checks its own names; others
+	// rely on the discoverer Browse uses.
+	probe, ok := announcer.(Discoverer)
+	if !ok {
+		probe = currentDiscoverer()
+	}
+	instanceName, err := uniqueInstance(ctx, probe, service, a.DeviceID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to register service: %w", err)
+		return nil, err
+	}
+
+	text := []string{
+		TextData,
+		textField("name", name),
+		"os=" + runtime.GOOS,
+	}
+	if a.Fingerprint != "" {
+		text = append(text, "fp="+a.Fingerprint)
+	}
+	if a.DeviceID != "" {
+		text = append(text, "id="+a.DeviceID)
 	}
+	if a.CodeTag != "" {
+		text = append(text, "code="+a.CodeTag)
+	}
+	if sh := a.Share; sh != nil {
+		text = append(text, "kind="+sh.Kind)
+		if sh.Kind == ShareFiles {
+			text = append(text, "files="+strconv.Itoa(sh.Files))
+		}
+		if sh.Kind != ShareStream {
+			text = append(text, "size="+strconv.FormatInt(sh.Size, 10))
+		}
+		if sh.Name != "" {
+			text = append(text, textField("file", sh.Name))
+		}
+	}
+
+	return announcer.Announce(ctx, Record{
+		Service:     service,
+		Instance:    instanceName,
+		Port:        a.Port,
+		Text:        text,
+		Certificate: a.Certificate,
+	})
+}
+
+const (
+	// probeTimeout is how long uniqueInstance waits for another service to
+	// answer to a name, like the probing step of mDNS.
+	probeTimeout = 750 * time.Millisecond
+	// maxProbes bounds the names uniqueInstance tries.
+	maxProbes = 5
+)
 
-	shutdown := func() {
-		server.Shutdown()
+// uniqueInstance picks a service instance name made of the device ID and a
+// random share ID, so that it doesn't depend on the device name and several
+// shares from one device can run side by side. zeroconf doesn't probe for
+// conflicts before announcing, so each candidate is looked up with probe
+// first and replaced when another service already answers to it.
+func uniqueInstance(ctx context.Context, probe Discoverer, service, deviceID string) (string, error) {
+	device := deviceID
+	if device == "" {
+		device = randomID(4)
+	}
+	if len(device) > 8 {
+		device = device[:8]
 	}
 
-	return shutdown, nil
+	for range maxProbes {
+		name := fmt.Sprintf("synapse-%s-%s", device, randomID(3))
+		taken, err := instanceTaken(ctx, probe, service, name)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find a free instance name after %d tries", maxProbes)
 }
 
-// Browse scans for available Landrop peers.
-// It sends found entries to the provided channel.
-func Browse(ctx context.Context, entries chan<- *zeroconf.ServiceEntry) error {
-	resolver, err := zeroconf.NewResolver(nil)
-	if err != nil {
-		return fmt.Errorf("failed to create resolver: %w", err)
+// instanceTaken reports whether a service found by probe answers to the
+// instance name.
+func instanceTaken(ctx context.Context, probe Discoverer, service, instance string) (bool, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var taken atomic.Bool
+	err := probe.Discover(probeCtx, service, func(p Peer) {
+		if p.TTL > 0 && p.Instance == instance {
+			taken.Store(true)
+			cancel()
+		}
+	})
+	switch {
+	case taken.Load():
+		return true, nil
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case err != nil:
+		return false, fmt.Errorf("failed to look up %s: %w", instance, err)
 	}
+	return false, nil
+}
 
-	if err := resolver.Browse(ctx, Service, Domain, entries); err != nil {
-		return fmt.Errorf("failed to browse: %w", err)
+// randomID returns n random bytes in hex.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// textField formats key=value for a TXT record, shortening value to fit.
+func textField(key, value string) string {
+	field := key + "=" + value
+	if len(field) <= maxTextField {
+		return field
+	}
+	field = field[:maxTextField]
+	for !utf8.ValidString(field) {
+		field = field[:len(field)-1]
 	}
+	return field
+}
+
+// textValue returns the value of key among TXT fields, or "" if it isn't set.
+func textValue(text []string, key string) string {
+	for _, field := range text {
+		if k, v, ok := strings.Cut(field, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// Browse scans for available Landrop peers with the discoverer set with
+// SetDiscoverer. It sends each peer found to the provided channel once,
+// however many backends found it, until ctx is done; it then closes the
+// channel and returns, with an error only if discovery failed altogether.
+func Browse(ctx context.Context, peers chan<- Peer) error {
+	return browse(ctx, Service, peers)
+}
+
+// BrowseInboxes scans for inboxes that accept pushed files, as Browse does.
+func BrowseInboxes(ctx context.Context, peers chan<- Peer) error {
+	return browse(ctx, InboxService, peers)
+}
+
+func browse(ctx context.Context, service string, peers chan<- Peer) error {
+	defer close(peers)
 
+	var mu sync.Mutex
+	sent := make(map[string]bool)
+	err := currentDiscoverer().Discover(ctx, service, func(p Peer) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p.TTL <= 0 || sent[p.Key()] {
+			return
+		}
+		select {
+		case peers <- p:
+			sent[p.Key()] = true
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to browse: %w", err)
+	}
 	return nil
 }
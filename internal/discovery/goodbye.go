@@ -0,0 +1,79 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+)
+
+var (
+	mdnsGroupIPv4 = net.IPv4(224, 0, 0, 251)
+
+	// mdnsListenAddr is the address zeroconf binds to. Binding a multicast
+	// address sets SO_REUSEADDR, so both sockets get every mDNS packet.
+	mdnsListenAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 0), Port: 5353}
+)
+
+// listenGoodbyes calls gone with the instance names of service
+// announcements withdrawn with an mDNS goodbye, a record with a TTL of zero,
+// until ctx is done. zeroconf's resolver drops goodbyes without reporting
+// them, so they are read from a socket of our own.
+func listenGoodbyes(ctx context.Context, service string, gone func(instance string)) error {
+	conn, err := net.ListenUDP("udp4", mdnsListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for mDNS: %w", err)
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	pc := ipv4.NewPacketConn(conn)
+	ifaces := interfaces()
+	if ifaces == nil {
+		if ifaces, err = net.Interfaces(); err != nil {
+			return fmt.Errorf("failed to list interfaces: %w", err)
+		}
+	}
+	joined := 0
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if err := pc.JoinGroup(&iface, &net.UDPAddr{IP: mdnsGroupIPv4}); err == nil {
+			joined++
+		}
+	}
+	if joined == 0 {
+		return fmt.Errorf("failed to join the mDNS group on any interface")
+	}
+
+	suffix := "." + service + "." + Domain
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read mDNS packet: %w", err)
+		}
+
+		var msg dns.Msg
+		if err := msg.Unpack(buf[:n]); err != nil || !msg.Response {
+			continue
+		}
+		for _, rr := range msg.Answer {
+			ptr, ok := rr.(*dns.PTR)
+			if !ok || ptr.Hdr.Ttl != 0 || !strings.HasSuffix(ptr.Ptr, suffix) {
+				continue
+			}
+			gone(strings.TrimSuffix(ptr.Ptr, suffix))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// mdnsRound is how long each browse lasts in MDNS.Discover. zeroconf reports
+// each service only once per browse, so browsing goes on in rounds.
+const mdnsRound = 3 * time.Second
+
+// MDNS finds and announces services with multicast DNS, on the interfaces
+// set with SetInterfaces.
+type MDNS struct{}
+
+func (MDNS) Announce(ctx context.Context, r Record) (func(), error) {
+	// The records carry zeroconf's default TTL: setting another races with
+	// the announcements Register has already started. Watch caps it instead.
+	server, err := zeroconf.Register(r.Instance, r.Service, Domain, r.Port, r.Text, interfaces())
+	if err != nil {
+		return nil, fmt.Errorf("failed to register service: %w", err)
+	}
+	return server.Shutdown, nil
+}
+
+func (MDNS) Discover(ctx context.Context, service string, found func(Peer)) error {
+	// Goodbyes are a shortcut; without them peers still expire.
+	ctx, stop := context.WithCancel(ctx)
+	goodbyesDone := make(chan struct{})
+	go func() {
+		defer close(goodbyesDone)
+		_ = listenGoodbyes(ctx, service, func(instance string) {
+			found(Peer{Instance: instance})
+		})
+	}()
+	defer func() {
+		stop()
+		<-goodbyesDone
+	}()
+
+	for ctx.Err() == nil {
+		resolver, err := zeroconf.NewResolver(zeroconf.SelectIfaces(interfaces()))
+		if err != nil {
+			return fmt.Errorf("failed to create resolver: %w", err)
+		}
+		roundCtx, cancel := context.WithTimeout(ctx, mdnsRound)
+		entries := make(chan *zeroconf.ServiceEntry)
+		if err := resolver.Browse(roundCtx, service, Domain, entries); err != nil {
+			cancel()
+			return fmt.Errorf("failed to browse: %w", err)
+		}
+		for entry := range entries {
+			found(peerFromEntry(entry))
+		}
+		cancel()
+	}
+	return nil
+}
+
+// peerFromEntry converts a zeroconf entry into a Peer.
+func peerFromEntry(entry *zeroconf.ServiceEntry) Peer {
+	ips := make([]net.IP, 0, len(entry.AddrIPv4)+len(entry.AddrIPv6))
+	ips = append(append(ips, entry.AddrIPv4...), entry.AddrIPv6...)
+	return newPeer(entry.Instance, entry.HostName, entry.Port, ips, entry.Text, time.Duration(entry.TTL)*time.Second)
+}
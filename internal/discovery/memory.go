@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// memoryRefresh is how often Memory reports the services it holds.
+	memoryRefresh = 100 * time.Millisecond
+	memoryTTL     = 2 * time.Second
+)
+
+// Memory is a Discoverer and Announcer that keeps services in memory, for
+// tests: what is announced with it is found by browsing it, on loopback,
+// and nowhere else.
+type Memory struct {
+	mu      sync.Mutex
+	records map[string]Record // By instance name
+}
+
+// NewMemory returns an empty in-memory backend.
+func NewMemory() *Memory {
+	return &Memory{records: make(map[string]Record)}
+}
+
+func (m *Memory) Announce(ctx context.Context, r Record) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[r.Instance] = r
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.records, r.Instance)
+	}, nil
+}
+
+func (m *Memory) Discover(ctx context.Context, service string, found func(Peer)) error {
+	reported := make(map[string]bool)
+	for {
+		m.mu.Lock()
+		var peers []Peer
+		for _, r := range m.records {
+			if r.Service == service {
+				peers = append(peers, newPeer(r.Instance, "localhost.", r.Port, []net.IP{net.IPv4(127, 0, 0, 1)}, r.Text, memoryTTL))
+			}
+		}
+		m.mu.Unlock()
+
+		current := make(map[string]bool, len(peers))
+		for _, p := range peers {
+			current[p.Instance] = true
+			reported[p.Instance] = true
+			found(p)
+		}
+		for instance := range reported {
+			if !current[instance] {
+				delete(reported, instance)
+				found(Peer{Instance: instance})
+			}
+		}
+
+		select {
+		case <-time.After(memoryRefresh):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
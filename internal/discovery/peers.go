@@ -0,0 +1,224 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Peer is a Synapse service found on the network, by whichever backend.
+type Peer struct {
+	ID          string            `json:"id,omitempty"` // Device ID, if the peer announces one
+	Instance    string            `json:"name"`
+	HostName    string            `json:"hostname"`
+	Port        int               `json:"port"`
+	IPv4        []net.IP          `json:"ipv4"`
+	IPv6        []net.IP          `json:"ipv6"`
+	Text        map[string]string `json:"txt"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	DisplayName string            `json:"display_name,omitempty"`
+	OS          string            `json:"os,omitempty"`
+	CodeTag     string            `json:"code_tag,omitempty"` // Keyed hash of the share code, if it has one
+	Share       *ShareSummary     `json:"share,omitempty"`    // Nil for peers that don't describe their share
+	Saved       bool              `json:"saved,omitempty"`    // Listed in a static peers file rather than found on the network
+
+	// TTL is how long the peer can be assumed to stay after being found;
+	// zero when it said goodbye.
+	TTL time.Duration `json:"-"`
+}
+
+// newPeer builds the Peer a backend found: a service instance with its host,
+// port, addresses and TXT fields.
+func newPeer(instance, host string, port int, ips []net.IP, txt []string, ttl time.Duration) Peer {
+	text := make(map[string]string, len(txt))
+	for _, field := range txt {
+		k, v, _ := strings.Cut(field, "=")
+		text[k] = v
+	}
+	p := Peer{
+		ID:          text["id"],
+		Instance:    instance,
+		HostName:    host,
+		Port:        port,
+		Text:        text,
+		Fingerprint: text["fp"],
+		DisplayName: text["name"],
+		OS:          text["os"],
+		CodeTag:     text["code"],
+		Share:       shareFromText(text),
+		TTL:         ttl,
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			p.IPv4 = append(p.IPv4, ip)
+		} else {
+			p.IPv6 = append(p.IPv6, ip)
+		}
+	}
+	return p
+}
+
+func shareFromText(text map[string]string) *ShareSummary {
+	if text["kind"] == "" {
+		return nil
+	}
+	files, _ := strconv.Atoi(text["files"])
+	size, _ := strconv.ParseInt(text["size"], 10, 64)
+	return &ShareSummary{
+		Kind:  text["kind"],
+		Files: files,
+		Size:  size,
+		Name:  text["file"],
+	}
+}
+
+// Matches reports whether name is the peer's display name or instance name,
+// ignoring case.
+func (p Peer) Matches(name string) bool {
+	return strings.EqualFold(p.DisplayName, name) || strings.EqualFold(p.Instance, name)
+}
+
+// Label returns the name to show for the peer: its display name, or its
+// instance name for peers that don't announce one.
+func (p Peer) Label() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return p.Instance
+}
+
+// Key identifies the peer across changes of name or address: its device ID,
+// or its instance name for peers that don't announce one. One device can run
+// several shares at once, all with the device's certificate, so the ID is
+// qualified with the certificate fingerprint and the port each listens on.
+func (p Peer) Key() string {
+	if p.ID == "" {
+		return p.Instance
+	}
+	if p.Fingerprint != "" {
+		return p.ID + "/" + p.Fingerprint + "/" + strconv.Itoa(p.Port)
+	}
+	return p.ID
+}
+
+func (p Peer) equal(o Peer) bool {
+	ipEqual := func(a, b net.IP) bool { return a.Equal(b) }
+	return p.Instance == o.Instance &&
+		p.HostName == o.HostName &&
+		p.Port == o.Port &&
+		slices.EqualFunc(p.IPv4, o.IPv4, ipEqual) &&
+		slices.EqualFunc(p.IPv6, o.IPv6, ipEqual) &&
+		maps.Equal(p.Text, o.Text)
+}
+
+// PeerEventType says what happened to a peer in a PeerEvent.
+type PeerEventType string
+
+const (
+	PeerAdded   PeerEventType = "added"
+	PeerUpdated PeerEventType = "updated"
+	PeerRemoved PeerEventType = "removed"
+)
+
+// PeerEvent reports a change in the set of peers seen by Watch.
+type PeerEvent struct {
+	Type PeerEventType
+	Peer Peer
+}
+
+const (
+	// maxPeerTTL caps how long Watch keeps an unseen peer, so that peers
+	// which vanish without a goodbye, after a crash or a network change,
+	// expire quickly despite the long TTLs mDNS announces. Backends report a
+	// peer that is still there every few seconds, well within it.
+	maxPeerTTL = 20 * time.Second
+	// expiryInterval is how often Watch looks for expired peers.
+	expiryInterval = time.Second
+)
+
+// Watch reports peers as they appear, change and disappear, until ctx is
+// cancelled. Peers are found with the discoverer set with SetDiscoverer; a
+// peer is gone when it says goodbye, or when its TTL runs out without it
+// being found again. Peers are told apart by Peer.Key, so a renamed device
+// is reported as updated. The events channel is closed when Watch returns,
+// which before ctx is cancelled means that discovery failed.
+func Watch(ctx context.Context, events chan<- PeerEvent) error {
+	defer close(events)
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	found := make(chan Peer)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- currentDiscoverer().Discover(ctx, Service, func(p Peer) {
+			select {
+			case found <- p:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	type seen struct {
+		peer    Peer
+		expires time.Time
+	}
+	known := make(map[string]*seen)
+	remove := func(key string) {
+		if s, ok := known[key]; ok {
+			delete(known, key)
+			events <- PeerEvent{Type: PeerRemoved, Peer: s.peer}
+		}
+	}
+
+	expiry := time.NewTicker(expiryInterval)
+	defer expiry.Stop()
+	for {
+		select {
+		case peer := <-found:
+			if peer.TTL <= 0 {
+				// mDNS goodbyes only name the instance.
+				for key, s := range known {
+					if s.peer.Instance == peer.Instance {
+						remove(key)
+					}
+				}
+				continue
+			}
+			s, ok := known[peer.Key()]
+			switch {
+			case !ok:
+				s = &seen{peer: peer}
+				known[peer.Key()] = s
+				events <- PeerEvent{Type: PeerAdded, Peer: peer}
+			case !s.peer.equal(peer):
+				s.peer = peer
+				events <- PeerEvent{Type: PeerUpdated, Peer: peer}
+			}
+			s.expires = time.Now().Add(min(peer.TTL, maxPeerTTL))
+
+		case now := <-expiry.C:
+			for key, s := range known {
+				if now.After(s.expires) {
+					remove(key)
+				}
+			}
+
+		case err := <-errc:
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == nil {
+				err = fmt.Errorf("discovery stopped")
+			}
+			return err
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build (!unix && !windows) || solaris
+
+package discovery
+
+import "syscall"
+
+// reuseAddr does nothing where SO_REUSEPORT is missing; only one process at
+// a time then listens for beacons.
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	return nil
+}
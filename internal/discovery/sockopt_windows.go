@@ -0,0 +1,15 @@
+package discovery
+
+import "syscall"
+
+// reuseAddr lets several processes on one device listen for beacons: a
+// sender's TUI and a receiver, say.
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
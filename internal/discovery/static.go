@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	// staticRefresh is how often StaticFile reads its file again, so that
+	// edits show up without a restart.
+	staticRefresh = 5 * time.Second
+	staticTTL     = 3 * staticRefresh
+)
+
+// StaticPeer is a peer listed in a static peers file rather than found on
+// the network, such as a server on another subnet.
+type StaticPeer struct {
+	Name        string   `json:"name"`
+	Addresses   []string `json:"addresses"` // IP addresses or host names
+	Port        int      `json:"port"`
+	Fingerprint string   `json:"fingerprint,omitempty"` // Pinned when connecting
+	Inbox       bool     `json:"inbox,omitempty"`       // An inbox rather than a share
+	Notes       string   `json:"notes,omitempty"`       // The user's own; discovery ignores them
+}
+
+// StaticFile finds the peers listed in a JSON file holding a list of
+// StaticPeer. A missing file lists no peers.
+type StaticFile struct {
+	Path string
+}
+
+func (f StaticFile) Discover(ctx context.Context, service string, found func(Peer)) error {
+	for {
+		peers, err := ReadStaticPeers(f.Path)
+		if err == nil {
+			for _, sp := range peers {
+				if sp.Inbox == (service == InboxService) {
+					found(sp.peer(ctx))
+				}
+			}
+		}
+
+		select {
+		case <-time.After(staticRefresh):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ReadStaticPeers reads a static peers file. A missing file holds no peers.
+func ReadStaticPeers(path string) ([]StaticPeer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var peers []StaticPeer
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return peers, nil
+}
+
+// peer converts the entry into a Peer, looking up the addresses given as
+// host names.
+func (sp StaticPeer) peer(ctx context.Context) Peer {
+	var ips []net.IP
+	add := func(ip net.IP) {
+		if !slices.ContainsFunc(ips, ip.Equal) {
+			ips = append(ips, ip)
+		}
+	}
+	host := ""
+	for _, addr := range sp.Addresses {
+		if ip := net.ParseIP(addr); ip != nil {
+			add(ip)
+			continue
+		}
+		if host == "" {
+			host = addr
+		}
+		resolved, err := net.DefaultResolver.LookupIPAddr(ctx, addr)
+		if err != nil {
+			continue
+		}
+		for _, r := range resolved {
+			add(r.IP)
+		}
+	}
+	text := []string{"name=" + sp.Name}
+	if sp.Fingerprint != "" {
+		text = append(text, "fp="+sp.Fingerprint)
+	}
+	p := newPeer(sp.Name, host, sp.Port, ips, text, staticTTL)
+	p.Saved = true
+	return p
+}
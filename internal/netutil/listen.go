@@ -0,0 +1,124 @@
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Listen listens for TCP connections on the first port from first to last
+// that is free, or on any free port if first is 0. With no interfaces it
+// listens on all of them; otherwise only on the addresses of ifaces and on
+// loopback, which no other device can reach.
+func Listen(ifaces []net.Interface, first, last int) (net.Listener, error) {
+	if last < first {
+		last = first
+	}
+	var err error
+	for port := first; port <= last; port++ {
+		var l net.Listener
+		if l, err = listenPort(ifaces, port); err == nil {
+			return l, nil
+		}
+	}
+	switch {
+	case first == 0:
+		return nil, err
+	case first == last:
+		return nil, fmt.Errorf("port %d is not available: %w", first, err)
+	}
+	return nil, fmt.Errorf("no port from %d to %d is available: %w", first, last, err)
+}
+
+// listenPort listens on port as Listen does. The port counts as taken when
+// the first address of ifaces can't be bound; other addresses that can't,
+// such as IPv6 ones still being set up, are skipped.
+func listenPort(ifaces []net.Interface, port int) (net.Listener, error) {
+	if len(ifaces) == 0 {
+		return net.Listen("tcp", fmt.Sprintf(":%d", port))
+	}
+
+	addrs := Addrs(ifaces)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("the selected network interfaces have no address")
+	}
+	ml := &multiListener{
+		conns: make(chan acceptResult),
+		done:  make(chan struct{}),
+	}
+	for i, addr := range append(addrs, net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}, net.IPAddr{IP: net.IPv6loopback}) {
+		l, err := net.Listen("tcp", net.JoinHostPort(addr.String(), strconv.Itoa(port)))
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			continue
+		}
+		if port == 0 {
+			// The other addresses get the same port, so one port number
+			// can be announced for all of them.
+			port = l.Addr().(*net.TCPAddr).Port
+		}
+		ml.listeners = append(ml.listeners, l)
+	}
+	for _, l := range ml.listeners {
+		go ml.accept(l)
+	}
+	return ml, nil
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// multiListener merges the connections accepted by several listeners.
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (ml *multiListener) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		select {
+		case ml.conns <- acceptResult{conn, err}:
+		case <-ml.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-ml.conns:
+		return r.conn, r.err
+	case <-ml.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (ml *multiListener) Close() error {
+	ml.closeOnce.Do(func() {
+		close(ml.done)
+		for _, l := range ml.listeners {
+			l.Close()
+		}
+	})
+	return nil
+}
+
+// Addr returns the address of the first listener, which has the port all of
+// them share.
+func (ml *multiListener) Addr() net.Addr {
+	return ml.listeners[0].Addr()
+}
@@ -0,0 +1,145 @@
+// Package netutil chooses the network interfaces Synapse listens and
+// announces on.
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// virtualPrefixes are name prefixes of the adapters left out by default:
+// container and VM bridges, VPN tunnels and similar virtual links that
+// rarely lead to the devices around us.
+var virtualPrefixes = []string{
+	"docker", "br-", "veth", "virbr", "vnet", "vmnet", "vboxnet", "lxc", "lxd",
+	"cni", "flannel", "cali", "podman", "tun", "tap", "utun", "wg", "tailscale",
+	"zt", "ppp", "ipsec", "gif", "stf", "awdl", "llw", "bridge", "anpi",
+}
+
+// Info describes an interface for pickers in the CLI and the desktop app.
+type Info struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+	Virtual   bool     `json:"virtual"` // Left out unless chosen explicitly
+	Default   bool     `json:"default"` // Part of the default selection
+}
+
+// IsVirtual reports whether iface looks like a virtual or VPN adapter.
+func IsVirtual(iface net.Interface) bool {
+	if iface.Flags&net.FlagPointToPoint != 0 {
+		return true
+	}
+	name := strings.ToLower(iface.Name)
+	for _, prefix := range virtualPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// usable reports whether iface can carry mDNS and transfers at all.
+func usable(iface net.Interface) bool {
+	return iface.Flags&net.FlagUp != 0 &&
+		iface.Flags&net.FlagLoopback == 0 &&
+		iface.Flags&net.FlagMulticast != 0
+}
+
+// Interfaces returns the interfaces with the given names, or the default
+// selection when names is empty: every usable interface that isn't virtual,
+// or every usable one if that leaves none.
+func Interfaces(names []string) ([]net.Interface, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+
+	if len(names) > 0 {
+		var ifaces []net.Interface
+		for _, name := range names {
+			i := slices.IndexFunc(all, func(iface net.Interface) bool { return iface.Name == name })
+			if i < 0 {
+				return nil, fmt.Errorf("unknown network interface %q", name)
+			}
+			if all[i].Flags&net.FlagUp == 0 {
+				return nil, fmt.Errorf("network interface %q is down", name)
+			}
+			ifaces = append(ifaces, all[i])
+		}
+		return ifaces, nil
+	}
+
+	var physical, any []net.Interface
+	for _, iface := range all {
+		if !usable(iface) {
+			continue
+		}
+		any = append(any, iface)
+		if !IsVirtual(iface) {
+			physical = append(physical, iface)
+		}
+	}
+	if len(physical) > 0 {
+		return physical, nil
+	}
+	return any, nil
+}
+
+// List describes every usable interface, marking those in the default
+// selection.
+func List() ([]Info, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	defaults, err := Interfaces(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []Info
+	for _, iface := range all {
+		if !usable(iface) {
+			continue
+		}
+		info := Info{
+			Name:    iface.Name,
+			Virtual: IsVirtual(iface),
+			Default: slices.ContainsFunc(defaults, func(d net.Interface) bool { return d.Index == iface.Index }),
+		}
+		for _, addr := range Addrs([]net.Interface{iface}) {
+			info.Addresses = append(info.Addresses, addr.String())
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Addrs returns the unicast addresses of ifaces: IPv4 ones, then global
+// IPv6 ones, then link-local IPv6 ones with their zone.
+func Addrs(ifaces []net.Interface) []net.IPAddr {
+	var v4, v6, linkLocal []net.IPAddr
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() {
+				continue
+			}
+			switch ip := ipnet.IP; {
+			case ip.To4() != nil:
+				v4 = append(v4, net.IPAddr{IP: ip})
+			case ip.IsLinkLocalUnicast():
+				linkLocal = append(linkLocal, net.IPAddr{IP: ip, Zone: iface.Name})
+			case ip.IsGlobalUnicast():
+				v6 = append(v6, net.IPAddr{IP: ip})
+			}
+		}
+	}
+	return slices.Concat(v4, v6, linkLocal)
+}
@@ -0,0 +1,43 @@
+package netutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePortRange parses a port such as "4242" or a range such as
+// "4242-4250". An empty string or "0" means any free port and yields 0, 0.
+func ParsePortRange(s string) (first, last int, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, 0, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	if first, err = parsePort(lo); err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	if last, err = parsePort(hi); err != nil || last < first {
+		return 0, 0, fmt.Errorf("invalid port range %q", s)
+	}
+	return first, last, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// FormatPortRange formats first and last the way ParsePortRange reads them.
+func FormatPortRange(first, last int) string {
+	if last <= first {
+		return strconv.Itoa(first)
+	}
+	return fmt.Sprintf("%d-%d", first, last)
+}
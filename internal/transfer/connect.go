@@ -0,0 +1,86 @@
+package transfer
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/example/synapse/internal/netutil"
+)
+
+// ConnectScheme is the URL scheme of connection codes.
+const ConnectScheme = "synapse"
+
+// ConnectCode tells a receiver how to reach a sender without discovery, for
+// networks that block multicast: the sender's addresses and its certificate
+// fingerprint, which the receiver pins.
+type ConnectCode struct {
+	Addresses   []string // host:port, the likeliest to work first
+	Fingerprint string   // Empty for a plain host:port, which pins nothing
+}
+
+// NewConnectCode returns the code of a sender listening on port on the
+// given interfaces, or on the default ones when ifaces is nil. Link-local
+// addresses are left out, as their zone means nothing to another device.
+func NewConnectCode(ifaces []net.Interface, port int, fingerprint string) ConnectCode {
+	if ifaces == nil {
+		ifaces, _ = netutil.Interfaces(nil)
+	}
+	code := ConnectCode{Fingerprint: fingerprint}
+	for _, addr := range netutil.Addrs(ifaces) {
+		if addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		code.Addresses = append(code.Addresses, net.JoinHostPort(addr.IP.String(), strconv.Itoa(port)))
+	}
+	return code
+}
+
+// String formats the code as a URL such as
+// synapse://192.168.1.20:4242?fp=3f1c…&alt=[fd00::20]:4242.
+func (c ConnectCode) String() string {
+	if len(c.Addresses) == 0 {
+		return ""
+	}
+	// The query is built by hand to keep it short for QR codes: hex
+	// fingerprints and bracketed IPv6 hosts need no escaping.
+	var query []string
+	if c.Fingerprint != "" {
+		query = append(query, "fp="+url.QueryEscape(c.Fingerprint))
+	}
+	for _, addr := range c.Addresses[1:] {
+		query = append(query, "alt="+strings.NewReplacer("%", "%25", "&", "%26", "#", "%23").Replace(addr))
+	}
+	u := url.URL{Scheme: ConnectScheme, Host: c.Addresses[0], RawQuery: strings.Join(query, "&")}
+	return u.String()
+}
+
+// ParseConnectCode reads a code made by String, or a plain host:port.
+func ParseConnectCode(s string) (ConnectCode, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, ConnectScheme+"://") {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			return ConnectCode{}, fmt.Errorf("invalid address %q: expected host:port or a %s:// connection code", s, ConnectScheme)
+		}
+		return ConnectCode{Addresses: []string{s}}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return ConnectCode{}, fmt.Errorf("invalid connection code: %w", err)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return ConnectCode{}, fmt.Errorf("invalid connection code: no host:port")
+	}
+	query := u.Query()
+	code := ConnectCode{
+		Addresses:   append([]string{u.Host}, query["alt"]...),
+		Fingerprint: query.Get("fp"),
+	}
+	if code.Fingerprint != "" && !IsFingerprint(code.Fingerprint) {
+		return ConnectCode{}, fmt.Errorf("invalid connection code: bad fingerprint %q", code.Fingerprint)
+	}
+	return code, nil
+}
@@ -0,0 +1,90 @@
+package transfer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	// connectionAttemptDelay is how long dialAny gives one address before
+	// also trying the next, the value RFC 8305 recommends.
+	connectionAttemptDelay = 250 * time.Millisecond
+	// dialTimeout bounds each connection attempt, handshake included.
+	// Senders complete the handshake before asking for approval, so it
+	// never includes the time a person takes to answer.
+	dialTimeout = 10 * time.Second
+)
+
+// dialAny connects to whichever of addresses answers first, Happy Eyeballs
+// style: attempts start in order, connectionAttemptDelay apart or as soon as
+// the previous one fails, and the others are abandoned once one succeeds.
+func dialAny(ctx context.Context, addresses []string, config *tls.Config) (*tls.Conn, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no address to connect to")
+	}
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: dialTimeout},
+		Config:    config,
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so that attempts still running when one wins can finish.
+	results := make(chan dialResult, len(addresses))
+	next, pending := 0, 0
+	start := func() {
+		address := addresses[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			results <- dialResult{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(connectionAttemptDelay)
+	defer timer.Stop()
+
+	var errs []error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go closeLosers(results, pending)
+				return r.conn.(*tls.Conn), nil
+			}
+			errs = append(errs, r.err)
+			if next < len(addresses) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			}
+		case <-timer.C:
+			if next < len(addresses) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			}
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// closeLosers closes the connections of the n attempts still running when
+// another one won.
+func closeLosers(results <-chan dialResult, n int) {
+	for ; n > 0; n-- {
+		if r := <-results; r.err == nil {
+			r.conn.Close()
+		}
+	}
+}
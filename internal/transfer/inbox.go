@@ -0,0 +1,408 @@
+package transfer
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/netutil"
+	"github.com/example/synapse/pkg/ui"
+)
+
+// ErrOfferDeclined is returned by PushToInbox when the inbox owner declines the offer.
+var ErrOfferDeclined = errors.New("offer declined by receiver")
+
+// offerTimeout bounds how long an inbox waits for a connected sender's offer.
+const offerTimeout = 30 * time.Second
+
+// Offer is sent by a pushing sender to an inbox before any content, so the
+// inbox owner can decide whether to accept it.
+type Offer struct {
+	SenderName string      `json:"sender_name"`
+	Files      []OfferFile `json:"files"`
+	TotalSize  int64       `json:"total_size"`
+}
+
+// OfferFile is a top-level file or directory in an Offer.
+type OfferFile struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"is_dir,omitempty"`
+}
+
+// OfferResponse is the inbox owner's answer to an Offer.
+type OfferResponse struct {
+	Accepted bool `json:"accepted"`
+}
+
+// InboxOptions configures an always-on receiving listener
+type InboxOptions struct {
+	DownloadDir     string
+	PeerName        string           // Local name sent to senders
+	DeviceID        string           // Stable device identifier, advertised with the inbox
+	Certificate     *tls.Certificate // Device certificate to present; nil generates one for this inbox
+	AcceptOffer     func(peerAddr string, offer Offer) bool
+	PortChan        chan<- int
+	OnListening     func(port int, fingerprint string) // Called once the inbox is announced
+	OnProgress      func(ProgressInfo)
+	OnComplete      func(senderName string, fileName string)
+	OnError         func(senderName string, err error)
+	OnTransferStart func(net.Conn)
+	Ctx             context.Context
+	Interfaces      []net.Interface     // Interfaces to listen on; nil means all
+	Port            int                 // TCP port to listen on; 0 picks a free port
+	PortLast        int                 // With Port, the last of a range of ports tried in order
+	Announcer       discovery.Announcer // Makes the inbox known; nil means mDNS and broadcast beacons
+}
+
+// StartInbox listens for senders pushing files, announces the inbox on the
+// network and receives every offer the owner accepts. It blocks until the
+// context is cancelled.
+func StartInbox(opts InboxOptions) error {
+	if opts.AcceptOffer == nil {
+		return fmt.Errorf("no offer handler provided")
+	}
+
+	cert, err := shareCertificate(opts.Certificate)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	tcpListener, err := netutil.Listen(opts.Interfaces, opts.Port, opts.PortLast)
+	if err != nil {
+		return fmt.Errorf("failed to listen on TCP: %w", err)
+	}
+	listener := tls.NewListener(tcpListener, tlsConfig)
+	defer listener.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	ui.Info("Inbox listening on port %d...", port)
+
+	if opts.PortChan != nil {
+		opts.PortChan <- port
+	}
+
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	fingerprint := Fingerprint(cert.Certificate[0])
+	shutdownDiscovery, err := discovery.AnnounceInbox(ctx, opts.Announcer, discovery.Announcement{
+		Name:        opts.PeerName,
+		Port:        port,
+		Fingerprint: fingerprint,
+		DeviceID:    opts.DeviceID,
+		Certificate: &cert,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to announce inbox: %w", err)
+	}
+	defer shutdownDiscovery()
+
+	if opts.OnListening != nil {
+		opts.OnListening(port, fingerprint)
+	}
+
+	ui.Info("Waiting for senders... (Press Ctrl+C to stop)")
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			ui.Error("Accept error: %v", err)
+			continue
+		}
+
+		go func(c net.Conn) {
+			defer c.Close()
+			handleInboxConn(c, opts)
+		}(conn)
+	}
+}
+
+func handleInboxConn(c net.Conn, opts InboxOptions) {
+	peerAddr := c.RemoteAddr().String()
+
+	var offer Offer
+	c.SetReadDeadline(time.Now().Add(offerTimeout))
+	if err := readMessage(c, &offer); err != nil {
+		ui.Error("Failed to read offer from %s: %v", peerAddr, err)
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+
+	senderName := offer.SenderName
+	if senderName == "" {
+		senderName = peerAddr
+	}
+
+	accepted := opts.AcceptOffer(peerAddr, offer)
+	if err := writeMessage(c, OfferResponse{Accepted: accepted}); err != nil {
+		ui.Error("Failed to answer offer from %s: %v", peerAddr, err)
+		return
+	}
+	if !accepted {
+		ui.Info("Offer from %s declined.", senderName)
+		return
+	}
+
+	if opts.OnTransferStart != nil {
+		opts.OnTransferStart(c)
+	}
+
+	var receivedName string
+	recvOpts := ReceiverOptions{
+		DownloadDir: opts.DownloadDir,
+		PeerName:    opts.PeerName,
+		SenderName:  senderName,
+		OnProgress:  opts.OnProgress,
+		OnComplete: func(fileName string) {
+			receivedName = fileName
+		},
+		accepted: &offer,
+	}
+
+	if err := receiveFrom(c, peerAddr, recvOpts); err != nil {
+		ui.Error("Transfer from %s failed: %v", senderName, err)
+		if opts.OnError != nil {
+			opts.OnError(senderName, err)
+		}
+		return
+	}
+
+	if opts.OnComplete != nil {
+		opts.OnComplete(senderName, receivedName)
+	}
+}
+
+// PushToInbox offers the given paths to the inbox at address and, once the
+// owner accepts, sends them over the same connection.
+func PushToInbox(address string, inputPaths []string, opts SenderOptions) error {
+	sh, err := newShare(inputPaths)
+	if err != nil {
+		return err
+	}
+
+	ui.Info("Connecting to inbox %s...", address)
+
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tlsConfig := pinFingerprint(&tls.Config{InsecureSkipVerify: true}, opts.Fingerprint)
+	conn, err := dialAny(ctx, append([]string{address}, opts.Addresses...), tlsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to inbox: %w", err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := writeMessage(conn, sh.offer(opts.Name)); err != nil {
+		return fmt.Errorf("failed to send offer: %w", err)
+	}
+
+	ui.Info("Waiting for the receiver to accept...")
+
+	var resp OfferResponse
+	if err := readMessage(conn, &resp); err != nil {
+		return fmt.Errorf("failed to read offer response: %w", err)
+	}
+	if !resp.Accepted {
+		return ErrOfferDeclined
+	}
+
+	return sh.serve(conn, opts)
+}
+
+// matchOffer checks that header describes the content of the accepted
+// offer: the same single file, or an archive of the offered files and
+// directories with their sizes.
+func matchOffer(header FileHeader, offer Offer) error {
+	mismatch := func(format string, args ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{errOfferMismatch}, args...)...)
+	}
+	if header.Kind != "" {
+		return mismatch("got a %s share", header.Kind)
+	}
+
+	if len(offer.Files) == 1 && !offer.Files[0].IsDir {
+		f := offer.Files[0]
+		if header.IsArchive || header.Name != f.Name || header.Size != f.Size {
+			return mismatch("got %s (%d bytes) instead of %s (%d bytes)", header.Name, header.Size, f.Name, f.Size)
+		}
+		return nil
+	}
+
+	if !header.IsArchive {
+		return mismatch("got a single file instead of %d items", len(offer.Files))
+	}
+	offered := make(map[string]OfferFile, len(offer.Files))
+	for _, f := range offer.Files {
+		offered[f.Name] = f
+	}
+	var total int64
+	for _, e := range header.Entries {
+		top, rest, _ := strings.Cut(e.Path, "/")
+		f, ok := offered[top]
+		if !ok || f.IsDir == (rest == "") || (!f.IsDir && e.Size != f.Size) {
+			return mismatch("unexpected entry %s", e.Path)
+		}
+		total += e.Size
+	}
+	if total != offer.TotalSize || header.Size != offer.TotalSize {
+		return mismatch("got %d bytes instead of %d", total, offer.TotalSize)
+	}
+	return nil
+}
+
+// pushAllowance bounds how much content a push matching header may send:
+// its size, plus room for the zip headers and deflate overhead of archives.
+func pushAllowance(header FileHeader) int64 {
+	if !header.IsArchive {
+		return header.Size
+	}
+	n := header.Size + header.Size/100 + 1<<20
+	for _, e := range header.Entries {
+		n += 1024 + 2*int64(len(e.Path))
+	}
+	return n
+}
+
+// capReader fails with errOfferMismatch once more than n bytes are read.
+type capReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *capReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+	if c.n < 0 {
+		return n, fmt.Errorf("%w: more content than offered", errOfferMismatch)
+	}
+	return n, err
+}
+
+// extractPush extracts a pushed archive into a directory of its own, keeping
+// only the entries header lists, then moves each top-level file and
+// directory into dir under a name that is free there. It returns the names.
+func extractPush(zipPath, dir string, header FileHeader, offer Offer) ([]string, error) {
+	tmp, err := os.MkdirTemp(dir, ".synapse-push-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSaveFailed, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	offered := make(map[string]bool, len(offer.Files))
+	for _, f := range offer.Files {
+		offered[f.Name] = true
+	}
+	sizes := make(map[string]int64, len(header.Entries))
+	for _, e := range header.Entries {
+		sizes[e.Path] = e.Size
+	}
+	allow := func(f *zip.File) error {
+		if f.FileInfo().IsDir() {
+			top, _, _ := strings.Cut(f.Name, "/")
+			if !offered[top] {
+				return fmt.Errorf("%w: unexpected entry %s", errOfferMismatch, f.Name)
+			}
+			return nil
+		}
+		if size, ok := sizes[f.Name]; !ok || uint64(size) != f.UncompressedSize64 || !f.Mode().IsRegular() {
+			return fmt.Errorf("%w: unexpected entry %s", errOfferMismatch, f.Name)
+		}
+		return nil
+	}
+	if err := unzip(zipPath, tmp, allow); err != nil {
+		if errors.Is(err, errOfferMismatch) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", errExtractFailed, err)
+	}
+
+	extracted, err := os.ReadDir(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errExtractFailed, err)
+	}
+	var names []string
+	for _, e := range extracted {
+		path, err := moveUnique(filepath.Join(tmp, e.Name()), dir, e.Name())
+		if err != nil {
+			return names, fmt.Errorf("%w: %w", errSaveFailed, err)
+		}
+		names = append(names, filepath.Base(path))
+	}
+	return names, nil
+}
+
+// maxUniqueNames is how many numbered names moveUnique tries.
+const maxUniqueNames = 1000
+
+// moveUnique moves src into dir as name, or as "name (1).ext" and so on if
+// that is taken, without replacing anything, and returns the new path.
+func moveUnique(src, dir, name string) (string, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return "", err
+	}
+	base, ext := name, ""
+	if !info.IsDir() {
+		ext = filepath.Ext(name)
+		base = strings.TrimSuffix(name, ext)
+	}
+
+	for i := 0; i < maxUniqueNames; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+		path := filepath.Join(dir, candidate)
+
+		// A hard link can't replace an existing file, so files claim their
+		// name atomically; directories, and file systems without links,
+		// check first.
+		if !info.IsDir() {
+			err := os.Link(src, path)
+			if err == nil {
+				os.Remove(src)
+				return path, nil
+			}
+			if os.IsExist(err) {
+				continue
+			}
+		}
+		if _, err := os.Lstat(path); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		if err := os.Rename(src, path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("no free name for %s in %s", name, dir)
+}
@@ -2,6 +2,8 @@ package transfer
 
 import (
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"io"
 )
 
@@ -12,18 +14,97 @@ const (
 	CompressionChunked = "chunked"
 )
 
+const (
+	// KindText marks a text snippet, shown inline by receivers instead of being saved.
+	KindText = "text"
+
+	// TextFileName is the name given to snippets, so receivers that don't
+	// understand KindText still save them as a readable file.
+	TextFileName = "snippet.txt"
+
+	// ArchiveName is the name directories and several paths are shared
+	// under, as one archive.
+	ArchiveName = "Synapse_Transfer.zip"
+
+	// MaxTextSize bounds the length of a text snippet.
+	MaxTextSize = 1 << 20
+)
+
+const (
+	ReceiptCompleted = "completed"
+	ReceiptFailed    = "failed"
+)
+
+const (
+	// maxMessageSize bounds the length of a JSON control message on the wire.
+	maxMessageSize = 65536
+	// maxHeaderSize bounds file headers, which may carry a full archive listing.
+	maxHeaderSize = 16 << 20
+)
+
 // FileHeader is the metadata sent before the file content.
 type FileHeader struct {
-	Name        string `json:"name"`
-	Size        int64  `json:"size"`
-	IsArchive   bool   `json:"is_archive,omitempty"`  // True if the content is a zip archive (directory transfer)
-	Compression string `json:"compression,omitempty"` // "none", "gzip"
+	Name        string       `json:"name"`
+	Size        int64        `json:"size"`
+	IsArchive   bool         `json:"is_archive,omitempty"`  // True if the content is a zip archive (directory transfer)
+	Kind        string       `json:"kind,omitempty"`        // "text" for snippets; empty for files
+	Compression string       `json:"compression,omitempty"` // "none", "gzip"
+	Entries     []ShareEntry `json:"entries,omitempty"`     // Files inside the archive, for selective download
 }
 
 // TransferRequest is sent by the receiver to the sender to negotiate the transfer.
 type TransferRequest struct {
-	Offset   int64  `json:"offset"`    // Byte offset to resume from
-	PeerName string `json:"peer_name"` // The name of the client receiving the file
+	Offset   int64    `json:"offset"`            // Byte offset to resume from
+	PeerName string   `json:"peer_name"`         // The name of the client receiving the file
+	Receipt  bool     `json:"receipt,omitempty"` // Receiver will send a TransferReceipt after the checksum
+	Select   []string `json:"select,omitempty"`  // Archive entries (or directories) to send; empty means all
+}
+
+// TransferReceipt is sent by the receiver after the checksum footer once the
+// content has been verified (and extracted, for archives), so the sender can
+// report the receiver's actual outcome instead of assuming success.
+type TransferReceipt struct {
+	Status string `json:"status"` // "completed" or "failed"
+	Error  string `json:"error,omitempty"`
+}
+
+// writeMessage writes v as an 8-byte big-endian length followed by its JSON encoding.
+func writeMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, int64(len(data))); err != nil {
+		return fmt.Errorf("failed to write message length: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+// readMessage reads a message written by writeMessage and decodes it into v.
+func readMessage(r io.Reader, v interface{}) error {
+	return readMessageLimit(r, v, maxMessageSize)
+}
+
+// readMessageLimit is readMessage with an explicit bound on the message length.
+func readMessageLimit(r io.Reader, v interface{}, limit int64) error {
+	var length int64
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return fmt.Errorf("failed to read message length: %w", err)
+	}
+	if length < 0 || length > limit {
+		return fmt.Errorf("message length out of range: %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	return nil
 }
 
 // ChunkedWriter wraps an io.Writer and writes data in chunks with length headers.
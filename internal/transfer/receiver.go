@@ -4,9 +4,9 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
-	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -21,15 +21,75 @@ import (
 	"github.com/schollz/progressbar/v3"
 )
 
+// ErrRejected is returned when the sender closes the connection without
+// sending a header, which is how it turns down a receiver.
+var ErrRejected = errors.New("connection rejected by sender")
+
+// Failures a TransferReceipt reports to the sender. Only these categories
+// cross the wire: the details, which may include local paths, stay here.
+var (
+	errChecksumMismatch = errors.New("checksum mismatch")
+	errSaveFailed       = errors.New("failed to save the data")
+	errExtractFailed    = errors.New("failed to extract the archive")
+	errReceiveFailed    = errors.New("failed to receive the data")
+	errOfferMismatch    = errors.New("content does not match the accepted offer")
+)
+
+// ErrFingerprintMismatch is returned when the peer's certificate doesn't
+// match ReceiverOptions.Fingerprint or SenderOptions.Fingerprint.
+var ErrFingerprintMismatch = errors.New("peer certificate does not match the expected fingerprint")
+
 // ReceiverOptions configures the receiver behavior for GUI support
 type ReceiverOptions struct {
 	DownloadDir     string
 	PeerName        string // Local name to send to remote
 	SenderName      string // Friendly name of the remote sender
 	OnProgress      func(ProgressInfo)
+	OnVerified      func(fileName string) // Called once the checksum matches, before extraction
 	OnComplete      func(fileName string)
 	OnError         func(err error)
 	OnTransferStart func(net.Conn)
+
+	// OnText receives text snippets instead of them being written to
+	// DownloadDir. When nil, snippets are saved like any other file.
+	OnText func(text string)
+
+	// Fingerprint pins the sender: the connection is refused unless the
+	// SHA-256 fingerprint of its certificate starts with this hex string.
+	Fingerprint string
+
+	// Sink, when set, receives the content instead of a file in DownloadDir,
+	// e.g. os.Stdout for pipe mode. Archives are written as raw zip data.
+	Sink io.Writer
+
+	// SelectEntries chooses which files of a multi-file share to download.
+	// Returning no paths downloads everything; returning an error aborts.
+	SelectEntries func(entries []ShareEntry) ([]string, error)
+
+	// OnReceiving is called once the header has arrived and the files are
+	// chosen, with the name and size of what is received and, for multi-file
+	// shares, the paths of the files taken. When SelectEntries fails, it is
+	// called with nothing taken.
+	OnReceiving func(fileName string, size int64, files []string)
+
+	// Addresses lists further addresses of the same sender, such as its
+	// IPv6 ones. They are dialed along with the given address, Happy
+	// Eyeballs style, and the first to connect is used.
+	Addresses []string
+
+	// Code is the sender's share code, if the user gave it. The receiver
+	// proves it knows the code, so the sender doesn't ask for approval, and
+	// refuses a sender that can't prove it too.
+	Code string
+
+	// Ctx cancels the receive, whether it is still connecting, waiting for
+	// the sender's approval or transferring. Nil means never.
+	Ctx context.Context
+
+	// accepted, for inbox pushes, is the offer the owner accepted. The
+	// content has to match it, and is saved under new names rather than
+	// resumed into or written over existing files.
+	accepted *Offer
 }
 
 // ReceiveConnect connects to a specific peer and downloads the file/directory
@@ -44,43 +104,107 @@ func ReceiveConnect(address string) error {
 func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 	ui.Info("Connecting to %s...", address)
 
-	tlsConfig := &tls.Config{
+	tlsConfig := pinFingerprint(&tls.Config{
 		InsecureSkipVerify: true,
+	}, opts.Fingerprint)
+	var code string
+	if opts.Code != "" {
+		var err error
+		if code, err = ParseShareCode(opts.Code); err != nil {
+			return err
+		}
+		tlsConfig.NextProtos = []string{codeProtocol}
 	}
 
-	conn, err := tls.Dial("tcp", address, tlsConfig)
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	conn, err := dialAny(ctx, append([]string{address}, opts.Addresses...), tlsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to connect to sender: %w", err)
 	}
 	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if code != "" {
+		if err := proveCode(conn, code); err != nil {
+			return err
+		}
+	}
 
 	if opts.OnTransferStart != nil {
 		opts.OnTransferStart(conn)
 	}
 
-	ui.Info("Waiting for sender approval...")
-
-	var headerLen int64
-	if err := binary.Read(conn, binary.BigEndian, &headerLen); err != nil {
-		return fmt.Errorf("failed to read header length: %w", err)
+	if code != "" {
+		ui.Info("Share code verified.")
+	} else {
+		ui.Info("Waiting for sender approval...")
 	}
 
-	if headerLen > 65536 {
-		return fmt.Errorf("header length too large: %d", headerLen)
+	return receiveFrom(conn, address, opts)
+}
+
+// receiveFrom runs the receiving side of the protocol on an established
+// connection, regardless of which side dialed it.
+func receiveFrom(conn net.Conn, address string, opts ReceiverOptions) (err error) {
+	var header FileHeader
+	if err := readMessageLimit(conn, &header, maxHeaderSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrRejected
+		}
+		return fmt.Errorf("failed to read header: %w", err)
 	}
 
-	headerBytes := make([]byte, headerLen)
-	if _, err := io.ReadFull(conn, headerBytes); err != nil {
-		return fmt.Errorf("failed to read header JSON: %w", err)
+	if opts.accepted != nil {
+		if err := matchOffer(header, *opts.accepted); err != nil {
+			// The sender expects a request here; a failed receipt instead
+			// tells it the transfer is refused.
+			sendReceipt(conn, err)
+			return err
+		}
 	}
 
-	var header FileHeader
-	if err := json.Unmarshal(headerBytes, &header); err != nil {
-		return fmt.Errorf("failed to unmarshal header: %w", err)
+	if header.Kind == KindText && opts.OnText != nil {
+		return receiveText(conn, header, opts)
 	}
 
 	safeName := utils.SanitizeFilename(header.Name)
 
+	// For multi-file shares, let the caller pick a subset before anything is sent.
+	var selected []string
+	expectedSize := header.Size
+	if header.IsArchive && len(header.Entries) > 0 && opts.SelectEntries != nil {
+		selected, err = opts.SelectEntries(header.Entries)
+		if err != nil {
+			if opts.OnReceiving != nil {
+				opts.OnReceiving(safeName, 0, nil)
+			}
+			return err
+		}
+		if len(selected) > 0 {
+			expectedSize = newEntrySelection(selected).size(header.Entries)
+		}
+	}
+	if opts.OnReceiving != nil {
+		files, size := takenEntries(header, selected)
+		opts.OnReceiving(safeName, size, files)
+	}
+
+	if header.IsArchive && len(selected) > 0 {
+		ui.Info("Receiving %d of %d files from %s (%s)", len(selected), len(header.Entries), safeName, utils.FormatBytes(expectedSize))
+	} else if header.IsArchive {
+		ui.Info("Receiving directory: %s (%s)", safeName, utils.FormatBytes(header.Size))
+	} else {
+		ui.Info("Receiving file: %s (%s)", safeName, utils.FormatBytes(header.Size))
+	}
+
+	if opts.Sink != nil {
+		return receiveToSink(conn, address, header, selected, expectedSize, opts)
+	}
+
 	downloadDir := opts.DownloadDir
 	if downloadDir == "" {
 		downloadDir = "received_files"
@@ -89,12 +213,6 @@ func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 		return fmt.Errorf("failed to create download directory: %w", err)
 	}
 
-	if header.IsArchive {
-		ui.Info("Receiving directory: %s (%s)", safeName, byteCountDecimal(header.Size))
-	} else {
-		ui.Info("Receiving file: %s (%s)", safeName, byteCountDecimal(header.Size))
-	}
-
 	var offset int64 = 0
 	var outPath string
 	var destFile *os.File
@@ -105,13 +223,15 @@ func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 			return fmt.Errorf("failed to create destination file: %w", err)
 		}
 		offset = 0
+	} else if opts.accepted != nil {
+		destFile, err = os.CreateTemp(downloadDir, ".synapse-push-*")
 	} else {
 		finalPath := filepath.Join(downloadDir, safeName)
 
 		if info, err := os.Stat(finalPath); err == nil && !info.IsDir() {
 			if info.Size() < header.Size {
 				offset = info.Size()
-				ui.Info("Found partial file. Resuming from %s...", byteCountDecimal(offset))
+				ui.Info("Found partial file. Resuming from %s...", utils.FormatBytes(offset))
 				destFile, err = os.OpenFile(finalPath, os.O_WRONLY|os.O_APPEND, 0644)
 			} else {
 				destFile, err = os.Create(finalPath)
@@ -129,7 +249,7 @@ func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 	success := false
 	defer func() {
 		destFile.Close()
-		if header.IsArchive && !success {
+		if (header.IsArchive || opts.accepted != nil) && !success {
 			os.Remove(outPath)
 		}
 	}()
@@ -137,20 +257,20 @@ func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 	req := TransferRequest{
 		Offset:   offset,
 		PeerName: opts.PeerName,
+		Receipt:  true,
+		Select:   selected,
 	}
-	reqBytes, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	var reqLen int64 = int64(len(reqBytes))
-	if err := binary.Write(conn, binary.BigEndian, reqLen); err != nil {
-		return fmt.Errorf("failed to write request length: %w", err)
-	}
-	if _, err := conn.Write(reqBytes); err != nil {
+	if err := writeMessage(conn, req); err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 
+	// From here on the sender waits for our verdict, so report failures back.
+	defer func() {
+		if err != nil {
+			sendReceipt(conn, err)
+		}
+	}()
+
 	hasher := sha256.New()
 
 	var contentReader io.Reader
@@ -182,17 +302,16 @@ func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 		contentReader = hashedReader
 	}
 
-	bar := progressbar.DefaultBytes(
-		header.Size-offset,
-		"receiving",
-	)
+	if opts.accepted != nil {
+		contentReader = &capReader{r: contentReader, n: pushAllowance(header)}
+	}
 
 	// Build the destination writer with optional progress callback
 	var destWriter io.Writer
 	if opts.OnProgress != nil {
 		pw := &recvProgressWriter{
-			inner:      destFile,
-			total:      header.Size,
+			inner:      saveWriter{destFile},
+			total:      expectedSize,
 			offset:     offset,
 			fileName:   safeName,
 			peerAddr:   address,
@@ -201,43 +320,69 @@ func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 		}
 		destWriter = pw
 	} else {
-		destWriter = io.MultiWriter(destFile, bar)
+		bar := progressbar.DefaultBytes(expectedSize-offset, "receiving")
+		destWriter = io.MultiWriter(saveWriter{destFile}, barWriter{bar})
 	}
 
 	buf := make([]byte, 4*1024*1024)
-	if _, err := io.CopyBuffer(destWriter, contentReader, buf); err != nil {
+	written, err := io.CopyBuffer(destWriter, contentReader, buf)
+	if err != nil {
 		return fmt.Errorf("failed to write file content: %w", err)
 	}
-
-	fmt.Println()
-
-	receivedChecksum := make([]byte, 32)
-	if _, err := io.ReadFull(conn, receivedChecksum); err != nil {
-		return fmt.Errorf("failed to read checksum: %w", err)
+	if opts.accepted != nil && !header.IsArchive && written != header.Size {
+		return fmt.Errorf("%w: got %d bytes of %d", errOfferMismatch, written, header.Size)
 	}
 
-	calculatedChecksum := hasher.Sum(nil)
+	if opts.OnProgress == nil {
+		fmt.Fprintln(os.Stderr) // End the progress bar line
+	}
 
-	if !bytes.Equal(calculatedChecksum, receivedChecksum) {
-		return fmt.Errorf("checksum mismatch! File may be corrupted.\nExpected: %x\nGot:      %x", receivedChecksum, calculatedChecksum)
+	if err := verifyChecksum(conn, hasher.Sum(nil)); err != nil {
+		return err
+	}
+	if opts.OnVerified != nil {
+		opts.OnVerified(safeName)
 	}
 
-	ui.Success("Checksum verified successfully.")
+	switch {
+	case header.IsArchive && opts.accepted != nil:
+		ui.Info("Extracting archive...")
+		destFile.Close()
 
-	if header.IsArchive {
+		names, err := extractPush(outPath, downloadDir, header, *opts.accepted)
+		if err != nil {
+			return err
+		}
+		os.Remove(outPath)
+		if len(names) == 1 {
+			safeName = names[0]
+		}
+		ui.Success("Received and extracted: %s", strings.Join(names, ", "))
+	case header.IsArchive:
 		ui.Info("Extracting archive...")
 		destFile.Close()
 
-		if err := unzip(outPath, downloadDir); err != nil {
-			return fmt.Errorf("failed to unzip archive: %w", err)
+		if err := unzip(outPath, downloadDir, nil); err != nil {
+			return fmt.Errorf("%w: %w", errExtractFailed, err)
 		}
 		os.Remove(outPath)
 		ui.Success("Directory received and extracted: %s", filepath.Join(downloadDir, safeName))
-	} else {
+	case opts.accepted != nil:
+		destFile.Close()
+
+		finalPath, err := moveUnique(outPath, downloadDir, safeName)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errSaveFailed, err)
+		}
+		safeName = filepath.Base(finalPath)
+		ui.Success("File received: %s", finalPath)
+	default:
 		ui.Success("File received: %s", filepath.Join(downloadDir, safeName))
 	}
 
 	success = true
+	sendReceipt(conn, nil)
+
 	if opts.OnComplete != nil {
 		opts.OnComplete(safeName)
 	}
@@ -245,20 +390,183 @@ func ReceiveConnectWithOptions(address string, opts ReceiverOptions) error {
 	return nil
 }
 
-func byteCountDecimal(b int64) string {
-	const unit = 1000
-	if b < unit {
-		return fmt.Sprintf("%d B", b)
+// receiveToSink streams the content into opts.Sink. Nothing is written to
+// disk, so there is no resume and archives are passed through unextracted.
+func receiveToSink(conn net.Conn, address string, header FileHeader, selected []string, expectedSize int64, opts ReceiverOptions) (err error) {
+	req := TransferRequest{
+		PeerName: opts.PeerName,
+		Receipt:  true,
+		Select:   selected,
 	}
-	div, exp := int64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	if err := writeMessage(conn, req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
 	}
-	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "kMGTPE"[exp])
+
+	defer func() {
+		if err != nil {
+			sendReceipt(conn, err)
+		}
+	}()
+
+	hasher := sha256.New()
+
+	var contentReader io.Reader
+	switch header.Compression {
+	case CompressionChunked:
+		contentReader = io.TeeReader(NewChunkedReader(conn), hasher)
+	case CompressionNone, "":
+		contentReader = io.TeeReader(io.LimitReader(conn, header.Size), hasher)
+	default:
+		return fmt.Errorf("unsupported compression for output stream: %s", header.Compression)
+	}
+
+	safeName := utils.SanitizeFilename(header.Name)
+	var sink io.Writer
+	if opts.OnProgress != nil {
+		sink = &recvProgressWriter{
+			inner:      saveWriter{opts.Sink},
+			total:      expectedSize,
+			fileName:   safeName,
+			peerAddr:   address,
+			senderName: opts.SenderName,
+			callback:   opts.OnProgress,
+		}
+	} else {
+		sink = io.MultiWriter(saveWriter{opts.Sink}, barWriter{progressbar.DefaultBytes(expectedSize, "receiving")})
+	}
+
+	buf := make([]byte, 4*1024*1024)
+	if _, err := io.CopyBuffer(sink, contentReader, buf); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	if opts.OnProgress == nil {
+		fmt.Fprintln(os.Stderr) // End the progress bar line
+	}
+
+	if err := verifyChecksum(conn, hasher.Sum(nil)); err != nil {
+		return err
+	}
+	if opts.OnVerified != nil {
+		opts.OnVerified(safeName)
+	}
+
+	sendReceipt(conn, nil)
+
+	if opts.OnComplete != nil {
+		opts.OnComplete(safeName)
+	}
+	return nil
+}
+
+// verifyChecksum reads the sender's checksum footer and compares it with
+// the checksum calculated over the received content.
+func verifyChecksum(conn net.Conn, calculated []byte) error {
+	received := make([]byte, 32)
+	if _, err := io.ReadFull(conn, received); err != nil {
+		return fmt.Errorf("failed to read checksum: %w", err)
+	}
+
+	if !bytes.Equal(calculated, received) {
+		return fmt.Errorf("%w! File may be corrupted.\nExpected: %x\nGot:      %x", errChecksumMismatch, received, calculated)
+	}
+
+	ui.Success("Checksum verified successfully.")
+	return nil
 }
 
-func unzip(src string, dest string) error {
+// receiveText reads a text snippet into memory, verifies it and hands it to
+// opts.OnText without touching the download directory.
+func receiveText(conn net.Conn, header FileHeader, opts ReceiverOptions) (err error) {
+	if header.Size < 0 || header.Size > MaxTextSize {
+		return fmt.Errorf("text snippet too large: %d bytes", header.Size)
+	}
+
+	req := TransferRequest{
+		PeerName: opts.PeerName,
+		Receipt:  true,
+	}
+	if err := writeMessage(conn, req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			sendReceipt(conn, err)
+		}
+	}()
+
+	ui.Info("Receiving text snippet (%s)", utils.FormatBytes(header.Size))
+
+	text := make([]byte, header.Size)
+	if _, err := io.ReadFull(conn, text); err != nil {
+		return fmt.Errorf("failed to read text: %w", err)
+	}
+
+	receivedChecksum := make([]byte, 32)
+	if _, err := io.ReadFull(conn, receivedChecksum); err != nil {
+		return fmt.Errorf("failed to read checksum: %w", err)
+	}
+
+	calculatedChecksum := sha256.Sum256(text)
+	if !bytes.Equal(calculatedChecksum[:], receivedChecksum) {
+		return fmt.Errorf("%w! Text may be corrupted.\nExpected: %x\nGot:      %x", errChecksumMismatch, receivedChecksum, calculatedChecksum)
+	}
+
+	ui.Success("Checksum verified successfully.")
+	if opts.OnVerified != nil {
+		opts.OnVerified(TextFileName)
+	}
+	sendReceipt(conn, nil)
+
+	opts.OnText(string(text))
+	if opts.OnComplete != nil {
+		opts.OnComplete(TextFileName)
+	}
+	return nil
+}
+
+// sendReceipt tells the sender whether the transfer was verified and saved.
+// A failure to deliver the receipt is only logged, since the local outcome
+// has already been decided.
+func sendReceipt(conn net.Conn, transferErr error) {
+	receipt := TransferReceipt{Status: ReceiptCompleted}
+	if transferErr != nil {
+		receipt.Status = ReceiptFailed
+		receipt.Error = receiptError(transferErr)
+	}
+	if err := writeMessage(conn, receipt); err != nil {
+		ui.Error("Failed to send receipt to sender: %v", err)
+	}
+}
+
+// receiptError returns the category of err to report to the sender.
+func receiptError(err error) string {
+	for _, category := range []error{errChecksumMismatch, errSaveFailed, errExtractFailed, errOfferMismatch} {
+		if errors.Is(err, category) {
+			return category.Error()
+		}
+	}
+	return errReceiveFailed.Error()
+}
+
+// saveWriter marks write errors with errSaveFailed, to tell them apart from
+// errors reading from the network.
+type saveWriter struct {
+	w io.Writer
+}
+
+func (s saveWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", errSaveFailed, err)
+	}
+	return n, err
+}
+
+// unzip extracts the archive at src into dest. allow, when set, vets every
+// entry before anything of it is written.
+func unzip(src string, dest string, allow func(f *zip.File) error) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
@@ -270,6 +578,11 @@ func unzip(src string, dest string) error {
 		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
 			return fmt.Errorf("illegal file path: %s", fpath)
 		}
+		if allow != nil {
+			if err := allow(f); err != nil {
+				return err
+			}
+		}
 
 		if f.FileInfo().IsDir() {
 			os.MkdirAll(fpath, os.ModePerm)
@@ -303,6 +616,17 @@ func unzip(src string, dest string) error {
 	return nil
 }
 
+// barWriter feeds a terminal progress bar without failing the copy when the
+// stream runs past the expected size, as archives do because of zip overhead.
+type barWriter struct {
+	bar *progressbar.ProgressBar
+}
+
+func (w barWriter) Write(p []byte) (int, error) {
+	_, _ = w.bar.Write(p)
+	return len(p), nil
+}
+
 // recvProgressWriter wraps a writer and reports progress via callback
 type recvProgressWriter struct {
 	inner      io.Writer
@@ -3,30 +3,127 @@ package transfer
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 )
 
+// MinFingerprintPrefix is the shortest fingerprint prefix accepted when
+// pinning or looking up a sender: 128 bits, so that nobody can generate a
+// certificate matching someone else's pin.
+const MinFingerprintPrefix = 32
+
+// Fingerprint returns the hex SHA-256 digest of a DER-encoded certificate.
+// Senders advertise it so receivers can find and pin a specific sender.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// IsFingerprint reports whether s looks like a fingerprint or a prefix long
+// enough to look one up: at least MinFingerprintPrefix hex digits, optionally
+// separated by colons.
+func IsFingerprint(s string) bool {
+	s = strings.ReplaceAll(s, ":", "")
+	if len(s) < MinFingerprintPrefix {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchFingerprint reports whether fingerprint starts with prefix, ignoring
+// case and colons. Prefixes that aren't valid fingerprints never match.
+func MatchFingerprint(fingerprint string, prefix string) bool {
+	if !IsFingerprint(prefix) {
+		return false
+	}
+	prefix = strings.ToLower(strings.ReplaceAll(prefix, ":", ""))
+	return strings.HasPrefix(strings.ToLower(fingerprint), prefix)
+}
+
+// pinFingerprint makes handshakes with config fail with
+// ErrFingerprintMismatch unless the peer's certificate matches fingerprint.
+// Checking during the handshake lets dialAny go on to the peer's other
+// addresses when one is answered by someone else. An empty fingerprint pins
+// nothing.
+func pinFingerprint(config *tls.Config, fingerprint string) *tls.Config {
+	if fingerprint == "" {
+		return config
+	}
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 || !MatchFingerprint(Fingerprint(cs.PeerCertificates[0].Raw), fingerprint) {
+			return ErrFingerprintMismatch
+		}
+		return nil
+	}
+	return config
+}
+
+// shareCertificate returns the certificate a share or inbox presents: the
+// device certificate if there is one, so that pins of it hold across
+// restarts, or else a new one.
+func shareCertificate(device *tls.Certificate) (tls.Certificate, error) {
+	if device != nil {
+		return *device, nil
+	}
+	cert, err := GenerateTLSCertificate()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate TLS certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// deviceCertificateValidity is how long a device certificate is valid. Peers
+// pin it by fingerprint rather than checking its dates, so it is kept for
+// as long as the device is.
+const deviceCertificateValidity = 20 * 365 * 24 * time.Hour
+
 // GenerateTLSCertificate generates a self-signed TLS certificate and key
 // valid for a short duration, suitable for ephemeral secure connections.
 func GenerateTLSCertificate() (tls.Certificate, error) {
+	certPEM, keyPEM, err := generateCertificate(24 * time.Hour)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load key pair: %w", err)
+	}
+	return cert, nil
+}
+
+// GenerateDeviceCertificate generates the long-lived certificate a device
+// presents on every share and inbox, so that peers can pin it across
+// restarts, and returns it and its key PEM-encoded, to be stored.
+func GenerateDeviceCertificate() (certPEM []byte, keyPEM []byte, err error) {
+	return generateCertificate(deviceCertificateValidity)
+}
+
+func generateCertificate(validity time.Duration) ([]byte, []byte, error) {
 	priv, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("failed to generate private key: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
 	notBefore := time.Now()
-	notAfter := notBefore.Add(24 * time.Hour)
+	notAfter := notBefore.Add(validity)
 
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
 	}
 
 	template := x509.Certificate{
@@ -44,7 +141,7 @@ func GenerateTLSCertificate() (tls.Certificate, error) {
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("failed to create certificate: %w", err)
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
 	}
 
 	// Encode cert to PEM
@@ -54,11 +151,5 @@ func GenerateTLSCertificate() (tls.Certificate, error) {
 	privBytes := x509.MarshalPKCS1PrivateKey(priv)
 	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: privBytes})
 
-	// Create tls.Certificate
-	cert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("failed to load key pair: %w", err)
-	}
-
-	return cert, nil
+	return certPEM, keyPEM, nil
 }
@@ -0,0 +1,155 @@
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ShareEntry is a file inside a multi-file share. Archive headers list every
+// entry so the receiver can choose what to download before any content is sent.
+type ShareEntry struct {
+	Path string `json:"path"` // Slash-separated path inside the archive
+	Size int64  `json:"size"`
+}
+
+// walkShare visits every file and directory that goes into the archive for
+// paths, together with the slash-separated name it gets inside the archive.
+func walkShare(paths []string, fn func(path string, name string, info os.FileInfo) error) error {
+	for _, source := range paths {
+		info, err := os.Stat(source)
+		if err != nil {
+			continue
+		}
+
+		var baseDir string
+		if info.IsDir() {
+			baseDir = filepath.Base(source)
+		}
+
+		err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name := filepath.Base(path)
+			if baseDir != "" {
+				relPath, err := filepath.Rel(source, path)
+				if err != nil {
+					return err
+				}
+				name = filepath.Join(baseDir, relPath)
+			}
+			return fn(path, filepath.ToSlash(name), info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listEntries returns the files that make up the archive for paths.
+func listEntries(paths []string) []ShareEntry {
+	var entries []ShareEntry
+	_ = walkShare(paths, func(_ string, name string, info os.FileInfo) error {
+		if !info.IsDir() {
+			entries = append(entries, ShareEntry{Path: name, Size: info.Size()})
+		}
+		return nil
+	})
+	return entries
+}
+
+// entrySelection is the set of archive paths a receiver asked for. Selecting
+// a directory selects everything below it. A nil selection includes everything.
+type entrySelection map[string]bool
+
+func newEntrySelection(selected []string) entrySelection {
+	if len(selected) == 0 {
+		return nil
+	}
+	s := make(entrySelection, len(selected))
+	for _, p := range selected {
+		s[strings.TrimSuffix(p, "/")] = true
+	}
+	return s
+}
+
+func (s entrySelection) includes(name string) bool {
+	if s == nil {
+		return true
+	}
+	for p := strings.TrimSuffix(name, "/"); p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if s[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// size returns the combined size of the selected entries.
+func (s entrySelection) size(entries []ShareEntry) int64 {
+	var total int64
+	for _, e := range entries {
+		if s.includes(e.Path) {
+			total += e.Size
+		}
+	}
+	return total
+}
+
+// takenEntries returns the paths and combined size of the files a receiver
+// takes from a multi-file share with selected. For other content, it returns
+// no paths and the size in the header.
+func takenEntries(header FileHeader, selected []string) ([]string, int64) {
+	if !header.IsArchive || len(header.Entries) == 0 {
+		return nil, header.Size
+	}
+	s := newEntrySelection(selected)
+	var paths []string
+	for _, e := range header.Entries {
+		if s.includes(e.Path) {
+			paths = append(paths, e.Path)
+		}
+	}
+	return paths, s.size(header.Entries)
+}
+
+// MatchEntries returns the paths of the entries matched by any of the glob
+// patterns. A pattern is matched against an entry's full path, against each
+// of its parent directories, and, when it contains no slash, against its base name.
+func MatchEntries(entries []ShareEntry, patterns []string) ([]string, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	var matched []string
+	for _, e := range entries {
+		for _, pattern := range patterns {
+			if matchEntry(e.Path, strings.TrimSuffix(pattern, "/")) {
+				matched = append(matched, e.Path)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+func matchEntry(name string, pattern string) bool {
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
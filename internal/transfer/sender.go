@@ -4,17 +4,21 @@ import (
 	"archive/zip"
 	"context"
 	"crypto/tls"
-	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"crypto/sha256"
 	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/netutil"
 	"github.com/example/synapse/pkg/ui"
 	"github.com/klauspost/compress/zstd"
 	"github.com/schollz/progressbar/v3"
@@ -34,13 +38,53 @@ type ProgressInfo struct {
 type SenderOptions struct {
 	AllowConn       func(string) bool
 	PortChan        chan<- int
+	OnListening     func(port int, fingerprint string) // Called once the share is announced
 	OnProgress      func(ProgressInfo)
 	OnComplete      func(peerAddr string, fileName string)
 	OnError         func(peerAddr string, err error)
 	OnTransferStart func(net.Conn)
+	OnTransferEnd   func(peerAddr string, err error) // Called after OnComplete or OnError, with the receiver's address
 	Ctx             context.Context
+	Name            string              // Local device name, advertised to receivers and shown to inbox owners
+	DeviceID        string              // Stable device identifier, advertised to receivers
+	Certificate     *tls.Certificate    // Device certificate to present; nil generates one for this share
+	Port            int                 // TCP port to listen on; 0 picks a free port
+	PortLast        int                 // With Port, the last of a range of ports tried in order
+	Interfaces      []net.Interface     // Interfaces to listen on; nil means all
+	MaxReceivers    int                 // Stop after this many successful transfers; 0 means no limit
+	IdleTimeout     time.Duration       // Stop when no receiver has connected for this long; 0 waits forever
+	Announcer       discovery.Announcer // Makes the share known; nil means mDNS and broadcast beacons
+
+	// ConcurrentPrompts lets AllowConn be called for several receivers at
+	// once, for callers that can ask about them side by side. By default
+	// calls are serialized, as a terminal can only show one prompt.
+	ConcurrentPrompts bool
+
+	// Addresses lists further addresses of the inbox for PushToInbox, such
+	// as its IPv6 ones. They are tried along with the given address.
+	Addresses []string
+
+	// Fingerprint pins the inbox for PushToInbox, like
+	// ReceiverOptions.Fingerprint; empty accepts any certificate.
+	Fingerprint string
+
+	// Code is the share code receivers can type to find the share and skip
+	// approval, from NewShareCode or ParseShareCode; empty disables codes.
+	// OnCodeAccepted is called instead of AllowConn for receivers that
+	// proved they know it.
+	Code           string
+	OnCodeAccepted func(addr string)
 }
 
+// receiptTimeout is how long a sender waits for the receipt once the content
+// is sent. Receivers extract archives before answering, which can take a
+// while for large ones.
+const receiptTimeout = 5 * time.Minute
+
+// ErrIdleTimeout is returned by a sender that stopped because of its
+// IdleTimeout before any receiver completed a transfer.
+var ErrIdleTimeout = errors.New("no receiver connected before the timeout")
+
 // StartSender starts the file transfer process as a sender.
 func StartSender(inputPaths []string, allowConn func(string) bool, portChan chan<- int) error {
 	opts := SenderOptions{
@@ -53,41 +97,58 @@ func StartSender(inputPaths []string, allowConn func(string) bool, portChan chan
 
 // StartSenderWithOptions starts the sender with extended options for GUI support
 func StartSenderWithOptions(inputPaths []string, opts SenderOptions) error {
-	if len(inputPaths) == 0 {
-		return fmt.Errorf("no input paths provided")
+	sh, err := newShare(inputPaths)
+	if err != nil {
+		return err
 	}
+	return startSharing(sh, opts)
+}
 
-	isArchive := len(inputPaths) > 1 || (len(inputPaths) == 1 && isDirectory(inputPaths[0]))
-	originalName := "Synapse_Transfer.zip"
-	if !isArchive && len(inputPaths) == 1 {
-		originalName = filepath.Base(inputPaths[0])
+// StartTextSender shares a text snippet, which receivers show inline instead
+// of saving it to disk.
+func StartTextSender(text string, opts SenderOptions) error {
+	sh, err := newTextShare(text)
+	if err != nil {
+		return err
 	}
+	return startSharing(sh, opts)
+}
 
-	var totalSize int64
-	for _, path := range inputPaths {
-		info, err := os.Stat(path)
-		if err != nil {
-			continue
-		}
-		if info.IsDir() {
-			walkDirSize(path, &totalSize)
-		} else {
-			totalSize += info.Size()
-		}
+// StartStreamSender shares data read from r, such as stdin, whose length
+// isn't known up front. A stream can only be read once, so the sender serves
+// the first approved receiver and then stops.
+func StartStreamSender(name string, r io.Reader, opts SenderOptions) error {
+	sh, err := newStreamShare(name, r)
+	if err != nil {
+		return err
 	}
+	return startSharing(sh, opts)
+}
 
+// startSharing listens for receivers, announces the share and serves every
+// approved connection until the context is cancelled or a limit in opts is reached.
+func startSharing(sh *share, opts SenderOptions) error {
 	// 1. Generate TLS Config
-	cert, err := GenerateTLSCertificate()
+	cert, err := shareCertificate(opts.Certificate)
 	if err != nil {
-		return fmt.Errorf("failed to generate TLS certificate: %w", err)
+		return err
 	}
 	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
 
+	var key ShareKey
+	if opts.Code != "" {
+		if key, err = DeriveShareKey(opts.Code, Fingerprint(cert.Certificate[0])); err != nil {
+			return err
+		}
+		tlsConfig.NextProtos = []string{codeProtocol}
+	}
+
 	// 2. Start TCP listener
-	listener, err := tls.Listen("tcp", ":0", tlsConfig)
+	tcpListener, err := netutil.Listen(opts.Interfaces, opts.Port, opts.PortLast)
 	if err != nil {
 		return fmt.Errorf("failed to listen on TCP: %w", err)
 	}
+	listener := tls.NewListener(tcpListener, tlsConfig)
 	defer listener.Close()
 
 	port := listener.Addr().(*net.TCPAddr).Port
@@ -102,18 +163,48 @@ func StartSenderWithOptions(inputPaths []string, opts SenderOptions) error {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
 	announceCtx, announceCancel := context.WithCancel(ctx)
 	defer announceCancel()
 
-	shutdownDiscovery, err := discovery.Announce(announceCtx, port)
+	fingerprint := Fingerprint(cert.Certificate[0])
+	ui.Info("Certificate fingerprint: %s", fingerprint[:MinFingerprintPrefix])
+
+	announcement := discovery.Announcement{
+		Name:        opts.Name,
+		Port:        port,
+		Fingerprint: fingerprint,
+		DeviceID:    opts.DeviceID,
+		Share:       sh.summary(),
+		Certificate: &cert,
+	}
+	if key != nil {
+		announcement.CodeTag = key.Tag(fingerprint)
+	}
+	shutdownDiscovery, err := discovery.Announce(announceCtx, opts.Announcer, announcement)
 	if err != nil {
 		return fmt.Errorf("failed to announce service: %w", err)
 	}
 	defer shutdownDiscovery()
 
+	if opts.Code != "" {
+		ui.Info("Share code: %s", opts.Code)
+	}
+	if code := NewConnectCode(opts.Interfaces, port, fingerprint).String(); code != "" {
+		ui.Info("Connection code: %s", code)
+	}
+	if opts.OnListening != nil {
+		opts.OnListening(port, fingerprint)
+	}
+
 	ui.Info("Waiting for receivers to connect... (Press Ctrl+C to stop)")
 
 	var promptMu sync.Mutex
+	var codeFailures atomic.Int32
+	var codesLocked sync.Once
+	limits := newSharingLimits(sh, opts, stop)
+	defer limits.close()
 
 	go func() {
 		<-ctx.Done()
@@ -125,7 +216,7 @@ func StartSenderWithOptions(inputPaths []string, opts SenderOptions) error {
 		if err != nil {
 			select {
 			case <-ctx.Done():
-				return nil
+				return limits.err()
 			default:
 			}
 			if listener.Addr() == nil {
@@ -137,99 +228,391 @@ func StartSenderWithOptions(inputPaths []string, opts SenderOptions) error {
 
 		go func(c net.Conn) {
 			defer c.Close()
-
-			promptMu.Lock()
-			approved := opts.AllowConn(c.RemoteAddr().String())
-			promptMu.Unlock()
-
-			if !approved {
-				ui.Info("Connection rejected.")
+			limits.connected()
+			defer limits.disconnected()
+
+			// Finish the handshake before asking for approval, so that the
+			// receiver's connection attempt, bounded by dialTimeout, never
+			// waits on the user.
+			if err := handshake(c.(*tls.Conn)); err != nil {
+				ui.Info("Rejecting %s: %v", c.RemoteAddr(), err)
 				return
 			}
 
-			if opts.OnTransferStart != nil {
-				opts.OnTransferStart(c)
+			if key != nil {
+				byCode, err := checkCode(c.(*tls.Conn), key, &codeFailures)
+				switch {
+				case errors.Is(err, ErrWrongCode):
+					ui.Info("Receiver %s gave a wrong share code, rejecting.", c.RemoteAddr())
+					return
+				case errors.Is(err, errCodesLocked):
+					codesLocked.Do(func() {
+						ui.Error("Too many wrong share codes; codes are no longer accepted.")
+					})
+					ui.Info("Rejecting %s: %v", c.RemoteAddr(), err)
+					return
+				case err != nil:
+					ui.Info("Rejecting %s: %v", c.RemoteAddr(), err)
+					return
+				case byCode:
+					// The code stands in for approval.
+					if !limits.reserve() {
+						ui.Info("No more receivers accepted, rejecting %s.", c.RemoteAddr())
+						return
+					}
+					ui.Info("Receiver %s gave the share code, accepting.", c.RemoteAddr())
+					if opts.OnCodeAccepted != nil {
+						opts.OnCodeAccepted(c.RemoteAddr().String())
+					}
+					limits.finish(sh.serve(c, opts))
+					return
+				}
 			}
 
-			ui.Success("Starting transfer to %s", c.RemoteAddr())
-			transferOpts := transferOptions{
-				onProgress: opts.OnProgress,
-				peerAddr:   c.RemoteAddr().String(),
+			if !opts.ConcurrentPrompts {
+				promptMu.Lock()
+			}
+			approved := false
+			full := limits.full()
+			if !full {
+				approved = opts.AllowConn(c.RemoteAddr().String())
+				// With concurrent prompts, the slots may have filled up meanwhile
+				full = approved && !limits.reserve()
+			}
+			if !opts.ConcurrentPrompts {
+				promptMu.Unlock()
 			}
 
-			if isArchive {
-				resolvedName, err := handleStreamingTransfer(c, inputPaths, originalName, totalSize, transferOpts)
-				if err != nil {
-					ui.Error("Transfer to %s failed: %v", c.RemoteAddr(), err)
-					if opts.OnError != nil {
-						opts.OnError(resolvedName, err)
-					}
-				} else {
-					ui.Success("Transfer to %s completed", c.RemoteAddr())
-					if opts.OnComplete != nil {
-						opts.OnComplete(resolvedName, originalName)
-					}
-				}
-			} else {
-				resolvedName, err := handleTransfer(c, originalName, inputPaths[0], totalSize, false, transferOpts)
-				if err != nil {
-					ui.Error("Transfer to %s failed: %v", c.RemoteAddr(), err)
-					if opts.OnError != nil {
-						opts.OnError(resolvedName, err)
-					}
-				} else {
-					ui.Success("Transfer to %s completed", c.RemoteAddr())
-					if opts.OnComplete != nil {
-						opts.OnComplete(resolvedName, originalName)
-					}
-				}
+			if full {
+				ui.Info("No more receivers accepted, rejecting %s.", c.RemoteAddr())
+				return
 			}
+			if !approved {
+				ui.Info("Connection rejected.")
+				return
+			}
+
+			limits.finish(sh.serve(c, opts))
 		}(conn)
 	}
 }
 
-type transferOptions struct {
-	onProgress func(ProgressInfo)
-	peerAddr   string
+// handshake completes the TLS handshake of a receiver's connection, giving
+// up after dialTimeout as the receiver would.
+func handshake(conn *tls.Conn) error {
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	return nil
 }
 
-func handleTransfer(conn net.Conn, originalName string, sourcePath string, fileSize int64, isDir bool, opts transferOptions) (string, error) {
-	compression := getCompressionMethod(originalName, isDir)
+// sharingLimits counts receivers against MaxReceivers and IdleTimeout and
+// stops the sender once a limit is reached. A stream share can only be read
+// once, so it always stops after its first receiver, whatever the outcome.
+type sharingLimits struct {
+	mu        sync.Mutex
+	max       int
+	once      bool
+	idle      time.Duration
+	timer     *time.Timer
+	stop      context.CancelFunc
+	active    int   // Connections being prompted or served
+	reserved  int   // Approved receivers, including completed ones
+	completed int   // Successful transfers
+	timedOut  bool  // Stopped by IdleTimeout
+	result    error // Outcome of a stream share
+}
 
-	header := FileHeader{
-		Name:        filepath.Base(originalName),
-		Size:        fileSize,
-		IsArchive:   isDir,
-		Compression: compression,
+func newSharingLimits(sh *share, opts SenderOptions, stop context.CancelFunc) *sharingLimits {
+	l := &sharingLimits{
+		max:  opts.MaxReceivers,
+		once: sh.isStream,
+		idle: opts.IdleTimeout,
+		stop: stop,
+	}
+	if l.once {
+		l.max = 1
+	}
+	if l.idle > 0 {
+		l.timer = time.AfterFunc(l.idle, func() {
+			l.mu.Lock()
+			l.timedOut = true
+			l.mu.Unlock()
+			ui.Info("No receiver connected for %s, stopping.", l.idle)
+			stop()
+		})
+	}
+	return l
+}
+
+func (l *sharingLimits) connected() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active++
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+}
+
+func (l *sharingLimits) disconnected() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.active == 0 && l.timer != nil && !l.timedOut {
+		l.timer.Reset(l.idle)
+	}
+}
+
+// full reports whether every receiver slot is taken.
+func (l *sharingLimits) full() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.max > 0 && l.reserved >= l.max
+}
+
+// reserve takes a receiver slot, unless they are all taken.
+func (l *sharingLimits) reserve() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.reserved >= l.max {
+		return false
+	}
+	l.reserved++
+	return true
+}
+
+// finish records the outcome of a transfer. A failed transfer frees its slot
+// for another receiver, except for streams, which can't be replayed.
+func (l *sharingLimits) finish(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.once {
+		l.result = err
+		l.stop()
+		return
+	}
+	if err != nil {
+		l.reserved--
+		return
+	}
+	l.completed++
+	if l.max > 0 && l.completed >= l.max {
+		ui.Info("Served %d receiver(s), stopping.", l.completed)
+		l.stop()
+	}
+}
+
+func (l *sharingLimits) close() {
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+}
+
+// err is the sender's result once it has stopped.
+func (l *sharingLimits) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.once {
+		return l.result
+	}
+	if l.timedOut && l.completed == 0 {
+		return ErrIdleTimeout
+	}
+	return nil
+}
+
+// share describes the content offered to receivers, whether they pull it
+// from a listening sender or it is pushed to their inbox.
+type share struct {
+	paths     []string
+	name      string
+	totalSize int64
+	isArchive bool
+	text      string
+	isText    bool
+	stream    io.Reader
+	isStream  bool
+}
+
+func newShare(inputPaths []string) (*share, error) {
+	if len(inputPaths) == 0 {
+		return nil, fmt.Errorf("no input paths provided")
+	}
+
+	isArchive := len(inputPaths) > 1 || isDirectory(inputPaths[0])
+
+	var totalSize int64
+	for _, path := range inputPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			walkDirSize(path, &totalSize)
+		} else {
+			totalSize += info.Size()
+		}
+	}
+
+	return &share{
+		paths:     inputPaths,
+		name:      ShareName(inputPaths),
+		totalSize: totalSize,
+		isArchive: isArchive,
+	}, nil
+}
+
+// ShareName returns the name the files at paths are shared under: a single
+// file keeps its own name, anything else is sent as ArchiveName.
+func ShareName(paths []string) string {
+	if len(paths) == 1 && !isDirectory(paths[0]) {
+		return filepath.Base(paths[0])
+	}
+	return ArchiveName
+}
+
+func newTextShare(text string) (*share, error) {
+	if text == "" {
+		return nil, fmt.Errorf("no text provided")
+	}
+	if len(text) > MaxTextSize {
+		return nil, fmt.Errorf("text is too long (%d bytes, max %d)", len(text), MaxTextSize)
+	}
+	return &share{
+		name:      TextFileName,
+		totalSize: int64(len(text)),
+		text:      text,
+		isText:    true,
+	}, nil
+}
+
+func newStreamShare(name string, r io.Reader) (*share, error) {
+	if r == nil {
+		return nil, fmt.Errorf("no input stream provided")
+	}
+	if name == "" {
+		name = "stdin"
+	}
+	return &share{
+		name:      name,
+		totalSize: -1,
+		stream:    r,
+		isStream:  true,
+	}, nil
+}
+
+// serve runs the transfer over an approved connection and reports the
+// outcome through the callbacks in opts.
+func (sh *share) serve(c net.Conn, opts SenderOptions) error {
+	if opts.OnTransferStart != nil {
+		opts.OnTransferStart(c)
+	}
+
+	ui.Success("Starting transfer to %s", c.RemoteAddr())
+	transferOpts := transferOptions{
+		onProgress: opts.OnProgress,
+		peerAddr:   c.RemoteAddr().String(),
+	}
+
+	var resolvedName string
+	var err error
+	if sh.isText {
+		resolvedName, err = handleTextTransfer(c, sh.text, transferOpts)
+	} else if sh.isStream {
+		resolvedName, err = handlePipeTransfer(c, sh.name, sh.stream, transferOpts)
+	} else if sh.isArchive {
+		resolvedName, err = handleStreamingTransfer(c, sh.paths, sh.name, sh.totalSize, transferOpts)
+	} else {
+		resolvedName, err = handleTransfer(c, sh.name, sh.paths[0], sh.totalSize, false, transferOpts)
+	}
+	if resolvedName == "" {
+		resolvedName = c.RemoteAddr().String()
+	}
+
+	if opts.OnTransferEnd != nil {
+		defer opts.OnTransferEnd(c.RemoteAddr().String(), err)
 	}
 
-	headerBytes, err := json.Marshal(header)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal header: %w", err)
+		ui.Error("Transfer to %s failed: %v", c.RemoteAddr(), err)
+		if opts.OnError != nil {
+			opts.OnError(resolvedName, err)
+		}
+		return err
 	}
 
-	var headerLen int64 = int64(len(headerBytes))
-	if err := binary.Write(conn, binary.BigEndian, headerLen); err != nil {
-		return "", fmt.Errorf("failed to write header length: %w", err)
+	ui.Success("Transfer to %s completed", c.RemoteAddr())
+	if opts.OnComplete != nil {
+		opts.OnComplete(resolvedName, sh.name)
 	}
+	return nil
+}
 
-	if _, err := conn.Write(headerBytes); err != nil {
-		return "", fmt.Errorf("failed to send header: %w", err)
+// offer lists the top-level entries of the share for an inbox owner to review.
+func (sh *share) offer(senderName string) Offer {
+	o := Offer{
+		SenderName: senderName,
+		TotalSize:  sh.totalSize,
+	}
+	for _, path := range sh.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		f := OfferFile{
+			Name:  filepath.Base(path),
+			Size:  info.Size(),
+			IsDir: info.IsDir(),
+		}
+		if info.IsDir() {
+			f.Size = 0
+			walkDirSize(path, &f.Size)
+		}
+		o.Files = append(o.Files, f)
 	}
+	return o
+}
 
-	var reqLen int64
-	if err := binary.Read(conn, binary.BigEndian, &reqLen); err != nil {
-		return "", fmt.Errorf("failed to read request length: %w", err)
+// summary describes the share for its announcement.
+func (sh *share) summary() *discovery.ShareSummary {
+	switch {
+	case sh.isText:
+		return &discovery.ShareSummary{Kind: discovery.ShareText, Size: sh.totalSize}
+	case sh.isStream:
+		return &discovery.ShareSummary{Kind: discovery.ShareStream, Name: sh.name}
 	}
+	s := &discovery.ShareSummary{
+		Kind: discovery.ShareFiles,
+		Size: sh.totalSize,
+		Name: filepath.Base(sh.paths[0]),
+	}
+	for _, path := range sh.paths {
+		s.Files += countFiles(path)
+	}
+	return s
+}
+
+type transferOptions struct {
+	onProgress func(ProgressInfo)
+	peerAddr   string
+}
+
+func handleTransfer(conn net.Conn, originalName string, sourcePath string, fileSize int64, isDir bool, opts transferOptions) (string, error) {
+	compression := getCompressionMethod(originalName, isDir)
 
-	reqBytes := make([]byte, reqLen)
-	if _, err := io.ReadFull(conn, reqBytes); err != nil {
-		return "", fmt.Errorf("failed to read request JSON: %w", err)
+	header := FileHeader{
+		Name:        filepath.Base(originalName),
+		Size:        fileSize,
+		IsArchive:   isDir,
+		Compression: compression,
 	}
 
-	var req TransferRequest
-	if err := json.Unmarshal(reqBytes, &req); err != nil {
-		return "", fmt.Errorf("failed to unmarshal request: %w", err)
+	req, err := exchangeHeader(conn, header)
+	if err != nil {
+		return "", err
 	}
 
 	resolvedName := req.PeerName
@@ -248,20 +631,14 @@ func handleTransfer(conn net.Conn, originalName string, sourcePath string, fileS
 
 	file, err := os.Open(sourcePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open source file: %w", err)
+		return resolvedName, fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer file.Close()
 
 	if _, err := file.Seek(offset, 0); err != nil {
-		return "", fmt.Errorf("failed to seek file: %w", err)
+		return resolvedName, fmt.Errorf("failed to seek file: %w", err)
 	}
 
-	// Setup progress tracking
-	bar := progressbar.DefaultBytes(
-		fileSize-offset,
-		"sending",
-	)
-
 	hasher := sha256.New()
 
 	destination := io.MultiWriter(conn, hasher)
@@ -273,7 +650,7 @@ func handleTransfer(conn net.Conn, originalName string, sourcePath string, fileS
 		chunked := NewChunkedWriter(destination)
 		zstdWriter, err := zstd.NewWriter(chunked)
 		if err != nil {
-			return "", fmt.Errorf("failed to create zstd writer: %w", err)
+			return resolvedName, fmt.Errorf("failed to create zstd writer: %w", err)
 		}
 		contentWriter = zstdWriter
 		closer = &compositeCloser{zstdWriter, chunked}
@@ -299,27 +676,179 @@ func handleTransfer(conn net.Conn, originalName string, sourcePath string, fileS
 		}
 	} else {
 		// CLI mode: use terminal progress bar
-		sourceReader = io.TeeReader(file, bar)
+		sourceReader = io.TeeReader(file, progressbar.DefaultBytes(fileSize-offset, "sending"))
 	}
 
 	buf := make([]byte, 4*1024*1024)
 	if _, err := io.CopyBuffer(contentWriter, sourceReader, buf); err != nil {
-		return "", fmt.Errorf("failed to send file content: %w", err)
+		return resolvedName, fmt.Errorf("failed to send file content: %w", err)
 	}
 
 	if closer != nil {
 		if err := closer.Close(); err != nil {
-			return "", fmt.Errorf("failed to close writers: %w", err)
+			return resolvedName, fmt.Errorf("failed to close writers: %w", err)
 		}
 	}
 
 	checksum := hasher.Sum(nil)
 
 	if _, err := conn.Write(checksum); err != nil {
-		return "", fmt.Errorf("failed to send checksum: %w", err)
+		return resolvedName, fmt.Errorf("failed to send checksum: %w", err)
+	}
+
+	if opts.onProgress == nil {
+		fmt.Fprintln(os.Stderr) // End the progress bar line
 	}
 
-	fmt.Println()
+	if req.Receipt {
+		if err := awaitReceipt(conn); err != nil {
+			return resolvedName, err
+		}
+	}
+	return resolvedName, nil
+}
+
+// exchangeHeader sends the file header and reads back the receiver's request.
+// A receiver that refuses the content, such as an inbox whose owner accepted
+// other files, answers with a failed TransferReceipt instead.
+func exchangeHeader(conn net.Conn, header FileHeader) (TransferRequest, error) {
+	var answer struct {
+		TransferRequest
+		TransferReceipt
+	}
+	if err := writeMessage(conn, header); err != nil {
+		return answer.TransferRequest, fmt.Errorf("failed to send header: %w", err)
+	}
+	if err := readMessage(conn, &answer); err != nil {
+		return answer.TransferRequest, fmt.Errorf("failed to read request: %w", err)
+	}
+	if answer.Status == ReceiptFailed {
+		return answer.TransferRequest, fmt.Errorf("receiver refused the transfer: %s", answer.Error)
+	}
+	return answer.TransferRequest, nil
+}
+
+// awaitReceipt waits for the receiver to confirm that it verified (and, for
+// archives, extracted) the content, and turns a reported failure into an error.
+func awaitReceipt(conn net.Conn) error {
+	ui.Info("Waiting for receiver to confirm...")
+
+	conn.SetReadDeadline(time.Now().Add(receiptTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var receipt TransferReceipt
+	if err := readMessage(conn, &receipt); err != nil {
+		return fmt.Errorf("failed to read receipt: %w", err)
+	}
+	if receipt.Status != ReceiptCompleted {
+		if receipt.Error == "" {
+			receipt.Error = "unknown error"
+		}
+		return fmt.Errorf("receiver reported failure: %s", receipt.Error)
+	}
+	return nil
+}
+
+// handleTextTransfer sends a text snippet. Snippets are small, so they are
+// always sent whole and resume offsets are ignored.
+func handleTextTransfer(conn net.Conn, text string, opts transferOptions) (string, error) {
+	header := FileHeader{
+		Name:        TextFileName,
+		Size:        int64(len(text)),
+		Kind:        KindText,
+		Compression: CompressionNone,
+	}
+
+	req, err := exchangeHeader(conn, header)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedName := req.PeerName
+	if resolvedName == "" {
+		resolvedName = opts.peerAddr
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(conn, hasher), strings.NewReader(text)); err != nil {
+		return resolvedName, fmt.Errorf("failed to send text: %w", err)
+	}
+
+	if _, err := conn.Write(hasher.Sum(nil)); err != nil {
+		return resolvedName, fmt.Errorf("failed to send checksum: %w", err)
+	}
+
+	if req.Receipt {
+		if err := awaitReceipt(conn); err != nil {
+			return resolvedName, err
+		}
+	}
+	return resolvedName, nil
+}
+
+// handlePipeTransfer sends a stream of unknown length. The content uses the
+// same chunked framing as archives, so the receiver finds the end of the
+// stream without a size, and the checksum covers the raw bytes.
+func handlePipeTransfer(conn net.Conn, name string, r io.Reader, opts transferOptions) (string, error) {
+	header := FileHeader{
+		Name:        name,
+		Size:        -1,
+		Compression: CompressionChunked,
+	}
+
+	req, err := exchangeHeader(conn, header)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedName := req.PeerName
+	if resolvedName == "" {
+		resolvedName = opts.peerAddr
+	}
+
+	if req.Offset > 0 {
+		ui.Info("Resuming not supported for piped transfers, starting from beginning")
+	}
+
+	hasher := sha256.New()
+	chunkedW := NewChunkedWriter(conn)
+
+	var source io.Reader
+	if opts.onProgress != nil {
+		source = &progressReader{
+			inner:    r,
+			total:    -1,
+			fileName: name,
+			peerAddr: opts.peerAddr,
+			peerName: resolvedName,
+			callback: opts.onProgress,
+		}
+	} else {
+		source = io.TeeReader(r, progressbar.DefaultBytes(-1, "sending"))
+	}
+
+	buf := make([]byte, 4*1024*1024)
+	if _, err := io.CopyBuffer(io.MultiWriter(chunkedW, hasher), source, buf); err != nil {
+		return resolvedName, fmt.Errorf("failed to stream input: %w", err)
+	}
+
+	if err := chunkedW.Close(); err != nil {
+		return resolvedName, fmt.Errorf("failed to close chunked writer: %w", err)
+	}
+
+	if _, err := conn.Write(hasher.Sum(nil)); err != nil {
+		return resolvedName, fmt.Errorf("failed to send checksum: %w", err)
+	}
+
+	if opts.onProgress == nil {
+		fmt.Fprintln(os.Stderr) // End the progress bar line
+	}
+
+	if req.Receipt {
+		if err := awaitReceipt(conn); err != nil {
+			return resolvedName, err
+		}
+	}
 	return resolvedName, nil
 }
 
@@ -375,78 +904,57 @@ func isDirectory(path string) bool {
 	return info.IsDir()
 }
 
-func zipPaths(paths []string, target io.Writer) error {
+// zipPaths writes the archive for paths to target, keeping only the entries
+// in selection (or everything, when selection is nil).
+func zipPaths(paths []string, selection entrySelection, target io.Writer) error {
 	archive := zip.NewWriter(target)
 	defer archive.Close()
 
-	for _, source := range paths {
-		info, err := os.Stat(source)
-		if err != nil {
-			continue
+	return walkShare(paths, func(path string, name string, info os.FileInfo) error {
+		// Parent directories are recreated on extraction, so a partial
+		// selection only needs its files.
+		if selection != nil && (info.IsDir() || !selection.includes(name)) {
+			return nil
 		}
 
-		var baseDir string
-		if info.IsDir() {
-			baseDir = filepath.Base(source)
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
 		}
+		header.Name = name
 
-		err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			header, err := zip.FileInfoHeader(info)
-			if err != nil {
-				return err
-			}
-
-			if baseDir != "" {
-				relPath, err := filepath.Rel(source, path)
-				if err != nil {
-					return err
-				}
-				header.Name = filepath.Join(baseDir, relPath)
-			} else {
-				header.Name = filepath.Base(path)
-			}
-
-			if info.IsDir() {
-				header.Name += "/"
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			method := getCompressionMethod(info.Name(), false)
+			if method == CompressionZstd {
+				header.Method = zip.Deflate
 			} else {
-				method := getCompressionMethod(info.Name(), false)
-				if method == CompressionZstd {
-					header.Method = zip.Deflate
-				} else {
-					header.Method = zip.Store
-				}
+				header.Method = zip.Store
 			}
+		}
 
-			writer, err := archive.CreateHeader(header)
-			if err != nil {
-				return err
-			}
+		writer, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
 
-			if info.IsDir() {
-				return nil
-			}
+		if info.IsDir() {
+			return nil
+		}
 
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-			_, err = io.Copy(writer, file)
-			return err
-		})
+		file, err := os.Open(path)
 		if err != nil {
 			return err
 		}
-	}
-	return nil
+		defer file.Close()
+		_, err = io.Copy(writer, file)
+		return err
+	})
 }
 
 func zipDirectory(source string, target io.Writer) error {
-	return zipPaths([]string{source}, target)
+	return zipPaths([]string{source}, nil, target)
 }
 
 func walkDirSize(path string, total *int64) error {
@@ -467,47 +975,38 @@ func walkDirSize(path string, total *int64) error {
 	return nil
 }
 
+// countFiles returns the number of files at or under path.
+func countFiles(path string) int {
+	n := 0
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
 func handleStreamingTransfer(conn net.Conn, inputPaths []string, originalName string, totalSize int64, opts transferOptions) (string, error) {
 	// We use CompressionChunked to stream the zip archive.
 	// This means the receiver will use ChunkedReader which reads length-prefixed
 	// chunks and detects EOF when a zero-length chunk is sent.
 	// This avoids the problem where header.Size doesn't match the actual zip size.
 
+	entries := listEntries(inputPaths)
 	header := FileHeader{
 		Name:        filepath.Base(originalName),
 		Size:        totalSize, // Approximate — receiver uses chunked framing, not Size, to detect EOF
 		IsArchive:   true,
 		Compression: CompressionChunked,
+		Entries:     entries,
 	}
 
-	headerBytes, err := json.Marshal(header)
+	req, err := exchangeHeader(conn, header)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal header: %w", err)
-	}
-
-	if err := binary.Write(conn, binary.BigEndian, int64(len(headerBytes))); err != nil {
-		return "", fmt.Errorf("failed to write header length: %w", err)
+		return "", err
 	}
 
-	if _, err := conn.Write(headerBytes); err != nil {
-		return "", fmt.Errorf("failed to send header: %w", err)
-	}
-
-	var reqLen int64
-	if err := binary.Read(conn, binary.BigEndian, &reqLen); err != nil {
-		return "", fmt.Errorf("failed to read request length: %w", err)
-	}
-
-	reqBytes := make([]byte, reqLen)
-	if _, err := io.ReadFull(conn, reqBytes); err != nil {
-		return "", fmt.Errorf("failed to read request JSON: %w", err)
-	}
-
-	var req TransferRequest
-	if err := json.Unmarshal(reqBytes, &req); err != nil {
-		return "", fmt.Errorf("failed to unmarshal request: %w", err)
-	}
-	
 	resolvedName := req.PeerName
 	if resolvedName == "" {
 		resolvedName = opts.peerAddr
@@ -517,6 +1016,12 @@ func handleStreamingTransfer(conn net.Conn, inputPaths []string, originalName st
 		ui.Info("Resuming not supported for streaming transfers, starting from beginning")
 	}
 
+	selection := newEntrySelection(req.Select)
+	if selection != nil {
+		totalSize = selection.size(entries)
+		ui.Info("Receiver selected %d of %d entries", len(req.Select), len(entries))
+	}
+
 	hasher := sha256.New()
 
 	// Wrap conn in a ChunkedWriter so the receiver knows where the stream ends
@@ -531,7 +1036,7 @@ func handleStreamingTransfer(conn net.Conn, inputPaths []string, originalName st
 	go func() {
 		defer zipWg.Done()
 		defer writer.Close()
-		zipErr = zipPaths(inputPaths, writer)
+		zipErr = zipPaths(inputPaths, selection, writer)
 	}()
 
 	// Hash raw data from the pipe (before chunked framing) and send through chunked writer
@@ -557,27 +1062,34 @@ func handleStreamingTransfer(conn net.Conn, inputPaths []string, originalName st
 	if err != nil {
 		reader.Close()
 		zipWg.Wait()
-		return "", fmt.Errorf("failed to stream archive: %w", err)
+		return resolvedName, fmt.Errorf("failed to stream archive: %w", err)
 	}
 
 	// Close the chunked writer to send the zero-length EOF marker
 	if err := chunkedW.Close(); err != nil {
 		reader.Close()
 		zipWg.Wait()
-		return "", fmt.Errorf("failed to close chunked writer: %w", err)
+		return resolvedName, fmt.Errorf("failed to close chunked writer: %w", err)
 	}
 
 	zipWg.Wait()
 	if zipErr != nil {
-		return "", fmt.Errorf("failed to create archive: %w", zipErr)
+		return resolvedName, fmt.Errorf("failed to create archive: %w", zipErr)
 	}
 
 	checksum := hasher.Sum(nil)
 	if _, err := conn.Write(checksum); err != nil {
-		return "", fmt.Errorf("failed to send checksum: %w", err)
+		return resolvedName, fmt.Errorf("failed to send checksum: %w", err)
 	}
 
-	fmt.Println()
+	if opts.onProgress == nil {
+		fmt.Fprintln(os.Stderr) // End the progress bar line
+	}
+
+	if req.Receipt {
+		if err := awaitReceipt(conn); err != nil {
+			return resolvedName, err
+		}
+	}
 	return resolvedName, nil
 }
-
@@ -0,0 +1,295 @@
+package transfer
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Share codes are short phrases such as 7-tiger-lamp-ocean that a sender
+// shows and a receiver types. They find the share on the network, through a
+// keyed hash announced in its TXT record, and authenticate the connection
+// both ways, so a receiver who knows the code needn't be approved.
+//
+// The code never travels in the clear. It is stretched into a ShareKey with
+// PBKDF2, salted with the fingerprint of the share's certificate, which
+// makes guessing it from the TXT hash slow and keeps keys from being
+// computed ahead of time; receivers derive one for each share they consider.
+// Over the connection each side proves it holds the key with an HMAC of the
+// TLS session's exported keying material, which ties the proof to that
+// session.
+
+const (
+	// codeProtocol is the ALPN protocol a receiver offers when it has a
+	// share code; a sender that also has one answers with it, and both then
+	// exchange proofs before anything else.
+	codeProtocol = "synapse-code/1"
+
+	shareCodeWords     = 3
+	shareCodeMaxNumber = 99
+	shareKeySalt       = "synapse share code"
+	shareKeyIterations = 600_000
+	codeExporterLabel  = "EXPORTER-synapse-share-code"
+	codeProofTimeout   = 10 * time.Second
+
+	// maxCodeFailures is how many wrong codes a share tolerates before it
+	// stops accepting codes, to keep them from being guessed online.
+	maxCodeFailures = 5
+)
+
+// ErrWrongCode is returned to a receiver whose share code the sender didn't
+// accept, or when the sender couldn't prove it knows the code.
+var ErrWrongCode = errors.New("wrong share code")
+
+// NewShareCode returns a random share code: a number and three words, such
+// as 7-tiger-lamp-ocean.
+func NewShareCode() string {
+	parts := []string{strconv.Itoa(randomInt(shareCodeMaxNumber) + 1)}
+	for range shareCodeWords {
+		parts = append(parts, shareCodeWordList[randomInt(len(shareCodeWordList))])
+	}
+	return strings.Join(parts, "-")
+}
+
+func randomInt(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(err) // crypto/rand doesn't fail
+	}
+	return int(i.Int64())
+}
+
+// ParseShareCode checks that s is a share code and returns it normalized:
+// lowercase, with words separated by dashes, however it was typed.
+func ParseShareCode(s string) (string, error) {
+	parts := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == '-' || r == ' ' || r == '_' || r == '.'
+	})
+	if len(parts) != shareCodeWords+1 {
+		return "", fmt.Errorf("invalid share code %q: expected a number and %d words, like 7-tiger-lamp-ocean", s, shareCodeWords)
+	}
+	if n, err := strconv.Atoi(parts[0]); err != nil || n < 1 {
+		return "", fmt.Errorf("invalid share code %q: it should start with a number", s)
+	}
+	for _, word := range parts[1:] {
+		if !slices.Contains(shareCodeWordList, word) {
+			return "", fmt.Errorf("invalid share code %q: unknown word %q", s, word)
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// ShareKey is the secret derived from a share code.
+type ShareKey []byte
+
+// DeriveShareKey stretches a normalized share code into its key for the
+// share whose certificate has fingerprint. It is slow on purpose, so derive
+// it once per code and share.
+func DeriveShareKey(code, fingerprint string) (ShareKey, error) {
+	salt := []byte(shareKeySalt + "\x00" + strings.ToLower(fingerprint))
+	key, err := pbkdf2.Key(sha256.New, code, salt, shareKeyIterations, sha256.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive share key: %w", err)
+	}
+	return key, nil
+}
+
+// CodeMatcher finds the share that announces a share code among discovered
+// peers. It derives the code's key for each share with a tag, once.
+type CodeMatcher struct {
+	code string
+
+	mu   sync.Mutex
+	keys map[string]ShareKey // By certificate fingerprint
+}
+
+// NewCodeMatcher returns a CodeMatcher for a normalized share code.
+func NewCodeMatcher(code string) *CodeMatcher {
+	return &CodeMatcher{code: code, keys: make(map[string]ShareKey)}
+}
+
+// Matches reports whether tag was announced by the share with the code and
+// the certificate fingerprint.
+func (m *CodeMatcher) Matches(tag, fingerprint string) bool {
+	if tag == "" || fingerprint == "" {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[fingerprint]
+	if !ok {
+		var err error
+		if key, err = DeriveShareKey(m.code, fingerprint); err != nil {
+			return false
+		}
+		m.keys[fingerprint] = key
+	}
+	return key.Matches(tag, fingerprint)
+}
+
+// Tag returns the hash a share with this key announces, bound to the
+// fingerprint of its certificate so tags differ from one share to the next.
+func (k ShareKey) Tag(fingerprint string) string {
+	return hex.EncodeToString(k.mac("tag", []byte(strings.ToLower(fingerprint)))[:8])
+}
+
+// Matches reports whether tag was announced by a share with this key and
+// certificate fingerprint.
+func (k ShareKey) Matches(tag, fingerprint string) bool {
+	return tag != "" && hmac.Equal([]byte(tag), []byte(k.Tag(fingerprint)))
+}
+
+func (k ShareKey) mac(label string, data []byte) []byte {
+	h := hmac.New(sha256.New, k)
+	h.Write([]byte(label))
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// proof is what one side of conn sends to show it holds the key. role keeps
+// the receiver's proof from being replayed as the sender's.
+func (k ShareKey) proof(conn *tls.Conn, role string) ([]byte, error) {
+	state := conn.ConnectionState()
+	ekm, err := state.ExportKeyingMaterial(codeExporterLabel, nil, sha256.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export keying material: %w", err)
+	}
+	return k.mac(role, ekm), nil
+}
+
+// proveCode runs the receiver's side of share code authentication: it derives
+// the key for the sender's certificate, sends its proof, then checks the
+// sender's.
+func proveCode(conn *tls.Conn, code string) error {
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != codeProtocol {
+		return fmt.Errorf("%w: the sender doesn't use share codes", ErrWrongCode)
+	}
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: the sender has no certificate", ErrWrongCode)
+	}
+	key, err := DeriveShareKey(code, Fingerprint(state.PeerCertificates[0].Raw))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(codeProofTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	mine, err := key.proof(conn, "receiver")
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(mine); err != nil {
+		return fmt.Errorf("failed to send share code proof: %w", err)
+	}
+	theirs := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, theirs); err != nil {
+		// The sender hangs up on a wrong code.
+		return ErrWrongCode
+	}
+	expected, err := key.proof(conn, "sender")
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(theirs, expected) {
+		return fmt.Errorf("%w: the sender doesn't know it", ErrWrongCode)
+	}
+	return nil
+}
+
+// errCodesLocked is returned by checkCode once a share has seen
+// maxCodeFailures wrong codes.
+var errCodesLocked = errors.New("too many wrong share codes, codes are no longer accepted")
+
+// checkCode runs the sender's side of share code authentication. It reports
+// whether the receiver asked to authenticate at all, and fails if it did
+// with the wrong code, or at all once failures has reached maxCodeFailures.
+// Each attempt counts as a failure until its proof checks out, so that
+// receivers trying codes at the same time get no more guesses between them.
+func checkCode(conn *tls.Conn, key ShareKey, failures *atomic.Int32) (bool, error) {
+	conn.SetDeadline(time.Now().Add(codeProofTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := conn.Handshake(); err != nil {
+		return false, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	if conn.ConnectionState().NegotiatedProtocol != codeProtocol {
+		return false, nil
+	}
+	if failures.Add(1) > maxCodeFailures {
+		failures.Add(-1)
+		return true, errCodesLocked
+	}
+
+	theirs := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, theirs); err != nil {
+		return true, fmt.Errorf("failed to read share code proof: %w", err)
+	}
+	expected, err := key.proof(conn, "receiver")
+	if err != nil {
+		return true, err
+	}
+	if !hmac.Equal(theirs, expected) {
+		return true, ErrWrongCode
+	}
+	failures.Add(-1)
+	mine, err := key.proof(conn, "sender")
+	if err != nil {
+		return true, err
+	}
+	if _, err := conn.Write(mine); err != nil {
+		return true, fmt.Errorf("failed to send share code proof: %w", err)
+	}
+	return true, nil
+}
+
+// shareCodeWordList holds the words of share codes: 256 short, common words
+// that are hard to mistake for one another.
+var shareCodeWordList = []string{
+	"acid", "acorn", "actor", "agent", "alarm", "album", "alpha", "amber",
+	"angle", "apple", "apron", "arch", "arena", "arrow", "atlas", "atom",
+	"badge", "bagel", "baker", "bamboo", "banjo", "barn", "basil", "beach",
+	"beard", "bell", "berry", "bison", "blade", "blank", "blaze", "bloom",
+	"board", "boat", "bonus", "book", "boots", "brass", "bread", "brick",
+	"bride", "brook", "brush", "bubble", "bucket", "cabin", "cable", "cactus",
+	"camel", "camera", "candle", "canoe", "canyon", "cargo", "carpet", "castle",
+	"cedar", "chalk", "cheese", "cherry", "chess", "chief", "chimney", "cider",
+	"cinema", "circus", "citrus", "clock", "cloud", "clover", "coast", "cobra",
+	"cocoa", "comet", "copper", "coral", "cotton", "crane", "crayon", "cricket",
+	"crown", "cube", "cupid", "daisy", "dancer", "delta", "denim", "desert",
+	"diamond", "dinner", "dragon", "drum", "eagle", "earth", "echo", "eclipse",
+	"elbow", "ember", "engine", "falcon", "feather", "fern", "ferry", "fiddle",
+	"flame", "flute", "forest", "fossil", "fox", "frost", "fudge", "galaxy",
+	"garden", "garlic", "gecko", "ghost", "ginger", "glacier", "globe", "gold",
+	"grape", "gravel", "guitar", "hammer", "harbor", "hazel", "helmet", "hero",
+	"honey", "horse", "igloo", "island", "ivory", "jacket", "jaguar", "jelly",
+	"jewel", "jungle", "kayak", "kettle", "kite", "koala", "ladder", "lagoon",
+	"lamp", "lemon", "lily", "lion", "lizard", "llama", "lobster", "lotus",
+	"magnet", "mango", "maple", "marble", "meadow", "melon", "meteor", "mint",
+	"mirror", "monkey", "moose", "mosaic", "muffin", "nebula", "needle", "nest",
+	"noodle", "novel", "oasis", "ocean", "olive", "onion", "opera", "orbit",
+	"orchid", "otter", "owl", "oyster", "paddle", "palace", "panda", "paper",
+	"parrot", "peach", "pearl", "pebble", "pepper", "piano", "pilot", "pine",
+	"planet", "plum", "pocket", "polar", "pony", "puzzle", "quartz", "quill",
+	"rabbit", "radar", "radio", "raven", "reef", "ribbon", "river", "robin",
+	"rocket", "ruby", "saddle", "salmon", "sapphire", "scarf", "shadow", "shell",
+	"silver", "sketch", "sloth", "snow", "socket", "spider", "spoon", "spruce",
+	"stone", "storm", "sugar", "summit", "sunset", "swan", "table", "tango",
+	"thunder", "tiger", "timber", "toast", "tomato", "topaz", "torch", "tulip",
+	"tundra", "turtle", "umbrella", "velvet", "violin", "volcano", "wagon", "walnut",
+	"whale", "willow", "window", "winter", "wizard", "yacht", "zebra", "zipper",
+}
@@ -1,11 +1,22 @@
 package transfer
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/example/synapse/internal/discovery"
 )
 
 func TestTransferIntegration(t *testing.T) {
@@ -80,3 +91,971 @@ func TestTransferIntegration(t *testing.T) {
 		t.Errorf("Content mismatch.\nExpected: %s\nGot:      %s", content, receivedContent)
 	}
 }
+
+func TestTransferReceiptReportsReceiverFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "payload")
+	if err := os.Mkdir(srcDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("payload"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	// A regular file where the archive's directory belongs makes extraction fail
+	// on the receiver after the checksum has already been verified.
+	recvDir := filepath.Join(tmpDir, "received")
+	if err := os.Mkdir(recvDir, 0755); err != nil {
+		t.Fatalf("Failed to create recv dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(recvDir, "payload"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create blocking file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	senderResult := make(chan error, 1)
+	opts := SenderOptions{
+		AllowConn: func(addr string) bool { return true },
+		PortChan:  portChan,
+		OnComplete: func(peerAddr string, fileName string) {
+			senderResult <- nil
+		},
+		OnError: func(peerAddr string, err error) {
+			senderResult <- err
+		},
+		Ctx: ctx,
+	}
+	go StartSenderWithOptions([]string{srcDir}, opts)
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	if err := ReceiveConnectWithOptions(address, ReceiverOptions{DownloadDir: recvDir}); err == nil {
+		t.Fatalf("Expected receiver to fail extracting the archive")
+	}
+
+	select {
+	case err := <-senderResult:
+		if err == nil {
+			t.Fatalf("Sender reported success for a failed transfer")
+		}
+		if !strings.Contains(err.Error(), "receiver reported failure") {
+			t.Errorf("Unexpected sender error: %v", err)
+		}
+		if strings.Contains(err.Error(), tmpDir) {
+			t.Errorf("Receipt leaked the receiver's paths: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender outcome")
+	}
+}
+
+func TestPushToInbox(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "pushed.txt")
+	content := []byte("pushed straight into the inbox")
+	if err := os.WriteFile(srcFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	recvDir := filepath.Join(tmpDir, "inbox")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	offers := make(chan Offer, 1)
+	go StartInbox(InboxOptions{
+		DownloadDir: recvDir,
+		AcceptOffer: func(peerAddr string, offer Offer) bool {
+			offers <- offer
+			return true
+		},
+		PortChan: portChan,
+		Ctx:      ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for inbox to start")
+	}
+
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	if err := PushToInbox(address, []string{srcFile}, SenderOptions{Name: "tester"}); err != nil {
+		t.Fatalf("PushToInbox failed: %v", err)
+	}
+
+	offer := <-offers
+	if offer.SenderName != "tester" || len(offer.Files) != 1 || offer.Files[0].Name != "pushed.txt" {
+		t.Errorf("Unexpected offer: %+v", offer)
+	}
+
+	received, err := os.ReadFile(filepath.Join(recvDir, "pushed.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(received) != string(content) {
+		t.Errorf("Content mismatch.\nExpected: %s\nGot:      %s", content, received)
+	}
+}
+
+// startTestInbox runs an inbox accepting every offer into dir and returns
+// its address.
+func startTestInbox(t *testing.T, ctx context.Context, dir string) string {
+	t.Helper()
+	portChan := make(chan int, 1)
+	go StartInbox(InboxOptions{
+		DownloadDir: dir,
+		AcceptOffer: func(peerAddr string, offer Offer) bool { return true },
+		PortChan:    portChan,
+		Ctx:         ctx,
+	})
+	select {
+	case port := <-portChan:
+		return fmt.Sprintf("127.0.0.1:%d", port)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for inbox to start")
+		return ""
+	}
+}
+
+func TestPushToInboxKeepsExistingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "report.txt")
+	if err := os.WriteFile(srcFile, []byte("new report"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	recvDir := filepath.Join(tmpDir, "inbox")
+	if err := os.MkdirAll(recvDir, 0755); err != nil {
+		t.Fatalf("Failed to create inbox dir: %v", err)
+	}
+	// A shorter file by the same name is what a resume would append to.
+	existing := filepath.Join(recvDir, "report.txt")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to create existing file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	address := startTestInbox(t, ctx, recvDir)
+
+	if err := PushToInbox(address, []string{srcFile}, SenderOptions{Name: "tester"}); err != nil {
+		t.Fatalf("PushToInbox failed: %v", err)
+	}
+
+	if old, _ := os.ReadFile(existing); string(old) != "old" {
+		t.Errorf("Existing file was changed: %q", old)
+	}
+	received, err := os.ReadFile(filepath.Join(recvDir, "report (1).txt"))
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(received) != "new report" {
+		t.Errorf("Unexpected content: %q", received)
+	}
+}
+
+func TestInboxRefusesContentOtherThanOffered(t *testing.T) {
+	recvDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	address := startTestInbox(t, ctx, recvDir)
+
+	conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect to inbox: %v", err)
+	}
+	defer conn.Close()
+
+	offer := Offer{SenderName: "tester", Files: []OfferFile{{Name: "small.txt", Size: 5}}, TotalSize: 5}
+	if err := writeMessage(conn, offer); err != nil {
+		t.Fatalf("Failed to send offer: %v", err)
+	}
+	var resp OfferResponse
+	if err := readMessage(conn, &resp); err != nil || !resp.Accepted {
+		t.Fatalf("Expected the offer to be accepted, got %+v, %v", resp, err)
+	}
+
+	header := FileHeader{Name: "other.bin", Size: 1 << 20, Compression: CompressionNone}
+	if err := writeMessage(conn, header); err != nil {
+		t.Fatalf("Failed to send header: %v", err)
+	}
+	var receipt TransferReceipt
+	if err := readMessage(conn, &receipt); err != nil {
+		t.Fatalf("Failed to read the inbox's answer: %v", err)
+	}
+	if receipt.Status != ReceiptFailed {
+		t.Errorf("Expected a failed receipt, got %+v", receipt)
+	}
+	if entries, _ := os.ReadDir(recvDir); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written, found %d entries", len(entries))
+	}
+}
+
+func TestPushToInboxFingerprintPinning(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "pinned.txt")
+	if err := os.WriteFile(srcFile, []byte("pinned content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	offered := make(chan Offer, 1)
+	go StartInbox(InboxOptions{
+		DownloadDir: filepath.Join(tmpDir, "inbox"),
+		AcceptOffer: func(peerAddr string, offer Offer) bool {
+			offered <- offer
+			return true
+		},
+		PortChan: portChan,
+		Ctx:      ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for inbox to start")
+	}
+
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	err := PushToInbox(address, []string{srcFile}, SenderOptions{Name: "tester", Fingerprint: "00000000000000000000000000000000"})
+	if !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+	select {
+	case offer := <-offered:
+		t.Errorf("Expected no offer to reach an unpinned inbox, got %+v", offer)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSelectiveDownload(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "payload")
+	files := map[string]string{
+		"a.txt":     "top level",
+		"sub/b.txt": "nested text",
+		"sub/c.log": "nested log",
+	}
+	for name, content := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	go StartSenderWithOptions([]string{srcDir}, SenderOptions{
+		AllowConn: func(addr string) bool { return true },
+		PortChan:  portChan,
+		Ctx:       ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	recvDir := filepath.Join(tmpDir, "received")
+	var listed []ShareEntry
+	opts := ReceiverOptions{
+		DownloadDir: recvDir,
+		SelectEntries: func(entries []ShareEntry) ([]string, error) {
+			listed = entries
+			return MatchEntries(entries, []string{"payload/sub", "a.txt"})
+		},
+	}
+	if err := ReceiveConnectWithOptions(fmt.Sprintf("127.0.0.1:%d", port), opts); err != nil {
+		t.Fatalf("ReceiveConnectWithOptions failed: %v", err)
+	}
+
+	if len(listed) != len(files) {
+		t.Errorf("Expected %d listed entries, got %d: %+v", len(files), len(listed), listed)
+	}
+
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.log"} {
+		if _, err := os.Stat(filepath.Join(recvDir, "payload", filepath.FromSlash(name))); err != nil {
+			t.Errorf("Expected %s to be received: %v", name, err)
+		}
+	}
+
+	// A narrower selection leaves the rest of the share behind.
+	recvDir = filepath.Join(tmpDir, "received-txt")
+	opts.DownloadDir = recvDir
+	opts.SelectEntries = func(entries []ShareEntry) ([]string, error) {
+		return MatchEntries(entries, []string{"*.txt"})
+	}
+	var taken []string
+	var takenSize int64
+	opts.OnReceiving = func(fileName string, size int64, files []string) {
+		taken, takenSize = files, size
+	}
+	if err := ReceiveConnectWithOptions(fmt.Sprintf("127.0.0.1:%d", port), opts); err != nil {
+		t.Fatalf("ReceiveConnectWithOptions failed: %v", err)
+	}
+	slices.Sort(taken)
+	if want := []string{"payload/a.txt", "payload/sub/b.txt"}; !slices.Equal(taken, want) {
+		t.Errorf("OnReceiving got files %v, want %v", taken, want)
+	}
+	if want := int64(len(files["a.txt"]) + len(files["sub/b.txt"])); takenSize != want {
+		t.Errorf("OnReceiving got size %d, want %d", takenSize, want)
+	}
+	if _, err := os.Stat(filepath.Join(recvDir, "payload", "sub", "c.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected unselected sub/c.log to be skipped, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(recvDir, "payload", "sub", "b.txt")); err != nil {
+		t.Errorf("Expected sub/b.txt to be received: %v", err)
+	}
+}
+
+func TestTextSnippet(t *testing.T) {
+	tmpDir := t.TempDir()
+	snippet := "https://example.com/?q=synapse\nsecond line"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	go StartTextSender(snippet, SenderOptions{
+		AllowConn: func(addr string) bool { return true },
+		PortChan:  portChan,
+		Ctx:       ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	recvDir := filepath.Join(tmpDir, "received")
+	var received string
+	opts := ReceiverOptions{
+		DownloadDir: recvDir,
+		OnText: func(text string) {
+			received = text
+		},
+	}
+	if err := ReceiveConnectWithOptions(fmt.Sprintf("127.0.0.1:%d", port), opts); err != nil {
+		t.Fatalf("ReceiveConnectWithOptions failed: %v", err)
+	}
+
+	if received != snippet {
+		t.Errorf("Text mismatch. Expected %q, got %q", snippet, received)
+	}
+	if _, err := os.Stat(filepath.Join(recvDir, TextFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written for a text snippet, got err=%v", err)
+	}
+}
+
+func TestPipeTransfer(t *testing.T) {
+	payload := bytes.Repeat([]byte("piped data "), 100000)
+
+	portChan := make(chan int, 1)
+	senderDone := make(chan error, 1)
+	go func() {
+		senderDone <- StartStreamSender("stdin", bytes.NewReader(payload), SenderOptions{
+			AllowConn: func(addr string) bool { return true },
+			PortChan:  portChan,
+		})
+	}()
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	var sink bytes.Buffer
+	opts := ReceiverOptions{
+		DownloadDir: t.TempDir(),
+		Sink:        &sink,
+	}
+	if err := ReceiveConnectWithOptions(fmt.Sprintf("127.0.0.1:%d", port), opts); err != nil {
+		t.Fatalf("ReceiveConnectWithOptions failed: %v", err)
+	}
+
+	if !bytes.Equal(sink.Bytes(), payload) {
+		t.Errorf("Stream mismatch. Expected %d bytes, got %d", len(payload), sink.Len())
+	}
+
+	// A stream can only be sent once, so the sender stops on its own.
+	select {
+	case err := <-senderDone:
+		if err != nil {
+			t.Errorf("Sender reported error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Sender did not stop after the stream was sent")
+	}
+}
+
+func TestSenderStopsAfterMaxReceivers(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "limited.txt")
+	if err := os.WriteFile(srcFile, []byte("limited content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	portChan := make(chan int, 1)
+	senderDone := make(chan error, 1)
+	go func() {
+		senderDone <- StartSenderWithOptions([]string{srcFile}, SenderOptions{
+			AllowConn:    func(addr string) bool { return true },
+			PortChan:     portChan,
+			MaxReceivers: 2,
+		})
+	}()
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	for i := 0; i < 2; i++ {
+		opts := ReceiverOptions{DownloadDir: filepath.Join(tmpDir, fmt.Sprintf("received-%d", i))}
+		if err := ReceiveConnectWithOptions(fmt.Sprintf("127.0.0.1:%d", port), opts); err != nil {
+			t.Fatalf("Receiver %d failed: %v", i, err)
+		}
+	}
+
+	select {
+	case err := <-senderDone:
+		if err != nil {
+			t.Errorf("Sender reported error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Sender did not stop after serving its receivers")
+	}
+}
+
+func TestFingerprintPinning(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "pinned.txt")
+	if err := os.WriteFile(srcFile, []byte("pinned content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	go StartSenderWithOptions([]string{srcFile}, SenderOptions{
+		AllowConn: func(addr string) bool { return true },
+		PortChan:  portChan,
+		Ctx:       ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	opts := ReceiverOptions{
+		DownloadDir: filepath.Join(tmpDir, "received"),
+		Fingerprint: "00000000000000000000000000000000",
+	}
+	err := ReceiveConnectWithOptions(fmt.Sprintf("127.0.0.1:%d", port), opts)
+	if !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "received", "pinned.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be received from an unpinned sender")
+	}
+}
+
+func TestFingerprintPinningSkipsOtherPeers(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "pinned.txt")
+	if err := os.WriteFile(srcFile, []byte("from the pinned sender"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	fingerprints := make(chan string, 1)
+	go StartSenderWithOptions([]string{srcFile}, SenderOptions{
+		AllowConn:   func(addr string) bool { return true },
+		PortChan:    portChan,
+		OnListening: func(port int, fingerprint string) { fingerprints <- fingerprint },
+		Ctx:         ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+	fingerprint := <-fingerprints
+
+	// The first address is answered, quickly, by someone else.
+	cert, err := GenerateTLSCertificate()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	impostor, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer impostor.Close()
+	go func() {
+		for {
+			conn, err := impostor.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	opts := ReceiverOptions{
+		DownloadDir: filepath.Join(tmpDir, "received"),
+		Fingerprint: fingerprint,
+		Addresses:   []string{fmt.Sprintf("127.0.0.1:%d", port)},
+	}
+	if err := ReceiveConnectWithOptions(impostor.Addr().String(), opts); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "received", "pinned.txt")); err != nil {
+		t.Errorf("Expected the file to be received from the pinned sender: %v", err)
+	}
+}
+
+func TestReceiveTriesEveryAddress(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "fallback.txt")
+	if err := os.WriteFile(srcFile, []byte("reached over the second address"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	portChan := make(chan int, 1)
+	go StartSenderWithOptions([]string{srcFile}, SenderOptions{
+		AllowConn: func(addr string) bool { return true },
+		PortChan:  portChan,
+		Ctx:       ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	// The first address accepts connections but never answers the handshake,
+	// like a peer reached over the wrong interface.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer silent.Close()
+
+	opts := ReceiverOptions{
+		DownloadDir: filepath.Join(tmpDir, "received"),
+		Addresses:   []string{fmt.Sprintf("127.0.0.1:%d", port)},
+	}
+	start := time.Now()
+	if err := ReceiveConnectWithOptions(silent.Addr().String(), opts); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > dialTimeout/2 {
+		t.Errorf("Receive took %s, expected the second address to be tried early", elapsed)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "received", "fallback.txt")); err != nil {
+		t.Errorf("Expected the file to be received: %v", err)
+	}
+}
+
+func TestReceiveCancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "awaiting.txt")
+	if err := os.WriteFile(srcFile, []byte("never sent"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The sender never makes up its mind about the receiver.
+	release := make(chan struct{})
+	defer close(release)
+	portChan := make(chan int, 1)
+	go StartSenderWithOptions([]string{srcFile}, SenderOptions{
+		AllowConn: func(addr string) bool { <-release; return false },
+		PortChan:  portChan,
+		Ctx:       ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	// A peer that accepts connections but never answers the handshake.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer silent.Close()
+
+	for name, address := range map[string]string{
+		"connecting":           silent.Addr().String(),
+		"waiting for approval": fmt.Sprintf("127.0.0.1:%d", port),
+	} {
+		recvCtx, recvCancel := context.WithCancel(context.Background())
+		time.AfterFunc(200*time.Millisecond, recvCancel)
+		opts := ReceiverOptions{
+			DownloadDir: filepath.Join(tmpDir, "received"),
+			Ctx:         recvCtx,
+		}
+		start := time.Now()
+		if err := ReceiveConnectWithOptions(address, opts); err == nil {
+			t.Errorf("%s: expected a cancelled receive to fail", name)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: receive took %s to stop after being cancelled", name, elapsed)
+		}
+		recvCancel()
+	}
+}
+
+func TestSenderHandshakesBeforeApproval(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "approved.txt")
+	if err := os.WriteFile(srcFile, []byte("worth the wait"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The receiver's handshake has to finish while the user is still
+	// deciding, or a slow answer would run into dialTimeout.
+	asked := make(chan struct{})
+	release := make(chan struct{})
+	portChan := make(chan int, 1)
+	go StartSenderWithOptions([]string{srcFile}, SenderOptions{
+		AllowConn: func(addr string) bool { close(asked); <-release; return true },
+		PortChan:  portChan,
+		Ctx:       ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 2 * time.Second}, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		close(release)
+		t.Fatalf("Handshake did not finish before approval: %v", err)
+	}
+	defer conn.Close()
+	select {
+	case <-asked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the approval prompt")
+	}
+	close(release)
+
+	var header FileHeader
+	if err := readMessage(conn, &header); err != nil {
+		t.Fatalf("Failed to read header after approval: %v", err)
+	}
+	if header.Name != "approved.txt" {
+		t.Errorf("Header name = %q, want approved.txt", header.Name)
+	}
+}
+
+func TestSenderTriesPortRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "ports.txt")
+	if err := os.WriteFile(srcFile, []byte("port range"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A single busy port fails with an error naming it.
+	err = StartSenderWithOptions([]string{srcFile}, SenderOptions{Port: busyPort, Ctx: ctx})
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("port %d", busyPort)) {
+		t.Fatalf("Expected an error naming port %d, got %v", busyPort, err)
+	}
+
+	portChan := make(chan int, 1)
+	go StartSenderWithOptions([]string{srcFile}, SenderOptions{
+		AllowConn: func(addr string) bool { return true },
+		PortChan:  portChan,
+		Port:      busyPort,
+		PortLast:  busyPort + 1,
+		Ctx:       ctx,
+	})
+
+	select {
+	case port := <-portChan:
+		if port != busyPort+1 {
+			t.Errorf("Expected the sender to skip busy port %d and use %d, got %d", busyPort, busyPort+1, port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+}
+
+func TestConnectCodeRoundTrip(t *testing.T) {
+	fingerprint := strings.Repeat("ab", 32)
+	code := ConnectCode{
+		Addresses:   []string{"192.168.1.20:4242", "[fd00::20]:4242"},
+		Fingerprint: fingerprint,
+	}
+
+	parsed, err := ParseConnectCode(code.String())
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", code.String(), err)
+	}
+	if !slices.Equal(parsed.Addresses, code.Addresses) || parsed.Fingerprint != fingerprint {
+		t.Errorf("Expected %+v, got %+v", code, parsed)
+	}
+
+	// A plain address pins nothing.
+	parsed, err = ParseConnectCode("192.168.1.20:4242")
+	if err != nil || parsed.Fingerprint != "" || len(parsed.Addresses) != 1 {
+		t.Errorf("Expected a plain address, got %+v, %v", parsed, err)
+	}
+
+	for _, bad := range []string{"192.168.1.20", "synapse://192.168.1.20:4242?fp=nothex"} {
+		if _, err := ParseConnectCode(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestShareCodeAuthentication(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "coded.txt")
+	if err := os.WriteFile(srcFile, []byte("coded content"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	code := NewShareCode()
+	accepted := make(chan string, 1)
+	portChan := make(chan int, 1)
+	go StartSenderWithOptions([]string{srcFile}, SenderOptions{
+		// Only the code gets a receiver in.
+		AllowConn:      func(addr string) bool { return false },
+		OnCodeAccepted: func(addr string) { accepted <- addr },
+		Code:           code,
+		PortChan:       portChan,
+		Ctx:            ctx,
+	})
+
+	var port int
+	select {
+	case port = <-portChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to start")
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	downloadDir := filepath.Join(tmpDir, "received")
+
+	wrong := NewShareCode()
+	for wrong == code {
+		wrong = NewShareCode()
+	}
+	err := ReceiveConnectWithOptions(addr, ReceiverOptions{DownloadDir: downloadDir, Code: wrong})
+	if !errors.Is(err, ErrWrongCode) {
+		t.Fatalf("Expected ErrWrongCode, got %v", err)
+	}
+
+	// Codes are accepted however they are typed.
+	typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+	if err := ReceiveConnectWithOptions(addr, ReceiverOptions{DownloadDir: downloadDir, Code: typed}); err != nil {
+		t.Fatalf("Receive with the share code failed: %v", err)
+	}
+	select {
+	case <-accepted:
+	default:
+		t.Errorf("Expected OnCodeAccepted to be called")
+	}
+	content, err := os.ReadFile(filepath.Join(downloadDir, "coded.txt"))
+	if err != nil || string(content) != "coded content" {
+		t.Errorf("Expected the file to be received, got %q, %v", content, err)
+	}
+}
+
+func TestShareCodeLockout(t *testing.T) {
+	cert, err := GenerateTLSCertificate()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	code := NewShareCode()
+	key, err := DeriveShareKey(code, Fingerprint(cert.Certificate[0]))
+	if err != nil {
+		t.Fatalf("DeriveShareKey failed: %v", err)
+	}
+
+	// Keys are salted with the share's certificate, and found through it.
+	other, err := DeriveShareKey(code, strings.Repeat("0", 64))
+	if err != nil {
+		t.Fatalf("DeriveShareKey failed: %v", err)
+	}
+	if bytes.Equal(key, other) {
+		t.Errorf("Expected keys for different certificates to differ")
+	}
+	codes := NewCodeMatcher(code)
+	if fp := Fingerprint(cert.Certificate[0]); !codes.Matches(key.Tag(fp), fp) {
+		t.Errorf("Expected the CodeMatcher to match the share's tag")
+	}
+
+	// check runs one attempt with the right code while failures other
+	// attempts are counted, finished or not.
+	check := func(failures int32) (int32, error) {
+		var count atomic.Int32
+		count.Store(failures)
+		serverConn, clientConn := net.Pipe()
+		server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{codeProtocol}})
+		client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{codeProtocol}})
+		defer serverConn.Close()
+		go func() {
+			defer client.Close()
+			if err := client.Handshake(); err == nil {
+				_ = proveCode(client, code)
+			}
+		}()
+		_, err := checkCode(server, key, &count)
+		return count.Load(), err
+	}
+
+	if n, err := check(maxCodeFailures - 1); err != nil || n != maxCodeFailures-1 {
+		t.Errorf("Below the limit: got %d failures, %v; want %d, no error", n, err, maxCodeFailures-1)
+	}
+	if n, err := check(maxCodeFailures); !errors.Is(err, errCodesLocked) || n != maxCodeFailures {
+		t.Errorf("At the limit: got %d failures, %v; want %d, errCodesLocked", n, err, maxCodeFailures)
+	}
+}
+
+func TestSenderAnnouncesWithAnnouncer(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "announced.txt")
+	content := []byte("found through the in-memory backend")
+	if err := os.WriteFile(srcFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := discovery.NewMemory()
+	senderDone := make(chan error, 1)
+	go func() {
+		senderDone <- StartSenderWithOptions([]string{srcFile}, SenderOptions{
+			AllowConn: func(addr string) bool { return true },
+			Ctx:       ctx,
+			Announcer: backend,
+		})
+	}()
+
+	// discover returns the first peer backend reports within timeout.
+	discover := func(timeout time.Duration) (discovery.Peer, bool) {
+		dctx, dcancel := context.WithTimeout(ctx, timeout)
+		defer dcancel()
+		found := make(chan discovery.Peer, 1)
+		go backend.Discover(dctx, discovery.Service, func(p discovery.Peer) {
+			if p.TTL > 0 {
+				select {
+				case found <- p:
+				default:
+				}
+			}
+		})
+		select {
+		case p := <-found:
+			return p, true
+		case <-dctx.Done():
+			return discovery.Peer{}, false
+		}
+	}
+
+	peer, ok := discover(5 * time.Second)
+	if !ok {
+		t.Fatalf("Timed out waiting for the share to be announced")
+	}
+	if peer.Share == nil || peer.Share.Name != "announced.txt" {
+		t.Errorf("Expected the share to be described, got %+v", peer.Share)
+	}
+
+	opts := ReceiverOptions{
+		DownloadDir: filepath.Join(tmpDir, "received"),
+		Fingerprint: peer.Fingerprint,
+		Addresses:   peer.HostPorts()[1:],
+	}
+	if err := ReceiveConnectWithOptions(peer.HostPorts()[0], opts); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	received, err := os.ReadFile(filepath.Join(tmpDir, "received", "announced.txt"))
+	if err != nil || !bytes.Equal(received, content) {
+		t.Errorf("Expected the file to be received, got %q (%v)", received, err)
+	}
+
+	cancel()
+	select {
+	case <-senderDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for sender to stop")
+	}
+	if _, ok := discover(300 * time.Millisecond); ok {
+		t.Errorf("Expected the share to be withdrawn once the sender stopped")
+	}
+}
@@ -3,50 +3,107 @@ package ui
 import (
 	"context"
 	"fmt"
-	"time"
+	"strings"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
 	"github.com/example/synapse/pkg/ui" // Import the shared styles
-	"github.com/grandcat/zeroconf"
 )
 
 type sessionState int
 
 const (
 	stateScanning sessionState = iota
-	stateSelecting
 	stateTransferring
 	stateDone
 	stateError
 )
 
 type peerItem struct {
-	entry *zeroconf.ServiceEntry
+	peer discovery.Peer
 }
 
-func (i peerItem) Title() string       { return i.entry.Instance }
-func (i peerItem) Description() string { 
-	if len(i.entry.AddrIPv4) > 0 {
-		return fmt.Sprintf("%s:%d", i.entry.AddrIPv4[0], i.entry.Port)
+func (i peerItem) Title() string {
+	title := i.peer.Label()
+	if i.peer.OS != "" {
+		title += " (" + i.peer.OS + ")"
 	}
-	return "Unknown Address"
+	return title
 }
-func (i peerItem) FilterValue() string { return i.entry.Instance }
+
+func (i peerItem) Description() string {
+	var parts []string
+	if i.peer.Share != nil {
+		parts = append(parts, i.peer.Share.String())
+	} else if i.peer.Saved {
+		parts = append(parts, "Address book")
+	}
+	if addrs := addressList(i.peer); len(addrs) > 0 {
+		parts = append(parts, fmt.Sprintf("%s port %d", strings.Join(addrs, ", "), i.peer.Port))
+	}
+	if len(parts) == 0 {
+		return "Unknown Address"
+	}
+	return strings.Join(parts, " · ")
+}
+
+// FilterValue lets the list's filter match peers by name, address or the
+// name of what they share.
+func (i peerItem) FilterValue() string {
+	fields := append([]string{i.peer.Label(), i.peer.Instance}, addressList(i.peer)...)
+	if i.peer.Share != nil {
+		fields = append(fields, i.peer.Share.Name)
+	}
+	return strings.Join(fields, " ")
+}
+
+func addressList(p discovery.Peer) []string {
+	var addrs []string
+	for _, ip := range p.Addresses() {
+		addrs = append(addrs, ip.String())
+	}
+	return addrs
+}
+
+var rescanKey = key.NewBinding(
+	key.WithKeys("r"),
+	key.WithHelp("r", "rescan"),
+)
+
+var connectKey = key.NewBinding(
+	key.WithKeys("a"),
+	key.WithHelp("a", "connect by code"),
+)
 
 type Model struct {
-	state      sessionState
-	spinner    spinner.Model
-	list       list.Model
-	peers      []*zeroconf.ServiceEntry
-	selected   *zeroconf.ServiceEntry
-	err        error
-	width      int
-	height     int
-	cancelScan context.CancelFunc
+	state    sessionState
+	spinner  spinner.Model
+	list     list.Model
+	watch    *peerWatch
+	selected *discovery.Peer
+	err      error
+	width    int
+	height   int
+
+	// Set by WithTransfers
+	transfers   TransferConfig
+	xfer        *transferState
+	progress    progress.Model
+	choosing    *SelectionModel
+	chooseReply chan []string
+	completed   int
+	lastErr     error
+
+	// The address prompt, while it is open
+	address    *textinput.Model
+	addressErr error
 }
 
 func NewReceiverModel() Model {
@@ -57,6 +114,9 @@ func NewReceiverModel() Model {
 	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
 	l.Title = "Select a Peer"
 	l.SetShowStatusBar(false)
+	l.SetSpinner(spinner.Dot)
+	l.AdditionalShortHelpKeys = func() []key.Binding { return []key.Binding{rescanKey} }
+	l.AdditionalFullHelpKeys = l.AdditionalShortHelpKeys
 
 	return Model{
 		state:   stateScanning,
@@ -65,10 +125,22 @@ func NewReceiverModel() Model {
 	}
 }
 
+// WithTransfers makes the model run downloads from the picked peers itself,
+// as configured by cfg.
+func (m Model) WithTransfers(cfg TransferConfig) Model {
+	m.transfers = cfg
+	if cfg.Connect != nil {
+		m.list.AdditionalShortHelpKeys = func() []key.Binding { return []key.Binding{rescanKey, connectKey} }
+		m.list.AdditionalFullHelpKeys = m.list.AdditionalShortHelpKeys
+	}
+	return m
+}
+
 func (m Model) Init() tea.Cmd {
+	// Init can't keep state on m, so the watch is started from Update.
 	return tea.Batch(
 		m.spinner.Tick,
-		scanPeersCmd,
+		func() tea.Msg { return startWatchMsg{} },
 	)
 }
 
@@ -79,118 +151,311 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 		m.list.SetSize(msg.Width, msg.Height-4) // Adjust for margin
+		m.progress.Width = max(min(msg.Width-4, 60), 20)
+		if m.choosing != nil {
+			m.choosing.height = max(msg.Height-6, 3)
+		}
+		return m, nil
 
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "q", "ctrl+c":
-			if m.cancelScan != nil {
-				m.cancelScan()
-			}
-			return m, tea.Quit
+	case startWatchMsg:
+		cmd = m.startWatch()
+		return m, tea.Batch(cmd, m.list.StartSpinner())
+
+	case peerEventMsg:
+		if msg.watch != m.watch {
+			return m, nil // From a watch stopped since
 		}
+		cmd = m.applyPeerEvent(msg.event)
+		return m, tea.Batch(cmd, m.watch.next)
 
-	case peersFoundMsg:
-		m.peers = msg.peers
-		items := make([]list.Item, len(m.peers))
-		for i, p := range m.peers {
-			items[i] = peerItem{entry: p}
+	case watchDoneMsg:
+		if msg.watch != m.watch {
+			return m, nil
+		}
+		m.watch = nil
+		if msg.err != nil {
+			m.err = msg.err
+			m.state = stateError
+			return m, tea.Quit
 		}
-		m.list.SetItems(items)
-		m.state = stateSelecting
 		return m, nil
+	}
 
-	case errMsg:
-		m.err = msg.err
-		m.state = stateError
-		return m, tea.Quit // Or just show error
+	if m.xfer != nil {
+		return m.updateTransfer(msg)
+	}
+	if m.address != nil {
+		return m.updateAddress(msg)
 	}
 
-	// State specific update
-	switch m.state {
-	case stateScanning:
+	switch msg := msg.(type) {
+	case spinner.TickMsg:
+		// Both the search spinner and the list's title spinner tick; each
+		// ignores the other's messages.
+		var listCmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
-		return m, cmd
+		m.list, listCmd = m.list.Update(msg)
+		return m, tea.Batch(cmd, listCmd)
 
-	case stateSelecting:
-		switch msg := msg.(type) {
-		case tea.KeyMsg:
-			if msg.String() == "enter" {
-				i, ok := m.list.SelectedItem().(peerItem)
-				if ok {
-					m.selected = i.entry
-					m.state = stateTransferring
-					// We need to quit Bubble Tea to let the transfer function handle stdout/progress bar
-					// Or we could run transfer in a command. 
-					// The requirements say "Allow the user to navigate... and press Enter to connect."
-					// And "Implement a rich TUI".
-					// But `transfer.ReceiveConnect` uses `progressbar/v3` which writes to stdout.
-					// If we stay in Bubble Tea, we should capture progress.
-					// BUT, existing `transfer.ReceiveConnect` logic is synchronous and writes directly.
-					// Easiest path: Quit Bubble Tea, then run Connect.
-					return m, tea.Quit
-				}
+	case tea.KeyMsg:
+		// While a filter is typed, keys belong to the filter input.
+		if m.list.FilterState() == list.Filtering && msg.String() != "ctrl+c" {
+			break
+		}
+		switch {
+		case msg.String() == "q" || msg.String() == "ctrl+c":
+			m.stopWatch()
+			return m, tea.Quit
+
+		case key.Matches(msg, rescanKey):
+			m.list.ResetFilter()
+			m.list.SetItems(nil)
+			cmd = m.startWatch()
+			return m, cmd
+
+		case key.Matches(msg, connectKey) && m.transfers.Connect != nil:
+			input := textinput.New()
+			input.Placeholder = "7-tiger-lamp-ocean, host:port or synapse://…"
+			input.Width = max(m.width-4, 20)
+			cmd = input.Focus()
+			m.address = &input
+			m.addressErr = nil
+			return m, cmd
+
+		case msg.String() == "enter":
+			i, ok := m.list.SelectedItem().(peerItem)
+			if !ok {
+				return m, nil
+			}
+			peer := i.peer
+			m.selected = &peer
+			m.stopWatch()
+			if m.transfers.Receive != nil {
+				receive := m.transfers.Receive
+				cmd = m.startTransfer(peer, func(opts transfer.ReceiverOptions) error {
+					return receive(peer, opts)
+				})
+				return m, tea.Batch(cmd, m.spinner.Tick)
 			}
+			m.state = stateTransferring
+			// Quit Bubble Tea and let the caller run the transfer, for
+			// callers that don't use WithTransfers.
+			return m, tea.Quit
 		}
-		m.list, cmd = m.list.Update(msg)
+	}
+
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+// updateAddress handles the address prompt: enter connects to the share
+// with the typed share code, or to the typed address or connection code;
+// esc goes back to the peer list.
+func (m Model) updateAddress(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c":
+			m.stopWatch()
+			return m, tea.Quit
+
+		case "esc":
+			m.address = nil
+			return m, nil
+
+		case "enter":
+			// Addresses and connection codes have a colon; share codes don't.
+			if !strings.Contains(m.address.Value(), ":") {
+				return m.connectByShareCode(m.address.Value())
+			}
+			code, err := transfer.ParseConnectCode(m.address.Value())
+			if err != nil {
+				m.addressErr = err
+				return m, nil
+			}
+			m.address = nil
+			m.stopWatch()
+			// The peer only names the sender in the transfer view.
+			peer := discovery.Peer{DisplayName: code.Addresses[0], Fingerprint: code.Fingerprint}
+			m.selected = &peer
+			connect := m.transfers.Connect
+			cmd = m.startTransfer(peer, func(opts transfer.ReceiverOptions) error {
+				return connect(code, opts)
+			})
+			return m, tea.Batch(cmd, m.spinner.Tick)
+		}
+	}
+
+	// Discovery keeps running behind the prompt.
+	if _, ok := msg.(spinner.TickMsg); ok {
+		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
 	}
+	var input textinput.Model
+	input, cmd = m.address.Update(msg)
+	m.address = &input
+	return m, cmd
+}
 
+// connectByShareCode downloads from the listed share that announces code,
+// proving the code so the sender doesn't have to approve.
+func (m Model) connectByShareCode(typed string) (tea.Model, tea.Cmd) {
+	code, err := transfer.ParseShareCode(typed)
+	if err == nil {
+		codes := transfer.NewCodeMatcher(code)
+		for _, item := range m.list.Items() {
+			peer := item.(peerItem).peer
+			if !codes.Matches(peer.CodeTag, peer.Fingerprint) {
+				continue
+			}
+			m.address = nil
+			m.selected = &peer
+			m.stopWatch()
+			receive := m.transfers.Receive
+			cmd := m.startTransfer(peer, func(opts transfer.ReceiverOptions) error {
+				opts.Code = code
+				return receive(peer, opts)
+			})
+			return m, tea.Batch(cmd, m.spinner.Tick)
+		}
+		err = fmt.Errorf("no share with code %s found yet; check the code, or wait for the share to show up", code)
+	}
+	m.addressErr = err
 	return m, nil
 }
 
+// applyPeerEvent adds, updates or removes the event's peer in the list.
+func (m *Model) applyPeerEvent(ev discovery.PeerEvent) tea.Cmd {
+	index := -1
+	for i, item := range m.list.Items() {
+		if item.(peerItem).peer.Key() == ev.Peer.Key() {
+			index = i
+			break
+		}
+	}
+
+	switch {
+	case ev.Type == discovery.PeerRemoved:
+		if index >= 0 {
+			m.list.RemoveItem(index)
+		}
+		return nil
+	case index >= 0:
+		return m.list.SetItem(index, peerItem{peer: ev.Peer})
+	default:
+		return m.list.InsertItem(len(m.list.Items()), peerItem{peer: ev.Peer})
+	}
+}
+
 func (m Model) View() string {
 	if m.err != nil {
 		return fmt.Sprintf("\n%s\n", ui.Render("Error: "+m.err.Error()))
 	}
 
-	switch m.state {
-	case stateScanning:
-		return fmt.Sprintf("\n %s Scanning for peers...\n\n", m.spinner.View())
+	if m.xfer != nil {
+		return m.transferView()
+	}
 
-	case stateSelecting:
-		return "\n" + m.list.View()
+	if m.address != nil {
+		view := fmt.Sprintf("\n Connect to a sender by share code, address or connection code:\n\n %s\n", m.address.View())
+		if m.addressErr != nil {
+			view += "\n " + xferErrStyle.Render(m.addressErr.Error()) + "\n"
+		}
+		return view + "\n " + xferDimStyle.Render("enter: connect • esc: back") + "\n"
+	}
 
-	case stateTransferring:
-		return fmt.Sprintf("\nConnecting to %s...\n", m.selected.Instance)
-	
-	default:
-		return ""
+	if len(m.list.Items()) == 0 {
+		help := "r: rescan • q: quit"
+		if m.transfers.Connect != nil {
+			help = "r: rescan • a: connect by code • q: quit"
+		}
+		return fmt.Sprintf("\n %s Still searching for peers...\n\n %s\n",
+			m.spinner.View(), xferDimStyle.Render(help))
 	}
+	return "\n" + m.list.View()
 }
 
-// Commands and Messages
+// Background peer discovery
 
-type peersFoundMsg struct {
-	peers []*zeroconf.ServiceEntry
+// peerWatch is a running discovery.Watch feeding the peer list.
+type peerWatch struct {
+	events chan discovery.PeerEvent
+	done   chan error
+	cancel context.CancelFunc
 }
 
-type errMsg struct{ err error }
+type startWatchMsg struct{}
 
-func scanPeersCmd() tea.Msg {
-	// Scan for 2 seconds
-	entries := make(chan *zeroconf.ServiceEntry)
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+type peerEventMsg struct {
+	watch *peerWatch
+	event discovery.PeerEvent
+}
 
+type watchDoneMsg struct {
+	watch *peerWatch
+	err   error
+}
+
+// startWatch replaces any running watch with a new one.
+func (m *Model) startWatch() tea.Cmd {
+	m.stopWatch()
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &peerWatch{
+		events: make(chan discovery.PeerEvent),
+		done:   make(chan error, 1),
+		cancel: cancel,
+	}
 	go func() {
-		if err := discovery.Browse(ctx, entries); err != nil {
-			// In a real app we might send an error msg, but browse can fail if no listeners
-		}
+		w.done <- discovery.Watch(ctx, w.events)
 	}()
+	m.watch = w
+	return w.next
+}
 
-	var peers []*zeroconf.ServiceEntry
-	for entry := range entries {
-		peers = append(peers, entry)
+func (m *Model) stopWatch() {
+	if m.watch == nil {
+		return
 	}
+	w := m.watch
+	m.watch = nil
+	w.cancel()
+	// Nobody reads the events of a stopped watch any more; drain them so
+	// Watch can return.
+	go func() {
+		for range w.events {
+		}
+	}()
+}
 
-	if len(peers) == 0 {
-		return errMsg{err: fmt.Errorf("no peers found")}
+// next delivers the watch's next event.
+func (w *peerWatch) next() tea.Msg {
+	ev, ok := <-w.events
+	if !ok {
+		return watchDoneMsg{watch: w, err: <-w.done}
 	}
-
-	return peersFoundMsg{peers: peers}
+	return peerEventMsg{watch: w, event: ev}
 }
 
 // Helper to get selected peer after model quits
-func (m Model) GetSelectedPeer() *zeroconf.ServiceEntry {
+func (m Model) GetSelectedPeer() *discovery.Peer {
 	return m.selected
 }
+
+// NoPeers reports whether no peer was listed when the TUI was left.
+func (m Model) NoPeers() bool {
+	return m.xfer == nil && len(m.list.Items()) == 0
+}
+
+// Completed returns how many downloads finished successfully in the TUI.
+func (m Model) Completed() int {
+	return m.completed
+}
+
+// Err returns the error of the last download run in the TUI, if it failed,
+// or the error that stopped peer discovery.
+func (m Model) Err() error {
+	if m.lastErr != nil {
+		return m.lastErr
+	}
+	return m.err
+}
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/example/synapse/internal/transfer"
+	"github.com/example/synapse/pkg/utils"
+)
+
+var (
+	selTitleStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("205"))
+	selCursorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	selHelpStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+)
+
+// SelectionModel lets the user pick which files of a multi-file share to download.
+type SelectionModel struct {
+	entries  []transfer.ShareEntry
+	checked  []bool
+	cursor   int
+	offset   int
+	height   int
+	done     bool
+	canceled bool
+}
+
+// NewSelectionModel creates a picker with every entry selected.
+func NewSelectionModel(entries []transfer.ShareEntry) SelectionModel {
+	checked := make([]bool, len(entries))
+	for i := range checked {
+		checked[i] = true
+	}
+	return SelectionModel{
+		entries: entries,
+		checked: checked,
+		height:  15,
+	}
+}
+
+func (m SelectionModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m SelectionModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = max(msg.Height-6, 3)
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			m.canceled = true
+			return m, tea.Quit
+		case "enter":
+			m.done = true
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.entries)-1 {
+				m.cursor++
+			}
+		case " ", "x":
+			if len(m.entries) > 0 {
+				m.checked[m.cursor] = !m.checked[m.cursor]
+			}
+		case "a":
+			all := m.allChecked()
+			for i := range m.checked {
+				m.checked[i] = !all
+			}
+		}
+	}
+
+	// Keep the cursor inside the visible window
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+m.height {
+		m.offset = m.cursor - m.height + 1
+	}
+	return m, nil
+}
+
+func (m SelectionModel) View() string {
+	if m.done || m.canceled {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n" + selTitleStyle.Render("Select files to download") + "\n\n")
+
+	end := min(m.offset+m.height, len(m.entries))
+	for i := m.offset; i < end; i++ {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = selCursorStyle.Render("> ")
+		}
+		box := "[ ]"
+		if m.checked[i] {
+			box = "[x]"
+		}
+		e := m.entries[i]
+		fmt.Fprintf(&b, "%s%s %s %s\n", cursor, box, e.Path, selHelpStyle.Render("("+utils.FormatBytes(e.Size)+")"))
+	}
+
+	count, size := m.summary()
+	fmt.Fprintf(&b, "\n%d of %d files, %s\n", count, len(m.entries), utils.FormatBytes(size))
+	b.WriteString(selHelpStyle.Render("space: toggle • a: all/none • enter: download • q: cancel") + "\n")
+	return b.String()
+}
+
+func (m SelectionModel) allChecked() bool {
+	for _, c := range m.checked {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+func (m SelectionModel) summary() (int, int64) {
+	var count int
+	var size int64
+	for i, c := range m.checked {
+		if c {
+			count++
+			size += m.entries[i].Size
+		}
+	}
+	return count, size
+}
+
+// Selected returns the chosen entry paths once the picker has quit. An empty
+// result with ok set means everything was kept; ok is false if the user
+// cancelled or deselected every entry.
+func (m SelectionModel) Selected() (paths []string, ok bool) {
+	if m.canceled {
+		return nil, false
+	}
+	if m.allChecked() {
+		return nil, true
+	}
+	for i, c := range m.checked {
+		if c {
+			paths = append(paths, m.entries[i].Path)
+		}
+	}
+	return paths, len(paths) > 0
+}
@@ -0,0 +1,483 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/example/synapse/internal/transfer"
+	"github.com/example/synapse/pkg/ui"
+	"github.com/example/synapse/pkg/utils"
+)
+
+// ShareFunc runs a share until it stops. opts carries the dashboard's
+// callbacks and context and must be passed on to the sender; the function
+// fills in the rest and chains any callbacks of its own.
+type ShareFunc func(opts transfer.SenderOptions) error
+
+// ShareConfig describes the share shown by the sender dashboard.
+type ShareConfig struct {
+	Share ShareFunc
+
+	Title      string   // What is being shared, e.g. a file name
+	Items      []string // Paths making up the share, if more than one
+	Size       int64    // Total size in bytes; negative if unknown
+	AutoAccept bool     // Approve receivers without asking
+
+	// Interfaces the share listens on, for its connection code; nil means
+	// the default ones.
+	Interfaces []net.Interface
+
+	// Code is the share code, shown for receivers to type; those who give
+	// it are approved without asking.
+	Code string
+}
+
+type receiverStatus int
+
+const (
+	receiverPending receiverStatus = iota
+	receiverApproved
+	receiverActive
+	receiverCompleted
+	receiverFailed
+	receiverDenied
+)
+
+// receiverRow is one receiver on the dashboard.
+type receiverRow struct {
+	addr   string
+	name   string
+	status receiverStatus
+	reply  chan bool // Answers the pending AllowConn call
+	bytes  int64
+	total  int64
+	start  time.Time
+	err    error
+}
+
+func (r *receiverRow) label() string {
+	if r.name != "" {
+		return fmt.Sprintf("%s (%s)", r.name, r.addr)
+	}
+	return r.addr
+}
+
+// SenderModel is a dashboard for a running share: it shows what is shared
+// and where, asks about each receiver that connects and tracks their
+// transfers until the share is stopped.
+type SenderModel struct {
+	cfg         ShareConfig
+	events      chan tea.Msg
+	ctx         context.Context
+	cancel      context.CancelFunc
+	spinner     spinner.Model
+	bar         progress.Model
+	port        int
+	fingerprint string
+	code        string // Connection code for receivers that can't discover the share
+	showQR      bool
+	rows        []*receiverRow
+	cursor      int
+	stopping    bool // Not accepting receivers, waiting for active ones
+	stopped     bool // The share has returned
+	err         error
+	width       int
+}
+
+// Messages sent from the running share
+
+type shareListeningMsg struct {
+	port        int
+	fingerprint string
+}
+
+type shareRequestMsg struct {
+	addr  string
+	reply chan bool // nil if the receiver was approved automatically
+}
+
+type shareStartMsg struct{ addr string }
+
+type shareProgressMsg struct{ info transfer.ProgressInfo }
+
+type shareFinishMsg struct {
+	addr string
+	err  error
+}
+
+type shareStoppedMsg struct{ err error }
+
+// NewSenderModel creates a dashboard that starts the share described by cfg.
+func NewSenderModel(cfg ShareConfig) SenderModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	bar := progress.New(progress.WithDefaultGradient(), progress.WithoutPercentage())
+	bar.Width = 24
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return SenderModel{
+		cfg:     cfg,
+		events:  make(chan tea.Msg, 16),
+		ctx:     ctx,
+		cancel:  cancel,
+		spinner: s,
+		bar:     bar,
+	}
+}
+
+func (m SenderModel) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, m.startShare(), waitForShare(m.events))
+}
+
+// startShare runs the share in the background, feeding its callbacks into
+// the dashboard as messages.
+func (m SenderModel) startShare() tea.Cmd {
+	events := m.events
+	autoAccept := m.cfg.AutoAccept
+	share := m.cfg.Share
+
+	var lastProgress time.Time
+	opts := transfer.SenderOptions{
+		Ctx:               m.ctx,
+		ConcurrentPrompts: true,
+		OnListening: func(port int, fingerprint string) {
+			events <- shareListeningMsg{port: port, fingerprint: fingerprint}
+		},
+		AllowConn: func(addr string) bool {
+			if autoAccept {
+				events <- shareRequestMsg{addr: addr}
+				return true
+			}
+			reply := make(chan bool)
+			events <- shareRequestMsg{addr: addr, reply: reply}
+			return <-reply
+		},
+		OnCodeAccepted: func(addr string) {
+			events <- shareRequestMsg{addr: addr}
+		},
+		OnTransferStart: func(conn net.Conn) {
+			events <- shareStartMsg{addr: conn.RemoteAddr().String()}
+		},
+		OnProgress: func(info transfer.ProgressInfo) {
+			done := info.TotalBytes > 0 && info.BytesSent >= info.TotalBytes
+			if !done && time.Since(lastProgress) < progressInterval {
+				return
+			}
+			lastProgress = time.Now()
+			events <- shareProgressMsg{info: info}
+		},
+		OnTransferEnd: func(addr string, err error) {
+			events <- shareFinishMsg{addr: addr, err: err}
+		},
+	}
+
+	return func() tea.Msg {
+		go func() {
+			events <- shareStoppedMsg{err: share(opts)}
+		}()
+		return nil
+	}
+}
+
+// waitForShare delivers the next message from the running share.
+func waitForShare(events chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+func (m SenderModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next := waitForShare(m.events)
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.bar.Width = max(min(msg.Width-60, 30), 10)
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+
+	case shareListeningMsg:
+		m.port = msg.port
+		m.fingerprint = msg.fingerprint
+		m.code = transfer.NewConnectCode(m.cfg.Interfaces, msg.port, msg.fingerprint).String()
+		return m, next
+
+	case shareRequestMsg:
+		row := &receiverRow{addr: msg.addr, reply: msg.reply, total: -1}
+		if msg.reply == nil {
+			row.status = receiverApproved
+		} else if m.stopping {
+			// The share was stopped while this receiver was connecting
+			row.status = receiverDenied
+			msg.reply <- false
+			row.reply = nil
+		}
+		m.rows = append(m.rows, row)
+		if m.rowAt(m.cursor) == nil || m.rowAt(m.cursor).status != receiverPending {
+			m.cursor = len(m.rows) - 1
+		}
+		return m, next
+
+	case shareStartMsg:
+		if row := m.findRow(func(r *receiverRow) bool { return r.addr == msg.addr && r.status == receiverApproved }); row != nil {
+			row.status = receiverActive
+		}
+		return m, next
+
+	case shareProgressMsg:
+		info := msg.info
+		if row := m.findRow(func(r *receiverRow) bool { return r.addr == info.PeerAddr && r.status == receiverActive }); row != nil {
+			if row.start.IsZero() {
+				row.start = time.Now()
+			}
+			if info.PeerName != "" && info.PeerName != info.PeerAddr {
+				row.name = info.PeerName
+			}
+			row.bytes = info.BytesSent
+			row.total = info.TotalBytes
+		}
+		return m, next
+
+	case shareFinishMsg:
+		if row := m.findRow(func(r *receiverRow) bool { return r.addr == msg.addr && r.status == receiverActive }); row != nil {
+			row.err = msg.err
+			row.status = receiverCompleted
+			if msg.err != nil {
+				row.status = receiverFailed
+			}
+		}
+		return m.maybeQuit(next)
+
+	case shareStoppedMsg:
+		m.stopped = true
+		m.stopping = true
+		m.err = msg.err
+		m.denyPending()
+		return m.maybeQuit(next)
+	}
+	return m, nil
+}
+
+func (m SenderModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.rows)-1 {
+			m.cursor++
+		}
+	case "c":
+		m.showQR = !m.showQR && m.code != ""
+	case "y", "a":
+		m.answer(true)
+	case "n", "d":
+		m.answer(false)
+	case "s", "q", "ctrl+c", "esc":
+		if m.stopping {
+			// Second press: don't wait for active transfers
+			m.denyPending()
+			return m, tea.Quit
+		}
+		m.stop()
+		return m.maybeQuit(nil)
+	}
+	return m, nil
+}
+
+// answer approves or denies the selected receiver if it is waiting.
+func (m *SenderModel) answer(approve bool) {
+	row := m.rowAt(m.cursor)
+	if row == nil || row.status != receiverPending {
+		return
+	}
+	row.reply <- approve
+	row.reply = nil
+	row.status = receiverDenied
+	if approve {
+		row.status = receiverApproved
+	}
+	// Move on to the next receiver waiting for an answer
+	for i, r := range m.rows {
+		if r.status == receiverPending {
+			m.cursor = i
+			break
+		}
+	}
+}
+
+// stop withdraws the share: no new receivers are accepted, while transfers
+// already running are allowed to finish.
+func (m *SenderModel) stop() {
+	m.stopping = true
+	m.cancel()
+	m.denyPending()
+}
+
+func (m *SenderModel) denyPending() {
+	for _, r := range m.rows {
+		if r.status == receiverPending {
+			r.reply <- false
+			r.reply = nil
+			r.status = receiverDenied
+		}
+	}
+}
+
+// maybeQuit ends the program once the share has stopped and no transfer is
+// running anymore; otherwise it keeps listening with next.
+func (m SenderModel) maybeQuit(next tea.Cmd) (tea.Model, tea.Cmd) {
+	if m.stopping && m.stopped && m.active() == 0 {
+		return m, tea.Quit
+	}
+	return m, next
+}
+
+// active counts the approved receivers whose transfer hasn't finished.
+func (m SenderModel) active() int {
+	n := 0
+	for _, r := range m.rows {
+		if r.status == receiverApproved || r.status == receiverActive {
+			n++
+		}
+	}
+	return n
+}
+
+func (m SenderModel) rowAt(i int) *receiverRow {
+	if i < 0 || i >= len(m.rows) {
+		return nil
+	}
+	return m.rows[i]
+}
+
+func (m SenderModel) findRow(match func(*receiverRow) bool) *receiverRow {
+	for _, r := range m.rows {
+		if match(r) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (m SenderModel) View() string {
+	var b strings.Builder
+	b.WriteString("\n" + xferTitleStyle.Render("Sharing "+m.cfg.Title))
+	if m.cfg.Size >= 0 {
+		b.WriteString(" " + xferDimStyle.Render("("+utils.FormatBytes(m.cfg.Size)+")"))
+	}
+	b.WriteString("\n")
+	for i, item := range m.cfg.Items {
+		if i == 5 {
+			fmt.Fprintf(&b, "  %s\n", xferDimStyle.Render(fmt.Sprintf("... and %d more", len(m.cfg.Items)-i)))
+			break
+		}
+		fmt.Fprintf(&b, "  %s\n", item)
+	}
+
+	if m.port == 0 {
+		fmt.Fprintf(&b, "\n %s Starting...\n", m.spinner.View())
+	} else {
+		fmt.Fprintf(&b, "\n Port         %d\n", m.port)
+		fmt.Fprintf(&b, " Fingerprint  %s\n", groupFingerprint(m.fingerprint))
+		if m.cfg.Code != "" {
+			fmt.Fprintf(&b, " Share code   %s\n", xferTitleStyle.Render(m.cfg.Code))
+		}
+		if m.code != "" {
+			fmt.Fprintf(&b, " Connection   %s\n", m.code)
+		}
+		if m.showQR {
+			if qr, err := ui.QR(m.code); err == nil {
+				b.WriteString("\n" + qr)
+			}
+		}
+	}
+
+	b.WriteString("\n")
+	if len(m.rows) == 0 && !m.stopping {
+		fmt.Fprintf(&b, " %s Waiting for receivers...\n", m.spinner.View())
+	}
+	for i, r := range m.rows {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = selCursorStyle.Render("> ")
+		}
+		fmt.Fprintf(&b, "%s%s\n", cursor, m.rowView(r))
+	}
+
+	b.WriteString("\n")
+	switch {
+	case m.err != nil:
+		b.WriteString(" " + xferErrStyle.Render("Share stopped: "+m.err.Error()) + "\n")
+	case m.stopping && m.active() > 0:
+		fmt.Fprintf(&b, " Stopping after %d active transfer(s)... %s\n", m.active(), xferDimStyle.Render("press q again to abort"))
+	case m.stopping:
+		b.WriteString(" Share stopped.\n")
+	default:
+		b.WriteString(xferDimStyle.Render("y: approve • n: deny • ↑/↓: select • c: QR code • s: stop sharing") + "\n")
+	}
+	return b.String()
+}
+
+func (m SenderModel) rowView(r *receiverRow) string {
+	switch r.status {
+	case receiverPending:
+		return xferTitleStyle.Render("?") + " " + r.label() + " " + xferDimStyle.Render("wants to connect (y/n)")
+	case receiverApproved:
+		return m.spinner.View() + r.label() + " " + xferDimStyle.Render("connecting...")
+	case receiverDenied:
+		return xferDimStyle.Render("✗ " + r.label() + " denied")
+	case receiverFailed:
+		return xferErrStyle.Render("✗ "+r.label()) + " " + xferDimStyle.Render(r.err.Error())
+	case receiverCompleted:
+		if r.bytes == 0 {
+			return xferOKStyle.Render("✓ "+r.label()) + " " + xferDimStyle.Render("done")
+		}
+		return xferOKStyle.Render("✓ "+r.label()) + " " + xferDimStyle.Render(utils.FormatBytes(r.bytes)+" sent")
+	}
+
+	line := "› " + r.label() + " "
+	if r.total > 0 {
+		line += m.bar.ViewAs(min(float64(r.bytes)/float64(r.total), 1)) + " "
+		line += fmt.Sprintf("%s / %s", utils.FormatBytes(r.bytes), utils.FormatBytes(r.total))
+	} else {
+		line += utils.FormatBytes(r.bytes)
+	}
+	if elapsed := time.Since(r.start).Seconds(); !r.start.IsZero() && elapsed > 0 {
+		line += " • " + utils.FormatBytes(int64(float64(r.bytes)/elapsed)) + "/s"
+	}
+	return line
+}
+
+// groupFingerprint splits a fingerprint into groups of four hex digits so
+// that it is easier to compare by eye.
+func groupFingerprint(fp string) string {
+	var groups []string
+	for len(fp) > 4 {
+		groups = append(groups, fp[:4])
+		fp = fp[4:]
+	}
+	return strings.Join(append(groups, fp), " ")
+}
+
+// Err returns the error the share stopped with, if any.
+func (m SenderModel) Err() error {
+	return m.err
+}
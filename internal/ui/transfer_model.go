@@ -0,0 +1,465 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/example/synapse/internal/discovery"
+	"github.com/example/synapse/internal/transfer"
+	"github.com/example/synapse/pkg/utils"
+)
+
+// ReceiveFunc downloads from peer. opts carries the TUI's callbacks and must
+// be passed on to the transfer; the function fills in the rest, such as the
+// download directory, and chains any callbacks of its own.
+type ReceiveFunc func(peer discovery.Peer, opts transfer.ReceiverOptions) error
+
+// TransferConfig makes the receiver TUI run downloads itself, with a
+// progress view and a results screen, instead of quitting once a peer is
+// picked.
+type TransferConfig struct {
+	Receive ReceiveFunc
+
+	// Connect downloads from a sender given by host:port or connection
+	// code, for networks that block discovery. The picker only offers to
+	// connect by address when it is set. opts is handled as by Receive.
+	Connect func(code transfer.ConnectCode, opts transfer.ReceiverOptions) error
+
+	// Select shows the file picker for multi-file shares. Otherwise Filter,
+	// if set, chooses the files.
+	Select bool
+	Filter func(entries []transfer.ShareEntry) ([]string, error)
+
+	// Destination describes where received files go, for the results screen.
+	Destination string
+}
+
+// ErrTransferCancelled is the error of a download cancelled from the TUI.
+var ErrTransferCancelled = errors.New("transfer cancelled")
+
+// progressInterval throttles progress updates sent to the TUI.
+const progressInterval = 100 * time.Millisecond
+
+var (
+	xferTitleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("205"))
+	xferDimStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	xferOKStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+	xferErrStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+)
+
+// transferState is the download shown on the transfer and results screens.
+type transferState struct {
+	peer     discovery.Peer
+	events   chan tea.Msg
+	cancel   context.CancelFunc // Stops the download
+	fileName string
+	entries  []transfer.ShareEntry // Files being received from a multi-file share
+	bytes    int64
+	total    int64
+	start    time.Time // Time of the first progress update
+	end      time.Time
+	first    int64 // Bytes already present at start, for resumed files
+	verified bool
+	text     string
+	isText   bool
+	err      error
+
+	cancelled bool
+	quitAfter bool // ctrl+c was pressed; quit once the transfer has stopped
+}
+
+// Messages sent from the running transfer
+
+type transferChooseMsg struct {
+	entries []transfer.ShareEntry
+	reply   chan []string // Closed if the user cancels
+}
+
+type transferEntriesMsg struct{ entries []transfer.ShareEntry }
+
+type transferProgressMsg struct{ info transfer.ProgressInfo }
+
+type transferVerifiedMsg struct{}
+
+type transferTextMsg struct{ text string }
+
+type transferCompleteMsg struct{ fileName string }
+
+type transferDoneMsg struct{ err error }
+
+// startTransfer runs the download from peer in the background with
+// receive, feeding its callbacks into the TUI as messages.
+func (m *Model) startTransfer(peer discovery.Peer, receive func(opts transfer.ReceiverOptions) error) tea.Cmd {
+	events := make(chan tea.Msg, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	m.xfer = &transferState{peer: peer, events: events, cancel: cancel, total: -1}
+	m.state = stateTransferring
+	m.progress = progress.New(progress.WithDefaultGradient())
+	m.progress.Width = max(min(m.width-4, 60), 20)
+
+	cfg := m.transfers
+	var lastProgress time.Time
+	opts := transfer.ReceiverOptions{
+		Ctx: ctx,
+		SelectEntries: func(entries []transfer.ShareEntry) ([]string, error) {
+			var selected []string
+			var err error
+			switch {
+			case cfg.Select:
+				reply := make(chan []string)
+				events <- transferChooseMsg{entries: entries, reply: reply}
+				var ok bool
+				selected, ok = <-reply
+				if !ok {
+					return nil, ErrTransferCancelled
+				}
+			case cfg.Filter != nil:
+				selected, err = cfg.Filter(entries)
+				if err != nil {
+					return nil, err
+				}
+			}
+			events <- transferEntriesMsg{entries: selectedEntries(entries, selected)}
+			return selected, nil
+		},
+		OnProgress: func(info transfer.ProgressInfo) {
+			done := info.TotalBytes > 0 && info.BytesSent >= info.TotalBytes
+			if !done && time.Since(lastProgress) < progressInterval {
+				return
+			}
+			lastProgress = time.Now()
+			events <- transferProgressMsg{info: info}
+		},
+		OnVerified: func(string) {
+			events <- transferVerifiedMsg{}
+		},
+		OnText: func(text string) {
+			events <- transferTextMsg{text: text}
+		},
+		OnComplete: func(fileName string) {
+			events <- transferCompleteMsg{fileName: fileName}
+		},
+	}
+
+	go func() {
+		err := receive(opts)
+		cancel()
+		events <- transferDoneMsg{err: err}
+		close(events)
+	}()
+	return waitForTransfer(events)
+}
+
+// waitForTransfer delivers the next message from the running transfer.
+func waitForTransfer(events chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// updateTransfer handles messages and keys while a download runs or its
+// results are shown.
+func (m Model) updateTransfer(msg tea.Msg) (tea.Model, tea.Cmd) {
+	x := m.xfer
+	next := waitForTransfer(x.events)
+
+	switch msg := msg.(type) {
+	case spinner.TickMsg:
+		if m.state != stateTransferring {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		if m.choosing != nil {
+			if msg.String() == "ctrl+c" {
+				x.quitAfter = true
+			}
+			return m.updateChoosing(msg)
+		}
+		if m.state == stateDone {
+			switch msg.String() {
+			case "enter", "b":
+				return m.rescan()
+			case "q", "esc", "ctrl+c":
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		switch msg.String() {
+		case "c", "esc":
+			m.cancelTransfer()
+		case "ctrl+c", "q":
+			m.cancelTransfer()
+			x.quitAfter = true
+		}
+		return m, nil
+
+	case transferChooseMsg:
+		if x.cancelled {
+			close(msg.reply)
+			return m, next
+		}
+		sel := NewSelectionModel(msg.entries)
+		if m.height > 0 {
+			sel.height = max(m.height-6, 3)
+		}
+		m.choosing = &sel
+		m.chooseReply = msg.reply
+		return m, next
+
+	case transferEntriesMsg:
+		x.entries = msg.entries
+		return m, next
+
+	case transferProgressMsg:
+		info := msg.info
+		if x.start.IsZero() {
+			x.start = time.Now()
+			x.first = info.BytesSent
+		}
+		x.fileName = info.FileName
+		x.bytes = info.BytesSent
+		x.total = info.TotalBytes
+		return m, next
+
+	case transferVerifiedMsg:
+		x.verified = true
+		return m, next
+
+	case transferTextMsg:
+		x.isText = true
+		x.text = msg.text
+		return m, next
+
+	case transferCompleteMsg:
+		x.fileName = msg.fileName
+		return m, next
+
+	case transferDoneMsg:
+		x.end = time.Now()
+		x.err = msg.err
+		if x.cancelled && x.err != nil {
+			x.err = ErrTransferCancelled
+		}
+		if x.err == nil {
+			m.completed++
+		}
+		m.lastErr = x.err
+		m.state = stateDone
+		if x.quitAfter {
+			return m, tea.Quit
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+// updateChoosing forwards keys to the embedded file picker and hands its
+// answer back to the waiting transfer.
+func (m Model) updateChoosing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	updated, _ := m.choosing.Update(msg)
+	sel := updated.(SelectionModel)
+	m.choosing = &sel
+	if !sel.done && !sel.canceled {
+		return m, nil
+	}
+
+	selected, ok := sel.Selected()
+	if ok {
+		m.chooseReply <- selected
+	} else {
+		m.xfer.cancelled = true
+		close(m.chooseReply)
+	}
+	m.choosing = nil
+	m.chooseReply = nil
+	return m, nil
+}
+
+// cancelTransfer stops the running download, even before it has connected.
+func (m *Model) cancelTransfer() {
+	x := m.xfer
+	if x.cancelled {
+		return
+	}
+	x.cancelled = true
+	x.cancel()
+}
+
+// rescan goes back to the peer list for another download.
+func (m Model) rescan() (tea.Model, tea.Cmd) {
+	m.xfer = nil
+	m.selected = nil
+	m.err = nil
+	m.state = stateScanning
+	m.list.ResetFilter()
+	m.list.SetItems(nil)
+	cmd := m.startWatch()
+	return m, tea.Batch(m.spinner.Tick, cmd)
+}
+
+func (m Model) transferView() string {
+	if m.choosing != nil {
+		return m.choosing.View()
+	}
+
+	x := m.xfer
+	var b strings.Builder
+	b.WriteString("\n" + xferTitleStyle.Render("Receiving from "+x.peer.Label()) + "\n\n")
+
+	if m.state == stateDone {
+		b.WriteString(m.resultView())
+		return b.String()
+	}
+
+	switch {
+	case x.cancelled:
+		b.WriteString(" Cancelling...\n")
+	case x.start.IsZero():
+		fmt.Fprintf(&b, " %s Waiting for the sender...\n", m.spinner.View())
+	default:
+		b.WriteString(" " + x.fileName + "\n\n")
+		if x.total > 0 {
+			b.WriteString(" " + m.progress.ViewAs(min(float64(x.bytes)/float64(x.total), 1)) + "\n")
+			fmt.Fprintf(&b, " %s of %s", utils.FormatBytes(x.bytes), utils.FormatBytes(x.total))
+		} else {
+			fmt.Fprintf(&b, " %s", utils.FormatBytes(x.bytes))
+		}
+		if speed := x.speed(); speed > 0 {
+			fmt.Fprintf(&b, " • %s/s", utils.FormatBytes(int64(speed)))
+			if x.total > 0 && x.bytes < x.total {
+				eta := time.Duration(float64(x.total-x.bytes) / speed * float64(time.Second))
+				fmt.Fprintf(&b, " • %s left", eta.Round(time.Second))
+			}
+		}
+		b.WriteString("\n")
+		if x.verified {
+			b.WriteString(" " + xferOKStyle.Render("Checksum verified") + "\n")
+		}
+	}
+
+	b.WriteString(m.entriesView())
+	b.WriteString("\n" + xferDimStyle.Render("c: cancel • q: cancel and quit") + "\n")
+	return b.String()
+}
+
+func (m Model) resultView() string {
+	x := m.xfer
+	var b strings.Builder
+	switch {
+	case errors.Is(x.err, ErrTransferCancelled):
+		b.WriteString(" " + xferErrStyle.Render("Transfer cancelled.") + "\n")
+	case x.err != nil:
+		b.WriteString(" " + xferErrStyle.Render("Transfer failed: "+x.err.Error()) + "\n")
+	case x.isText:
+		b.WriteString(" " + xferOKStyle.Render("Received text:") + "\n\n")
+		b.WriteString(x.text + "\n")
+	case len(x.entries) > 0:
+		// Archives are extracted into the destination
+		b.WriteString(" " + xferOKStyle.Render(fmt.Sprintf("Received %d files", len(x.entries))) + "\n")
+		if m.transfers.Destination != "" {
+			b.WriteString(" Saved to " + m.transfers.Destination + "\n")
+		}
+		b.WriteString(x.statsView())
+	default:
+		b.WriteString(" " + xferOKStyle.Render("Received "+x.fileName) + "\n")
+		if m.transfers.Destination != "" {
+			b.WriteString(" Saved to " + filepath.Join(m.transfers.Destination, x.fileName) + "\n")
+		}
+		b.WriteString(x.statsView())
+	}
+	b.WriteString("\n" + xferDimStyle.Render("enter: receive another • q: quit") + "\n")
+	return b.String()
+}
+
+// entriesView lists the files of a multi-file share with their status.
+// The archive is a single stream, so a file's status is estimated from how
+// many bytes have arrived.
+func (m Model) entriesView() string {
+	x := m.xfer
+	if len(x.entries) == 0 {
+		return ""
+	}
+
+	rows := len(x.entries)
+	if m.height > 0 {
+		rows = min(rows, max(m.height-14, 3))
+	}
+
+	var b strings.Builder
+	b.WriteString("\n")
+	var offset int64
+	for i, e := range x.entries {
+		start := offset
+		offset += e.Size
+		if i >= rows {
+			continue
+		}
+		status := xferDimStyle.Render("·")
+		switch {
+		case x.verified || x.bytes >= offset:
+			status = xferOKStyle.Render("✓")
+		case x.bytes > start:
+			status = xferTitleStyle.Render("›")
+		}
+		fmt.Fprintf(&b, " %s %s %s\n", status, e.Path, xferDimStyle.Render("("+utils.FormatBytes(e.Size)+")"))
+	}
+	if rows < len(x.entries) {
+		fmt.Fprintf(&b, "   %s\n", xferDimStyle.Render(fmt.Sprintf("... and %d more", len(x.entries)-rows)))
+	}
+	return b.String()
+}
+
+// statsView summarizes a finished download.
+func (x *transferState) statsView() string {
+	if x.start.IsZero() {
+		return ""
+	}
+	elapsed := x.end.Sub(x.start).Round(100 * time.Millisecond)
+	return fmt.Sprintf(" %s in %s\n", utils.FormatBytes(x.bytes), elapsed)
+}
+
+// speed returns the average transfer rate in bytes per second.
+func (x *transferState) speed() float64 {
+	if x.start.IsZero() {
+		return 0
+	}
+	elapsed := time.Since(x.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(x.bytes-x.first) / elapsed
+}
+
+// selectedEntries returns the entries covered by selected, which holds file
+// paths and directory prefixes; no selection means every entry.
+func selectedEntries(entries []transfer.ShareEntry, selected []string) []transfer.ShareEntry {
+	if len(selected) == 0 {
+		return entries
+	}
+	var kept []transfer.ShareEntry
+	for _, e := range entries {
+		for _, s := range selected {
+			if e.Path == s || strings.HasPrefix(e.Path, strings.TrimSuffix(s, "/")+"/") {
+				kept = append(kept, e)
+				break
+			}
+		}
+	}
+	return kept
+}
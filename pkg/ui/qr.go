@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// qrQuietZone is the light border kept around a QR code, in modules.
+const qrQuietZone = 2
+
+// QR renders text as a QR code for the terminal. Each character covers two
+// rows of modules with a half block, coloured explicitly so the code scans
+// on dark and light terminals alike.
+func QR(text string) (string, error) {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	dark := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Black(x, y)
+	}
+	color := func(isDark bool) int {
+		if isDark {
+			return 16 // Black in the 256-colour palette
+		}
+		return 231 // White
+	}
+
+	var b strings.Builder
+	for y := -qrQuietZone; y < code.Size+qrQuietZone; y += 2 {
+		for x := -qrQuietZone; x < code.Size+qrQuietZone; x++ {
+			fmt.Fprintf(&b, "\x1b[38;5;%dm\x1b[48;5;%dm▀", color(dark(x, y)), color(dark(x, y+1)))
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	return b.String(), nil
+}
@@ -2,6 +2,8 @@ package ui
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
@@ -42,14 +44,23 @@ var (
 			Padding(0, 1).
 			Bold(true).
 			SetString("ERROR")
-	
+
 	textStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("252"))
 )
 
+// output receives every status message. Pipe mode moves it to stderr so
+// stdout only carries transferred data.
+var output io.Writer = os.Stdout
+
+// SetOutput redirects status messages, e.g. to os.Stderr.
+func SetOutput(w io.Writer) {
+	output = w
+}
+
 // PrintBanner prints the LanDrop banner
 func PrintBanner() {
-	// NOTE: Backticks inside the ASCII art have been replaced with apostrophes (') 
+	// NOTE: Backticks inside the ASCII art have been replaced with apostrophes (')
 	// to prevent syntax errors in the Go string literal.
 	banner := `
         ,gggg,                          ,gggggggggggg,                       
@@ -69,26 +80,31 @@ func PrintBanner() {
                                                                                  I8          
                                                                                  I8          
 `
-	fmt.Println(bannerStyle.Render(strings.TrimSpace(banner)))
-	fmt.Println()
+	fmt.Fprintln(output, bannerStyle.Render(strings.TrimSpace(banner)))
+	fmt.Fprintln(output)
 }
 
 // Info prints an info message
 func Info(format string, a ...interface{}) {
 	msg := fmt.Sprintf(format, a...)
-	fmt.Printf("%s %s\n", infoBadge.String(), textStyle.Render(msg))
+	fmt.Fprintf(output, "%s %s\n", infoBadge.String(), textStyle.Render(msg))
 }
 
 // Success prints a success message
 func Success(format string, a ...interface{}) {
 	msg := fmt.Sprintf(format, a...)
-	fmt.Printf("%s %s\n", successBadge.String(), textStyle.Render(msg))
+	fmt.Fprintf(output, "%s %s\n", successBadge.String(), textStyle.Render(msg))
 }
 
 // Error prints an error message
 func Error(format string, a ...interface{}) {
 	msg := fmt.Sprintf(format, a...)
-	fmt.Printf("%s %s\n", errorBadge.String(), textStyle.Render(msg))
+	fmt.Fprintf(output, "%s %s\n", errorBadge.String(), textStyle.Render(msg))
+}
+
+// Printf prints an unstyled message to the status output
+func Printf(format string, a ...interface{}) {
+	fmt.Fprintf(output, format, a...)
 }
 
 // Render returns a generic string using the text style
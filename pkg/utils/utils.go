@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 )
@@ -15,3 +16,21 @@ func SanitizeFilename(name string) string {
 	}
 	return safeName
 }
+
+// FormatBytes renders a byte count using decimal units, e.g. "12.3 MB".
+// Negative counts, the size of a stream, render as "unknown size".
+func FormatBytes(b int64) string {
+	if b < 0 {
+		return "unknown size"
+	}
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "kMGTPE"[exp])
+}